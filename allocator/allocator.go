@@ -0,0 +1,125 @@
+/*
+Package allocator provides a high-contention allocator class. It is a part
+of FoundationDb layer.
+
+The allocator hands out integers that are unique forever and small while
+few are taken, e.g. for short key prefixes. Instead of a single counter,
+which every allocation would conflict on, candidates are picked at random
+within a window that grows as integers are used up:
+
+	(0, window start) -> number of allocations in the window
+	(1, integer)      -> "" for integers allocated recently
+
+The window moves on once it is half full, so a random candidate is free
+about every second try.
+
+This code is a port from official python layer
+*/
+
+package allocator
+
+import (
+	"encoding/binary"
+	"github.com/FoundationDB/fdb-go/fdb"
+	"github.com/FoundationDB/fdb-go/fdb/subspace"
+	"math/rand"
+)
+
+type Allocator struct {
+	Subspace subspace.Subspace
+	counters subspace.Subspace
+	recent   subspace.Subspace
+}
+
+// New allocator is created within a given subspace
+func New(sub subspace.Subspace) Allocator {
+	return Allocator{sub, sub.Sub(0), sub.Sub(1)}
+}
+
+var oneBytes = []byte{1, 0, 0, 0, 0, 0, 0, 0}
+
+func windowSize(start int64) int64 {
+	// Larger window sizes are better for high contention, smaller sizes for
+	// keeping the keys small. But if there are many allocations, the keys
+	// can't be too small. So start small and scale up.
+	if start < 255 {
+		return 64
+	}
+	if start < 65535 {
+		return 1024
+	}
+	return 8192
+}
+
+// Allocate returns an integer no other call of the allocator returns
+func (a *Allocator) Allocate(tr fdb.Transaction) (int64, error) {
+	for {
+		start, err := a.latestStart(tr)
+		if err != nil {
+			return 0, err
+		}
+
+		window := int64(0)
+		advanced := false
+		for {
+			if advanced {
+				tr.ClearRange(fdb.KeyRange{Begin: a.counters, End: a.counters.Sub(start)})
+				tr.Options().SetNextWriteNoWriteConflictRange()
+				tr.ClearRange(fdb.KeyRange{Begin: a.recent, End: a.recent.Sub(start)})
+			}
+
+			// Increment the allocation count for the current window
+			tr.Add(a.counters.Sub(start), oneBytes)
+			count := int64(0)
+			if val := tr.Snapshot().Get(a.counters.Sub(start)).GetOrPanic(); len(val) == 8 {
+				count = int64(binary.LittleEndian.Uint64(val))
+			}
+
+			window = windowSize(start)
+			if count*2 < window {
+				break
+			}
+			start += window
+			advanced = true
+		}
+
+		for {
+			// As of the snapshot being read from, the window is less than
+			// half full, so this should be expected to take 2 tries. Under
+			// high contention (and when the window advances), there is an
+			// additional subsequent risk of conflict for this transaction.
+			candidate := rand.Int63n(window) + start
+			key := a.recent.Sub(candidate)
+
+			taken := tr.Get(key).GetOrPanic() != nil
+			tr.Options().SetNextWriteNoWriteConflictRange()
+			tr.Set(key, []byte(""))
+
+			latest, err := a.latestStart(tr)
+			if err != nil {
+				return 0, err
+			}
+			if latest > start {
+				// the window moved on, pick a candidate in the new one
+				break
+			}
+			if !taken {
+				tr.AddWriteConflictKey(key)
+				return candidate, nil
+			}
+		}
+	}
+}
+
+// latestStart returns the start of the current window
+func (a *Allocator) latestStart(tr fdb.Transaction) (int64, error) {
+	kvs := tr.Snapshot().GetRange(a.counters, fdb.RangeOptions{Limit: 1, Reverse: true}).GetSliceOrPanic()
+	if len(kvs) == 0 {
+		return 0, nil
+	}
+	t, err := a.counters.Unpack(kvs[0].Key)
+	if err != nil {
+		return 0, err
+	}
+	return t[0].(int64), nil
+}
@@ -0,0 +1,55 @@
+package allocator
+
+import (
+	"github.com/FoundationDB/fdb-go/fdb"
+	"github.com/abdullin/go-layers/internal/fdbtest"
+	"sync"
+	"testing"
+)
+
+func TestAllocateUnique(t *testing.T) {
+	db, sub := fdbtest.Open(t)
+	a := New(sub)
+
+	// enough allocations to move through the first windows
+	const workers, allocations = 10, 100
+	results := make([][]int64, workers)
+	errs := make([]error, workers)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < allocations; i++ {
+				v, err := db.Transact(func(tr fdb.Transaction) (interface{}, error) {
+					return a.Allocate(tr)
+				})
+				if err != nil {
+					errs[w] = err
+					return
+				}
+				results[w] = append(results[w], v.(int64))
+			}
+		}(w)
+	}
+	wg.Wait()
+
+	seen := map[int64]bool{}
+	for w := range results {
+		if errs[w] != nil {
+			t.Fatal(errs[w])
+		}
+		for _, n := range results[w] {
+			if seen[n] {
+				t.Fatalf("%d allocated twice", n)
+			}
+			if n < 0 {
+				t.Fatalf("allocated %d", n)
+			}
+			seen[n] = true
+		}
+	}
+	if len(seen) != workers*allocations {
+		t.Fatalf("allocated %d integers, want %d", len(seen), workers*allocations)
+	}
+}
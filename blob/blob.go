@@ -0,0 +1,289 @@
+/*
+Package blob provides a large object class. It is a part of FoundationDb
+layer.
+
+A blob is stored as chunks of up to 90KB under a generation picked for
+every write, followed by a manifest pointing at the generation:
+
+	(id, "m")             -> (generation, size, chunk count, sha256)
+	(id, "c", gen, index) -> crc32 (4 bytes) | chunk
+
+Chunks are written over as many transactions as the blob needs, and the
+manifest is written last, replacing the previous generation at once, so
+readers never see a partly written blob. A write that fails or is
+cancelled clears the chunks it wrote; those of a writer that dies midway
+stay behind unread until the blob is deleted.
+
+This code is a port from official python layer
+*/
+
+package blob
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"github.com/FoundationDB/fdb-go/fdb"
+	"github.com/FoundationDB/fdb-go/fdb/subspace"
+	"github.com/FoundationDB/fdb-go/fdb/tuple"
+	"hash/crc32"
+	"io"
+)
+
+// ChunkSize is the size of every chunk but the last
+const ChunkSize = 90000
+
+// chunksPerTransaction keeps transactions well below the size limit
+const chunksPerTransaction = 10
+
+var (
+	ErrNotFound = errors.New("blob not found")
+	ErrChecksum = errors.New("blob checksum mismatch")
+	// ErrChanged is returned when a blob is rewritten or deleted while it
+	// is read
+	ErrChanged = errors.New("blob changed while reading")
+)
+
+type Blob struct {
+	Subspace subspace.Subspace
+}
+
+// New blob store is created within a given subspace
+func New(sub subspace.Subspace) Blob {
+	return Blob{sub}
+}
+
+type manifest struct {
+	gen    []byte
+	size   int64
+	chunks int64
+	sum    []byte
+}
+
+func (b *Blob) manifestKey(id string) fdb.Key {
+	return b.Subspace.Pack(tuple.Tuple{id, "m"})
+}
+
+func (b *Blob) chunkKey(id string, gen []byte, index int64) fdb.Key {
+	return b.Subspace.Pack(tuple.Tuple{id, "c", gen, index})
+}
+
+func (b *Blob) readManifest(tr fdb.Transaction, id string) (manifest, error) {
+	val := tr.Get(b.manifestKey(id)).GetOrPanic()
+	if val == nil {
+		return manifest{}, ErrNotFound
+	}
+	t, err := tuple.Unpack(val)
+	if err != nil {
+		return manifest{}, err
+	}
+	return manifest{t[0].([]byte), t[1].(int64), t[2].(int64), t[3].([]byte)}, nil
+}
+
+// Write stores the content of r under the id, replacing the blob stored
+// there once all of it is written
+func (b *Blob) Write(ctx context.Context, db fdb.Database, id string, r io.Reader) error {
+	gen := make([]byte, 8)
+	if _, err := rand.Read(gen); err != nil {
+		return err
+	}
+	err := b.write(ctx, db, id, gen, r)
+	if err != nil {
+		// the manifest may have committed with an unknown result, so
+		// the chunks are only cleared if it doesn't point at them
+		db.Transact(func(tr fdb.Transaction) (interface{}, error) {
+			if m, err := b.readManifest(tr, id); err == nil && bytes.Equal(m.gen, gen) {
+				return nil, nil
+			}
+			tr.ClearRange(b.Subspace.Sub(id, "c", gen))
+			return nil, nil
+		})
+	}
+	return err
+}
+
+func (b *Blob) write(ctx context.Context, db fdb.Database, id string, gen []byte, r io.Reader) error {
+	hash := sha256.New()
+	size, index := int64(0), int64(0)
+	done := false
+	for !done {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		var chunks [][]byte
+		for len(chunks) < chunksPerTransaction {
+			chunk := make([]byte, ChunkSize)
+			n, err := io.ReadFull(r, chunk)
+			if n > 0 {
+				chunks = append(chunks, chunk[:n])
+			}
+			if err == io.EOF || err == io.ErrUnexpectedEOF {
+				done = true
+				break
+			}
+			if err != nil {
+				return err
+			}
+		}
+
+		_, err := db.Transact(func(tr fdb.Transaction) (interface{}, error) {
+			for i, chunk := range chunks {
+				val := make([]byte, 4, 4+len(chunk))
+				binary.BigEndian.PutUint32(val, crc32.ChecksumIEEE(chunk))
+				tr.Set(b.chunkKey(id, gen, index+int64(i)), append(val, chunk...))
+			}
+			return nil, nil
+		})
+		if err != nil {
+			return err
+		}
+		for _, chunk := range chunks {
+			hash.Write(chunk)
+			size += int64(len(chunk))
+		}
+		index += int64(len(chunks))
+	}
+
+	_, err := db.Transact(func(tr fdb.Transaction) (interface{}, error) {
+		if old, err := b.readManifest(tr, id); err == nil {
+			tr.ClearRange(b.Subspace.Sub(id, "c", old.gen))
+		} else if err != ErrNotFound {
+			return nil, err
+		}
+		tr.Set(b.manifestKey(id), tuple.Tuple{gen, size, index, hash.Sum(nil)}.Pack())
+		return nil, nil
+	})
+	return err
+}
+
+// Read writes the blob to w, verifying every chunk as it goes and the
+// whole blob at the end. A checksum failure at the end is reported after
+// the content was written to w.
+func (b *Blob) Read(ctx context.Context, db fdb.Database, id string, w io.Writer) error {
+	m, err := b.manifest(db, id)
+	if err != nil {
+		return err
+	}
+
+	hash := sha256.New()
+	for index := int64(0); index < m.chunks; index += chunksPerTransaction {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		chunks, err := b.readChunks(db, id, m, index, chunksPerTransaction)
+		if err != nil {
+			return err
+		}
+		for _, chunk := range chunks {
+			hash.Write(chunk)
+			if _, err := w.Write(chunk); err != nil {
+				return err
+			}
+		}
+	}
+	if !bytes.Equal(hash.Sum(nil), m.sum) {
+		return ErrChecksum
+	}
+	return nil
+}
+
+// ReadAt reads len(p) bytes of the blob starting at off, verifying the
+// chunks read. Like io.ReaderAt it fails with io.EOF when fewer bytes are
+// left.
+func (b *Blob) ReadAt(ctx context.Context, db fdb.Database, id string, p []byte, off int64) (int, error) {
+	m, err := b.manifest(db, id)
+	if err != nil {
+		return 0, err
+	}
+	if off < 0 || off >= m.size {
+		return 0, io.EOF
+	}
+
+	n := 0
+	for n < len(p) && off < m.size {
+		if err := ctx.Err(); err != nil {
+			return n, err
+		}
+		index := off / ChunkSize
+		chunks, err := b.readChunks(db, id, m, index, chunksPerTransaction)
+		if err != nil {
+			return n, err
+		}
+		skip := off - index*ChunkSize
+		for _, chunk := range chunks {
+			copied := copy(p[n:], chunk[skip:])
+			n += copied
+			off += int64(copied)
+			skip = 0
+		}
+	}
+	if n < len(p) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+// Size returns the size of the blob in bytes
+func (b *Blob) Size(db fdb.Database, id string) (int64, error) {
+	m, err := b.manifest(db, id)
+	return m.size, err
+}
+
+// Delete removes the blob
+func (b *Blob) Delete(db fdb.Database, id string) error {
+	_, err := db.Transact(func(tr fdb.Transaction) (interface{}, error) {
+		tr.ClearRange(b.Subspace.Sub(id))
+		return nil, nil
+	})
+	return err
+}
+
+func (b *Blob) manifest(db fdb.Database, id string) (manifest, error) {
+	v, err := db.Transact(func(tr fdb.Transaction) (interface{}, error) {
+		return b.readManifest(tr, id)
+	})
+	if err != nil {
+		return manifest{}, err
+	}
+	return v.(manifest), nil
+}
+
+// readChunks reads up to limit verified chunks of the generation of the
+// manifest, starting with the index
+func (b *Blob) readChunks(db fdb.Database, id string, m manifest, index int64, limit int) ([][]byte, error) {
+	v, err := db.Transact(func(tr fdb.Transaction) (interface{}, error) {
+		current, err := b.readManifest(tr, id)
+		if err == ErrNotFound || (err == nil && !bytes.Equal(current.gen, m.gen)) {
+			return nil, ErrChanged
+		} else if err != nil {
+			return nil, err
+		}
+
+		end := index + int64(limit)
+		if end > m.chunks {
+			end = m.chunks
+		}
+		r := fdb.KeyRange{Begin: b.chunkKey(id, m.gen, index), End: b.chunkKey(id, m.gen, end)}
+		kvs := tr.GetRange(r, fdb.RangeOptions{}).GetSliceOrPanic()
+		if int64(len(kvs)) != end-index {
+			return nil, ErrChanged
+		}
+
+		chunks := make([][]byte, len(kvs))
+		for i, kv := range kvs {
+			if len(kv.Value) < 4 || binary.BigEndian.Uint32(kv.Value) != crc32.ChecksumIEEE(kv.Value[4:]) {
+				return nil, ErrChecksum
+			}
+			chunks[i] = kv.Value[4:]
+		}
+		return chunks, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return v.([][]byte), nil
+}
@@ -0,0 +1,216 @@
+package blob
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"github.com/FoundationDB/fdb-go/fdb"
+	"github.com/abdullin/go-layers/internal/fdbtest"
+	"hash/crc32"
+	"io"
+	"math/rand"
+	"testing"
+)
+
+func content(size int) []byte {
+	b := make([]byte, size)
+	rand.Read(b)
+	return b
+}
+
+// chunkKeys returns the chunk keys stored for the id, of any generation
+func chunkKeys(t *testing.T, db fdb.Database, b Blob, id string) []fdb.KeyValue {
+	t.Helper()
+	v, err := db.Transact(func(tr fdb.Transaction) (interface{}, error) {
+		return tr.GetRange(b.Subspace.Sub(id, "c"), fdb.RangeOptions{}).GetSliceWithError()
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return v.([]fdb.KeyValue)
+}
+
+func TestWriteRead(t *testing.T) {
+	db, sub := fdbtest.Open(t)
+	b := New(sub)
+	ctx := context.Background()
+
+	// empty, one full chunk, a byte into the second, and more chunks than
+	// one transaction writes
+	for _, size := range []int{0, ChunkSize, ChunkSize + 1, (chunksPerTransaction+2)*ChunkSize + 5} {
+		data := content(size)
+		if err := b.Write(ctx, db, "id", bytes.NewReader(data)); err != nil {
+			t.Fatal(err)
+		}
+		var buf bytes.Buffer
+		if err := b.Read(ctx, db, "id", &buf); err != nil {
+			t.Fatalf("read %d bytes: %v", size, err)
+		}
+		if !bytes.Equal(buf.Bytes(), data) {
+			t.Fatalf("wrote %d bytes, read %d different ones", size, buf.Len())
+		}
+		if n, err := b.Size(db, "id"); err != nil || n != int64(size) {
+			t.Fatalf("size %d, %v, want %d", n, err, size)
+		}
+		// the previous generation is gone
+		want := (size + ChunkSize - 1) / ChunkSize
+		if n := len(chunkKeys(t, db, b, "id")); n != want {
+			t.Fatalf("%d chunks stored for %d bytes, want %d", n, size, want)
+		}
+	}
+
+	if err := b.Delete(db, "id"); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.Read(ctx, db, "id", io.Discard); err != ErrNotFound {
+		t.Fatalf("read after delete: %v", err)
+	}
+	if n := len(chunkKeys(t, db, b, "id")); n != 0 {
+		t.Fatalf("%d chunks left after delete", n)
+	}
+}
+
+func TestReadAt(t *testing.T) {
+	db, sub := fdbtest.Open(t)
+	b := New(sub)
+	ctx := context.Background()
+
+	data := content((chunksPerTransaction+1)*ChunkSize + 100)
+	if err := b.Write(ctx, db, "id", bytes.NewReader(data)); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, r := range []struct {
+		off int64
+		n   int
+	}{
+		{0, 10},
+		{ChunkSize - 10, 20},                  // across a chunk edge
+		{ChunkSize, ChunkSize},                // exactly the second chunk
+		{5, chunksPerTransaction * ChunkSize}, // across transactions
+	} {
+		p := make([]byte, r.n)
+		n, err := b.ReadAt(ctx, db, "id", p, r.off)
+		if err != nil || n != r.n {
+			t.Fatalf("read %d at %d: %d, %v", r.n, r.off, n, err)
+		}
+		if !bytes.Equal(p, data[r.off:r.off+int64(r.n)]) {
+			t.Fatalf("read %d at %d differs", r.n, r.off)
+		}
+	}
+
+	// short reads at the end fail like io.ReaderAt
+	p := make([]byte, 200)
+	off := int64(len(data) - 50)
+	if n, err := b.ReadAt(ctx, db, "id", p, off); n != 50 || err != io.EOF || !bytes.Equal(p[:n], data[off:]) {
+		t.Fatalf("read past the end: %d, %v", n, err)
+	}
+	if n, err := b.ReadAt(ctx, db, "id", p, int64(len(data))); n != 0 || err != io.EOF {
+		t.Fatalf("read at the end: %d, %v", n, err)
+	}
+	if n, err := b.ReadAt(ctx, db, "id", p, -1); n != 0 || err != io.EOF {
+		t.Fatalf("read at a negative offset: %d, %v", n, err)
+	}
+}
+
+func TestChecksum(t *testing.T) {
+	db, sub := fdbtest.Open(t)
+	b := New(sub)
+	ctx := context.Background()
+
+	data := content(3 * ChunkSize)
+	if err := b.Write(ctx, db, "id", bytes.NewReader(data)); err != nil {
+		t.Fatal(err)
+	}
+	corrupt := func(fixCRC bool) {
+		kv := chunkKeys(t, db, b, "id")[1]
+		val := append([]byte(nil), kv.Value...)
+		val[10] ^= 0xff
+		if fixCRC {
+			binary.BigEndian.PutUint32(val, crc32.ChecksumIEEE(val[4:]))
+		}
+		_, err := db.Transact(func(tr fdb.Transaction) (interface{}, error) {
+			tr.Set(kv.Key, val)
+			return nil, nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// a chunk that doesn't match its own checksum
+	corrupt(false)
+	if err := b.Read(ctx, db, "id", io.Discard); err != ErrChecksum {
+		t.Fatalf("read a corrupt chunk: %v", err)
+	}
+	if _, err := b.ReadAt(ctx, db, "id", make([]byte, 10), ChunkSize); err != ErrChecksum {
+		t.Fatalf("read at a corrupt chunk: %v", err)
+	}
+
+	// flipped back, then again with a matching checksum: the chunks check
+	// out, but not the blob
+	corrupt(false)
+	corrupt(true)
+	if err := b.Read(ctx, db, "id", io.Discard); err != ErrChecksum {
+		t.Fatalf("read a corrupt blob: %v", err)
+	}
+}
+
+// failingReader returns the content, then fails
+type failingReader struct {
+	r    io.Reader
+	err  error
+	read func(n int)
+}
+
+func (f *failingReader) Read(p []byte) (int, error) {
+	n, err := f.r.Read(p)
+	if f.read != nil {
+		f.read(n)
+	}
+	if err == io.EOF {
+		return n, f.err
+	}
+	return n, err
+}
+
+func TestWriteFailure(t *testing.T) {
+	db, sub := fdbtest.Open(t)
+	b := New(sub)
+	ctx := context.Background()
+
+	old := content(ChunkSize + 1)
+	if err := b.Write(ctx, db, "id", bytes.NewReader(old)); err != nil {
+		t.Fatal(err)
+	}
+	oldChunks := len(chunkKeys(t, db, b, "id"))
+
+	// a reader failing after more chunks than one transaction holds
+	errRead := errors.New("read failed")
+	data := content((chunksPerTransaction + 1) * ChunkSize)
+	if err := b.Write(ctx, db, "id", &failingReader{r: bytes.NewReader(data), err: errRead}); err != errRead {
+		t.Fatalf("write from a failing reader: %v", err)
+	}
+
+	// cancelled once the first transaction of chunks is read
+	cctx, cancel := context.WithCancel(ctx)
+	read := 0
+	r := &failingReader{r: bytes.NewReader(data), err: io.EOF, read: func(n int) {
+		if read += n; read >= chunksPerTransaction*ChunkSize {
+			cancel()
+		}
+	}}
+	if err := b.Write(cctx, db, "id", r); err != context.Canceled {
+		t.Fatalf("cancelled write: %v", err)
+	}
+
+	// only the chunks of the blob written first are left, and it reads
+	if n := len(chunkKeys(t, db, b, "id")); n != oldChunks {
+		t.Fatalf("%d chunks stored after failed writes, want %d", n, oldChunks)
+	}
+	var buf bytes.Buffer
+	if err := b.Read(ctx, db, "id", &buf); err != nil || !bytes.Equal(buf.Bytes(), old) {
+		t.Fatalf("read the blob after failed writes: %v", err)
+	}
+}
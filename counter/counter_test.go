@@ -0,0 +1,72 @@
+package counter
+
+import (
+	"github.com/FoundationDB/fdb-go/fdb"
+	"github.com/abdullin/go-layers/internal/fdbtest"
+	"sync"
+	"testing"
+)
+
+func TestExactSum(t *testing.T) {
+	db, sub := fdbtest.Open(t)
+	c := New(sub)
+
+	// adders and coalescers run concurrently; no delta may be lost or
+	// counted twice
+	const workers, adds = 8, 200
+	errs := make(chan error, 2*workers)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(2)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < adds; i++ {
+				if _, err := db.Transact(func(tr fdb.Transaction) (interface{}, error) {
+					c.Add(tr, int64(w+1))
+					return nil, nil
+				}); err != nil {
+					errs <- err
+					return
+				}
+			}
+		}(w)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < adds/10; i++ {
+				if err := c.Coalesce(db, 20); err != nil {
+					errs <- err
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Fatal(err)
+	}
+
+	want := int64(adds * workers * (workers + 1) / 2)
+	v, err := db.Transact(func(tr fdb.Transaction) (interface{}, error) {
+		return []int64{c.Get(tr), c.GetSnapshot(tr)}, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := v.([]int64); got[0] != want || got[1] != want {
+		t.Fatalf("counted %d and %d with a snapshot, want %d", got[0], got[1], want)
+	}
+
+	// coalescing everything leaves the sum in one delta
+	for i := 0; i < 10; i++ {
+		if err := c.Coalesce(db, 100000); err != nil {
+			t.Fatal(err)
+		}
+	}
+	v, err = db.Transact(func(tr fdb.Transaction) (interface{}, error) {
+		return c.Get(tr), nil
+	})
+	if err != nil || v.(int64) != want {
+		t.Fatalf("counted %v after coalescing, %v", v, err)
+	}
+}
@@ -0,0 +1,419 @@
+/*
+Package document provides a document class. It is a part of FoundationDb
+layer.
+
+Documents are JSON-like values: maps with string keys, arrays, strings,
+numbers, bools, nulls and byte strings. A document is flattened into one
+key per leaf, keyed by the path to it, so a field is a point read and
+updating it needs no rewrite of the document:
+
+	(docID)          -> 'o'
+	(docID, path...) -> 's' | tuple (value)
+	(docID, path...) -> 'o' or 'a', for an empty map or array
+
+Map fields are string path elements and array items int elements. An
+update may set an array item up to the length of the array, one past the
+end appending to it. Deleting an array item sets it to null, so the
+indexes of the others don't shift; deleting the last field of a map leaves
+an empty map.
+*/
+
+package document
+
+import (
+	"errors"
+	"github.com/FoundationDB/fdb-go/fdb"
+	"github.com/FoundationDB/fdb-go/fdb/subspace"
+	"github.com/FoundationDB/fdb-go/fdb/tuple"
+)
+
+// MaxDocumentBytes is the largest flattened size of a document, leaving
+// room below the transaction size limit for other writes
+const MaxDocumentBytes = 5000000
+
+// maxValueBytes is the largest value of a single leaf
+const maxValueBytes = 100000
+
+const (
+	tagScalar = 's'
+	tagObject = 'o'
+	tagArray  = 'a'
+)
+
+var (
+	ErrNotFound     = errors.New("document or field not found")
+	ErrTooLarge     = errors.New("document exceeds transaction limits")
+	ErrUnsupported  = errors.New("unsupported document value")
+	ErrTypeMismatch = errors.New("path does not match the document structure")
+	ErrOutOfRange   = errors.New("array index past the end of the array")
+)
+
+type Documents struct {
+	Subspace subspace.Subspace
+}
+
+// New document store is created within a given subspace
+func New(sub subspace.Subspace) Documents {
+	return Documents{sub}
+}
+
+func (d *Documents) key(docID string, path tuple.Tuple) fdb.Key {
+	return d.Subspace.Pack(append(tuple.Tuple{docID}, path...))
+}
+
+// subtree is the range of the value at the path, including its own key
+func (d *Documents) subtree(docID string, path tuple.Tuple) fdb.KeyRange {
+	_, end := d.Subspace.Sub(append(tuple.Tuple{docID}, path...)...).FDBRangeKeys()
+	return fdb.KeyRange{Begin: d.key(docID, path), End: end}
+}
+
+// normalize checks the path elements, turning ints into int64
+func normalize(path []interface{}) (tuple.Tuple, error) {
+	t := make(tuple.Tuple, len(path))
+	for i, e := range path {
+		switch e := e.(type) {
+		case string:
+			t[i] = e
+		case int:
+			t[i] = int64(e)
+		case int64:
+			t[i] = e
+		default:
+			return nil, ErrUnsupported
+		}
+		if n, ok := t[i].(int64); ok && n < 0 {
+			return nil, ErrUnsupported
+		}
+	}
+	return t, nil
+}
+
+// flatten appends the keys and values of the value at the path
+func (d *Documents) flatten(docID string, path tuple.Tuple, value interface{}, kvs []fdb.KeyValue) ([]fdb.KeyValue, error) {
+	sub := func(e tuple.TupleElement) tuple.Tuple {
+		return append(append(tuple.Tuple{}, path...), e)
+	}
+
+	var val []byte
+	switch v := value.(type) {
+	case map[string]interface{}:
+		if len(v) > 0 || len(path) == 0 {
+			var err error
+			for name, child := range v {
+				if kvs, err = d.flatten(docID, sub(name), child, kvs); err != nil {
+					return nil, err
+				}
+			}
+			if len(path) > 0 {
+				return kvs, nil
+			}
+		}
+		val = []byte{tagObject}
+	case []interface{}:
+		if len(v) > 0 {
+			var err error
+			for i, child := range v {
+				if kvs, err = d.flatten(docID, sub(int64(i)), child, kvs); err != nil {
+					return nil, err
+				}
+			}
+			return kvs, nil
+		}
+		val = []byte{tagArray}
+	case int:
+		val = encodeScalar(int64(v))
+	case nil, string, []byte, int64, float64, bool:
+		val = encodeScalar(v)
+	default:
+		return nil, ErrUnsupported
+	}
+
+	if len(val) > maxValueBytes {
+		return nil, ErrTooLarge
+	}
+	return append(kvs, fdb.KeyValue{Key: d.key(docID, path), Value: val}), nil
+}
+
+func encodeScalar(v tuple.TupleElement) []byte {
+	return append([]byte{tagScalar}, tuple.Tuple{v}.Pack()...)
+}
+
+// write sets flattened keys unless they exceed the size limit
+func write(tr fdb.Transaction, kvs []fdb.KeyValue) error {
+	size := 0
+	for _, kv := range kvs {
+		size += len(kv.Key) + len(kv.Value)
+	}
+	if size > MaxDocumentBytes {
+		return ErrTooLarge
+	}
+	for _, kv := range kvs {
+		tr.Set(kv.Key, kv.Value)
+	}
+	return nil
+}
+
+// Put stores the document, replacing the previous one with the id
+func (d *Documents) Put(tr fdb.Transaction, docID string, value map[string]interface{}) error {
+	if value == nil {
+		value = map[string]interface{}{}
+	}
+	kvs, err := d.flatten(docID, nil, value, nil)
+	if err != nil {
+		return err
+	}
+	tr.ClearRange(d.subtree(docID, nil))
+	return write(tr, kvs)
+}
+
+// Get returns the whole document
+func (d *Documents) Get(tr fdb.Transaction, docID string) (map[string]interface{}, error) {
+	v, err := d.GetField(tr, docID)
+	if err != nil {
+		return nil, err
+	}
+	return v.(map[string]interface{}), nil
+}
+
+// GetField returns the value at the path. Leaves are read with a point
+// read, maps and arrays are assembled from a range read.
+func (d *Documents) GetField(tr fdb.Transaction, docID string, path ...interface{}) (interface{}, error) {
+	p, err := normalize(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if val := tr.Get(d.key(docID, p)).GetOrPanic(); len(val) > 0 && (val[0] == tagScalar || len(p) > 0) {
+		return decodeLeaf(val)
+	}
+
+	root := &node{}
+	found := false
+	for _, kv := range tr.GetRange(d.subtree(docID, p), fdb.RangeOptions{}).GetSliceOrPanic() {
+		t, err := d.Subspace.Unpack(kv.Key)
+		if err != nil {
+			return nil, err
+		}
+		leaf, err := decodeLeaf(kv.Value)
+		if err != nil {
+			return nil, err
+		}
+		root.insert(t[1+len(p):], leaf)
+		found = true
+	}
+	if !found {
+		return nil, ErrNotFound
+	}
+	return root.value(), nil
+}
+
+// Update replaces the value at the path, creating the maps and arrays
+// on the way to it. Everything else in the document is left as it is.
+// Array indexes past the length of their array return ErrOutOfRange.
+func (d *Documents) Update(tr fdb.Transaction, docID string, value interface{}, path ...interface{}) error {
+	p, err := normalize(path)
+	if err != nil {
+		return err
+	}
+	if len(p) == 0 {
+		m, ok := value.(map[string]interface{})
+		if !ok {
+			return ErrTypeMismatch
+		}
+		return d.Put(tr, docID, m)
+	}
+	if err := d.prepare(tr, docID, p); err != nil {
+		return err
+	}
+
+	kvs, err := d.flatten(docID, p, value, nil)
+	if err != nil {
+		return err
+	}
+	tr.ClearRange(d.subtree(docID, p))
+	return write(tr, kvs)
+}
+
+// Delete removes the value at the path
+func (d *Documents) Delete(tr fdb.Transaction, docID string, path ...interface{}) error {
+	p, err := normalize(path)
+	if err != nil {
+		return err
+	}
+	if len(p) == 0 {
+		tr.ClearRange(d.subtree(docID, nil))
+		return nil
+	}
+
+	if tr.Get(d.key(docID, nil)).GetOrPanic() == nil {
+		return ErrNotFound
+	}
+	if tr.Get(d.key(docID, p)).GetOrPanic() == nil && !d.hasChildren(tr, docID, p) {
+		return ErrNotFound
+	}
+
+	tr.ClearRange(d.subtree(docID, p))
+	parent := p[:len(p)-1]
+	if _, ok := p[len(p)-1].(int64); ok {
+		tr.Set(d.key(docID, p), encodeScalar(nil))
+	} else if len(parent) > 0 && !d.hasChildren(tr, docID, parent) {
+		tr.Set(d.key(docID, parent), []byte{tagObject})
+	}
+	return nil
+}
+
+// prepare makes room for a value at the path: the document is created if
+// missing, leaves and empty markers on the way are cleared, and every map
+// or array on the way must match the kind of the path element. Array
+// indexes may not be past the length of their array, so a path can't
+// make a reader allocate more items than were written.
+func (d *Documents) prepare(tr fdb.Transaction, docID string, path tuple.Tuple) error {
+	if tr.Get(d.key(docID, nil)).GetOrPanic() == nil {
+		tr.Set(d.key(docID, nil), []byte{tagObject})
+	}
+
+	for i := range path {
+		parent := path[:i]
+		index, wantArray := path[i].(int64)
+		if i == 0 && wantArray {
+			return ErrTypeMismatch
+		}
+
+		if i > 0 {
+			val := tr.Get(d.key(docID, parent)).GetOrPanic()
+			if len(val) > 0 && val[0] != tagScalar && (val[0] == tagArray) != wantArray {
+				return ErrTypeMismatch
+			}
+			if val != nil {
+				// the array is new or empty
+				if wantArray && index > 0 {
+					return ErrOutOfRange
+				}
+				tr.Clear(d.key(docID, parent))
+				continue
+			}
+		}
+
+		key, ok := d.firstChild(tr, docID, parent)
+		if !ok {
+			if wantArray && index > 0 {
+				return ErrOutOfRange
+			}
+			continue
+		}
+		t, err := d.Subspace.Unpack(key)
+		if err != nil {
+			return err
+		}
+		if _, isArray := t[1+i].(int64); isArray != wantArray {
+			return ErrTypeMismatch
+		}
+		if wantArray {
+			if t, err = d.Subspace.Unpack(d.lastChild(tr, docID, parent)); err != nil {
+				return err
+			}
+			if last, _ := t[1+i].(int64); index > last+1 {
+				return ErrOutOfRange
+			}
+		}
+	}
+	return nil
+}
+
+func (d *Documents) hasChildren(tr fdb.Transaction, docID string, path tuple.Tuple) bool {
+	_, ok := d.firstChild(tr, docID, path)
+	return ok
+}
+
+// firstChild returns the first key below the path
+func (d *Documents) firstChild(tr fdb.Transaction, docID string, path tuple.Tuple) (fdb.Key, bool) {
+	key := tr.GetKey(fdb.FirstGreaterThan(d.key(docID, path))).GetOrPanic()
+	return key, d.Subspace.Sub(append(tuple.Tuple{docID}, path...)...).Contains(key)
+}
+
+// lastChild returns the last key below the path, which has to have
+// children
+func (d *Documents) lastChild(tr fdb.Transaction, docID string, path tuple.Tuple) fdb.Key {
+	_, end := d.Subspace.Sub(append(tuple.Tuple{docID}, path...)...).FDBRangeKeys()
+	return tr.GetKey(fdb.LastLessThan(end)).GetOrPanic()
+}
+
+func decodeLeaf(val []byte) (interface{}, error) {
+	if len(val) == 0 {
+		return nil, ErrUnsupported
+	}
+	switch val[0] {
+	case tagObject:
+		return map[string]interface{}{}, nil
+	case tagArray:
+		return []interface{}{}, nil
+	case tagScalar:
+		t, err := tuple.Unpack(val[1:])
+		if err != nil || len(t) != 1 {
+			return nil, ErrUnsupported
+		}
+		return t[0], nil
+	}
+	return nil, ErrUnsupported
+}
+
+// node is a part of a document being assembled from its leaves
+type node struct {
+	leaf   interface{}
+	fields map[string]*node
+	items  map[int64]*node
+}
+
+func (n *node) insert(path tuple.Tuple, leaf interface{}) {
+	if len(path) == 0 {
+		n.leaf = leaf
+		return
+	}
+
+	var child *node
+	switch e := path[0].(type) {
+	case string:
+		if n.fields == nil {
+			n.fields = make(map[string]*node)
+		}
+		if child = n.fields[e]; child == nil {
+			child = &node{}
+			n.fields[e] = child
+		}
+	case int64:
+		if n.items == nil {
+			n.items = make(map[int64]*node)
+		}
+		if child = n.items[e]; child == nil {
+			child = &node{}
+			n.items[e] = child
+		}
+	default:
+		return
+	}
+	child.insert(path[1:], leaf)
+}
+
+func (n *node) value() interface{} {
+	switch {
+	case n.fields != nil:
+		m := make(map[string]interface{}, len(n.fields))
+		for name, child := range n.fields {
+			m[name] = child.value()
+		}
+		return m
+	case n.items != nil:
+		size := int64(0)
+		for i := range n.items {
+			if i >= size {
+				size = i + 1
+			}
+		}
+		a := make([]interface{}, size)
+		for i, child := range n.items {
+			a[i] = child.value()
+		}
+		return a
+	}
+	return n.leaf
+}
@@ -0,0 +1,51 @@
+package document
+
+import (
+	"github.com/FoundationDB/fdb-go/fdb"
+	"github.com/abdullin/go-layers/internal/fdbtest"
+	"reflect"
+	"testing"
+)
+
+func TestUpdateArrayIndex(t *testing.T) {
+	db, sub := fdbtest.Open(t)
+	d := New(sub)
+
+	doc := map[string]interface{}{"a": []interface{}{"x", "y"}, "e": []interface{}{}}
+	v, err := db.Transact(func(tr fdb.Transaction) (interface{}, error) {
+		if err := d.Put(tr, "doc", doc); err != nil {
+			return nil, err
+		}
+		// one past the end appends
+		if err := d.Update(tr, "doc", "z", "a", 2); err != nil {
+			return nil, err
+		}
+		if err := d.Update(tr, "doc", "first", "e", 0); err != nil {
+			return nil, err
+		}
+		if err := d.Update(tr, "doc", "new", "n", 0); err != nil {
+			return nil, err
+		}
+		return d.Get(tr, "doc")
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]interface{}{
+		"a": []interface{}{"x", "y", "z"},
+		"e": []interface{}{"first"},
+		"n": []interface{}{"new"},
+	}
+	if !reflect.DeepEqual(v, want) {
+		t.Fatalf("document %v, want %v", v, want)
+	}
+
+	for _, path := range [][]interface{}{{"a", 4}, {"a", int64(1) << 40}, {"e", 2}, {"m", 1}} {
+		_, err := db.Transact(func(tr fdb.Transaction) (interface{}, error) {
+			return nil, d.Update(tr, "doc", "v", path...)
+		})
+		if err != ErrOutOfRange {
+			t.Fatalf("update of %v returned %v", path, err)
+		}
+	}
+}
@@ -0,0 +1,293 @@
+package eventstore
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"github.com/FoundationDB/fdb-go/fdb"
+	"github.com/FoundationDB/fdb-go/fdb/tuple"
+	"strings"
+	"time"
+)
+
+// Position of an event in the global space: the versionstamp of the
+// transaction that appended it followed by its stream and version.
+// Methods named After read the events strictly after a position, those
+// named From include the event at it; ReadAll and subscriptions read
+// after.
+type Position []byte
+
+// StartPosition is before the first event of the global space
+var StartPosition Position
+
+// EndPosition stands for the latest event of the global space at the
+// time of a read, to only get events appended from then on
+var EndPosition = Position{0xff}
+
+// Next returns the position right after p, so reading from it is reading
+// after p
+func (p Position) Next() Position {
+	return Position(concat(p, []byte{0x00}))
+}
+
+// stampLen is the size of a versionstamp assigned at commit
+const stampLen = 10
+
+var errBadGlobalKey = errors.New("malformed global key")
+
+// decodeGlobal decodes an event of the global space
+func (es *EventStore) decodeGlobal(tr fdb.Transaction, kv fdb.KeyValue) (storedEvent, error) {
+	pos := Position(kv.Key[len(es.global.Bytes()):])
+	if len(pos) < stampLen {
+		if _, _, ok := es.parseLegacy(kv.Key); ok {
+			return storedEvent{}, ErrLegacyLayout
+		}
+		return storedEvent{}, errBadGlobalKey
+	}
+	t, err := tuple.Unpack(pos[stampLen:])
+	if err != nil || len(t) != 2 {
+		if _, _, ok := es.parseLegacy(kv.Key); ok {
+			return storedEvent{}, ErrLegacyLayout
+		}
+		return storedEvent{}, errBadGlobalKey
+	}
+	stream, ok1 := t[0].(string)
+	version, ok2 := t[1].(int64)
+	if !ok1 || !ok2 {
+		return storedEvent{}, errBadGlobalKey
+	}
+
+	env, err := es.openEnvelope(tr, kv.Value, stream)
+	if err != nil {
+		return storedEvent{}, err
+	}
+	evt := env.recorded(stream, version)
+	evt.GlobalPosition = pos
+	return storedEvent{evt, 1, len(kv.Key) + len(kv.Value)}, nil
+}
+
+// Positions returns the global positions of events appended with AppendTr
+// once the transaction has committed. stamp is tr.GetVersionstamp()
+// requested before commit.
+func Positions(stamp fdb.FutureKey, stream string, versions []int64) ([]Position, error) {
+	s, err := stamp.GetWithError()
+	if err != nil {
+		return nil, err
+	}
+
+	positions := make([]Position, len(versions))
+	for i, v := range versions {
+		positions[i] = Position(concat(s, tuple.Tuple{stream, v}.Pack()))
+	}
+	return positions, nil
+}
+
+// Filter selects events read from the global space. Empty fields match
+// everything except metadata streams.
+type Filter struct {
+	Contracts    []string
+	StreamPrefix string
+	// IncludeMetadata also matches events of metadata streams
+	IncludeMetadata bool
+}
+
+func (f Filter) matches(stream, contract string) bool {
+	if !f.IncludeMetadata && isMetadataStream(stream) {
+		return false
+	}
+	if !strings.HasPrefix(stream, f.StreamPrefix) {
+		return false
+	}
+	if len(f.Contracts) == 0 {
+		return true
+	}
+	for _, c := range f.Contracts {
+		if c == contract {
+			return true
+		}
+	}
+	return false
+}
+
+// allScanLimit caps the number of events a single ReadAll inspects, so a
+// selective filter can't turn one call into a full scan
+const allScanLimit = 10000
+
+// ReadAll returns up to limit events after the position that match the
+// filter, and the position to continue from. The position advances past
+// skipped events too, so it is safe to checkpoint even when no events
+// were returned. A position older than the store retention fails with
+// *ErrTruncated.
+func (es *EventStore) ReadAll(db fdb.Database, from Position, limit int, filter Filter) ([]RecordedEvent, Position, error) {
+	var next Position
+	v, err := db.Transact(func(tr fdb.Transaction) (interface{}, error) {
+		var events []RecordedEvent
+		var err error
+		events, next, err = es.readAll(tr, from, limit, filter)
+		return events, err
+	})
+	if err != nil {
+		return nil, from, err
+	}
+	return v.([]RecordedEvent), next, nil
+}
+
+// ReadAllAfter returns up to limit events of all streams but metadata
+// streams that come strictly after the position, and the position of the
+// last of them to pass as after to the next call. next equals after when
+// there is nothing new.
+//
+// Positions start with the commit versionstamp, so a transaction that
+// commits later always sorts after everything visible to an earlier
+// read. Calling ReadAllAfter repeatedly with the returned next therefore
+// yields every event exactly once and in order while appends go on.
+func (es *EventStore) ReadAllAfter(db fdb.Database, after Position, limit int) ([]RecordedEvent, Position, error) {
+	return es.ReadAll(db, after, limit, Filter{})
+}
+
+// ReadAllFrom is ReadAllAfter including the event at the position. The
+// returned next is the Next of the last event, so passing it to the next
+// call of ReadAllFrom neither repeats nor skips any event.
+func (es *EventStore) ReadAllFrom(db fdb.Database, from Position, limit int) ([]RecordedEvent, Position, error) {
+	var next Position
+	v, err := db.Transact(func(tr fdb.Transaction) (interface{}, error) {
+		var events []RecordedEvent
+		var err error
+		events, next, err = es.readAllFrom(tr, from, limit)
+		return events, err
+	})
+	if err != nil {
+		return nil, from, err
+	}
+	return v.([]RecordedEvent), next, nil
+}
+
+func (es *EventStore) readAllFrom(tr fdb.Transaction, from Position, limit int) ([]RecordedEvent, Position, error) {
+	if bytes.Equal(from, EndPosition) {
+		return nil, es.tailPosition(tr).Next(), nil
+	}
+	if err := es.checkTruncated(tr, from, true); err != nil {
+		return nil, from, err
+	}
+
+	stored, last, err := es.scanAllAt(tr, fdb.Key(concat(es.global.Bytes(), from)), from, limit, Filter{})
+	if err != nil {
+		return nil, from, err
+	}
+
+	events := make([]RecordedEvent, len(stored))
+	for i, evt := range stored {
+		if events[i], err = es.interceptRead(evt.RecordedEvent); err != nil {
+			return nil, from, err
+		}
+	}
+	if len(stored) == 0 {
+		return events, from, nil
+	}
+	return events, last.Next(), nil
+}
+
+func (es *EventStore) readAll(tr fdb.Transaction, from Position, limit int, filter Filter) ([]RecordedEvent, Position, error) {
+	stored, next, err := es.scanAll(tr, from, limit, filter)
+	if err != nil {
+		return nil, from, err
+	}
+
+	events := make([]RecordedEvent, len(stored))
+	for i, evt := range stored {
+		if events[i], err = es.interceptRead(evt.RecordedEvent); err != nil {
+			return nil, from, err
+		}
+	}
+	return events, next, nil
+}
+
+// scanAll reads up to limit events after the position that match the
+// filter, inspecting at most allScanLimit events
+func (es *EventStore) scanAll(tr fdb.Transaction, from Position, limit int, filter Filter) ([]storedEvent, Position, error) {
+	if bytes.Equal(from, EndPosition) {
+		return nil, es.tailPosition(tr), nil
+	}
+	if err := es.checkTruncated(tr, from, false); err != nil {
+		return nil, from, err
+	}
+
+	begin := es.global.FDBKey()
+	if len(from) > 0 {
+		begin = fdb.Key(concat(es.global.Bytes(), from, []byte{0x00}))
+	}
+	return es.scanAllAt(tr, begin, from, limit, filter)
+}
+
+// scanAllAt scans the global space from the key, returning from as the
+// position to continue from if nothing is inspected
+func (es *EventStore) scanAllAt(tr fdb.Transaction, begin fdb.Key, from Position, limit int, filter Filter) ([]storedEvent, Position, error) {
+	_, end := es.global.FDBRangeKeys()
+
+	ri := tr.GetRange(fdb.KeyRange{Begin: begin, End: end}, fdb.RangeOptions{}).Iterator()
+
+	var events []storedEvent
+	next := from
+
+	for scanned := 0; scanned < allScanLimit && ri.Advance(); scanned++ {
+		evt, err := es.decodeGlobal(tr, ri.GetNextOrPanic())
+		if err != nil {
+			return nil, from, err
+		}
+
+		if filter.matches(evt.StreamName, evt.Contract) {
+			events = append(events, evt)
+		}
+		next = evt.GlobalPosition
+		if len(events) == limit {
+			break
+		}
+	}
+
+	return events, next, nil
+}
+
+// SubscribeToAll passes batches of matching events after the position to
+// handler, together with the position to checkpoint, polling for new
+// events until ctx is cancelled or handler returns an error.
+func (es *EventStore) SubscribeToAll(ctx context.Context, db fdb.Database, from Position, filter Filter, handler func(events []RecordedEvent, pos Position) error) error {
+	backoff := 0.01
+
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		events, next, err := es.ReadAll(db, from, 500, filter)
+		if err != nil {
+			return err
+		}
+
+		if !bytes.Equal(next, from) {
+			if err := handler(events, next); err != nil {
+				return err
+			}
+			from = next
+			backoff = 0.01
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(time.Duration(backoff * float64(time.Second))):
+		}
+		backoff = backoff * 2
+		if backoff > 1 {
+			backoff = 1
+		}
+	}
+}
+
+func concat(a ...[]byte) []byte {
+	var b []byte
+	for _, p := range a {
+		b = append(b, p...)
+	}
+	return b
+}
@@ -0,0 +1,106 @@
+package eventstore
+
+import (
+	"github.com/FoundationDB/fdb-go/fdb"
+	"github.com/abdullin/go-layers/internal/fdbtest"
+	"strconv"
+	"testing"
+)
+
+// resumeAll reads all events in pages of three, continuing each read from
+// the position the last one returned, and appending between reads
+func resumeAll(t *testing.T, db fdb.Database, es *EventStore, read func(Position) ([]RecordedEvent, Position, error)) []string {
+	var data []string
+	pos := StartPosition
+	for page := 0; ; page++ {
+		events, next, err := read(pos)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(events) == 0 {
+			if string(next) != string(pos) {
+				t.Fatalf("an empty page moved the position")
+			}
+			return data
+		}
+		for _, evt := range events {
+			data = append(data, string(evt.Data))
+		}
+		// the checkpoint survives a restart
+		pos = append(Position(nil), next...)
+		if page == 1 {
+			if err := es.Append(db, "late", ExpectedAny, []EventRecord{{Contract: "C", Data: []byte("late")}}); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+}
+
+func TestReadAllResume(t *testing.T) {
+	for _, variant := range []string{"after", "from"} {
+		db, sub := fdbtest.Open(t)
+		es := New(sub)
+		if err := es.Append(db, "s", ExpectedAny, sameContract(10)); err != nil {
+			t.Fatal(err)
+		}
+
+		read := func(pos Position) ([]RecordedEvent, Position, error) {
+			if variant == "after" {
+				return es.ReadAllAfter(db, pos, 3)
+			}
+			return es.ReadAllFrom(db, pos, 3)
+		}
+		data := resumeAll(t, db, es, read)
+
+		if len(data) != 11 || data[10] != "late" {
+			t.Fatalf("%s read %q", variant, data)
+		}
+		for i := 0; i < 10; i++ {
+			if data[i] != strconv.Itoa(i) {
+				t.Fatalf("%s read %q", variant, data)
+			}
+		}
+	}
+}
+
+func TestReadStreamResume(t *testing.T) {
+	db, sub := fdbtest.Open(t)
+	es := New(sub)
+	if err := es.Append(db, "s", ExpectedAny, sameContract(10)); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, variant := range []string{"after", "from"} {
+		var versions []int64
+		after, from := int64(-1), int64(0)
+		for {
+			var events []RecordedEvent
+			var err error
+			if variant == "after" {
+				events, err = es.ReadStreamAfter(db, "s", after, 3)
+			} else {
+				events, err = es.ReadStreamFrom(db, "s", from, 3)
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(events) == 0 {
+				break
+			}
+			for _, evt := range events {
+				versions = append(versions, evt.StreamVersion)
+			}
+			after = events[len(events)-1].StreamVersion
+			from = after + 1
+		}
+
+		if len(versions) != 10 {
+			t.Fatalf("%s read versions %v", variant, versions)
+		}
+		for i, v := range versions {
+			if v != int64(i) {
+				t.Fatalf("%s read versions %v", variant, versions)
+			}
+		}
+	}
+}
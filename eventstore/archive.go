@@ -0,0 +1,187 @@
+package eventstore
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"github.com/FoundationDB/fdb-go/fdb"
+	"github.com/FoundationDB/fdb-go/fdb/tuple"
+)
+
+// Archived events are packed into blocks of many envelopes, and both
+// copies of each event are replaced with a pointer into its block:
+//
+//	versionstamp (10 bytes) | format 2 (1 byte) | tuple (block id, index)
+//
+// Keys stay where they were, so positions, versions and order don't
+// change; reads follow the pointers. Blocks are keyed by the position of
+// their first event.
+
+const pointerFormat = 2
+
+// archiveBlockBytes leaves room in a block for the tuple escaping of the
+// envelopes
+const archiveBlockBytes = 90000
+
+var errBadPointer = errors.New("malformed archive pointer")
+
+type ArchiveReport struct {
+	Events int64
+	Blocks int64
+}
+
+// Archive packs events before the position into blocks, trading slower
+// reads of old events for far fewer keys. It works one block per
+// transaction and resumes where the last run stopped. Events too large to
+// share a block stay as they are.
+func (es *EventStore) Archive(ctx context.Context, db fdb.Database, before Position) (ArchiveReport, error) {
+	var report ArchiveReport
+	for {
+		if err := ctx.Err(); err != nil {
+			return report, err
+		}
+
+		var batch ArchiveReport
+		v, err := db.Transact(func(tr fdb.Transaction) (interface{}, error) {
+			batch = ArchiveReport{}
+			return es.archiveBlock(tr, before, &batch)
+		})
+		if err != nil {
+			return report, err
+		}
+
+		report.Events += batch.Events
+		report.Blocks += batch.Blocks
+		if done := v.(bool); done {
+			return report, nil
+		}
+	}
+}
+
+// archiveBlock packs the next events before the position into a block.
+// Returns true once there is nothing left to archive.
+func (es *EventStore) archiveBlock(tr fdb.Transaction, before Position, report *ArchiveReport) (bool, error) {
+	cursor := es.cursors.Pack(tuple.Tuple{"archive"})
+	begin := es.global.FDBKey()
+	if val := tr.Get(cursor).GetOrPanic(); val != nil {
+		begin = fdb.Key(concat(es.global.Bytes(), val, []byte{0x00}))
+	}
+	end := fdb.Key(concat(es.global.Bytes(), before))
+	if bytes.Compare(begin, end) >= 0 {
+		return true, nil
+	}
+
+	ri := tr.GetRange(fdb.KeyRange{Begin: begin, End: end}, fdb.RangeOptions{}).Iterator()
+	var block tuple.Tuple
+	var keys []fdb.Key
+	var last Position
+	size := 0
+
+	for ri.Advance() {
+		kv := ri.GetNextOrPanic()
+		// the worst case of escaping doubles an envelope
+		grow := 2*len(kv.Value) + 8
+		if len(block) > 0 && size+grow > archiveBlockBytes {
+			break
+		}
+		last = Position(kv.Key[len(es.global.Bytes()):])
+		if valueFormat(kv.Value) != envelopeFormat || grow > archiveBlockBytes {
+			continue
+		}
+		block = append(block, kv.Value)
+		keys = append(keys, kv.Key)
+		size += grow
+	}
+	if last == nil {
+		return true, nil
+	}
+
+	if len(block) > 0 {
+		id := []byte(keys[0][len(es.global.Bytes()):])
+		tr.Set(es.archive.Pack(tuple.Tuple{id}), block.Pack())
+
+		for i, key := range keys {
+			pos := Position(key[len(es.global.Bytes()):])
+			t, err := tuple.Unpack(pos[stampLen:])
+			if err != nil {
+				return false, err
+			}
+			ref := tuple.Tuple{id, int64(i)}.Pack()
+			tr.Set(key, concat(make([]byte, stampLen), []byte{pointerFormat}, ref))
+			// the stream copy keeps the versionstamp it was written with
+			tr.Set(es.events.Pack(t), concat(pos[:stampLen], []byte{pointerFormat}, ref))
+		}
+		report.Blocks++
+		report.Events += int64(len(keys))
+	}
+
+	tr.Set(cursor, last)
+	return false, nil
+}
+
+// unarchive returns the envelope a pointer refers to, carrying the
+// versionstamp of the pointer
+func (es *EventStore) unarchive(tr fdb.Transaction, pointer []byte) ([]byte, error) {
+	id, index, err := decodePointer(pointer)
+	if err != nil {
+		return nil, err
+	}
+
+	val := tr.Get(es.archive.Pack(tuple.Tuple{id})).GetOrPanic()
+	block, err := tuple.Unpack(val)
+	if err != nil || index < 0 || index >= int64(len(block)) {
+		return nil, errBadPointer
+	}
+	env, ok := block[index].([]byte)
+	if !ok || valueFormat(env) != envelopeFormat {
+		return nil, errBadPointer
+	}
+	return concat(pointer[:stampLen], env[stampLen:]), nil
+}
+
+// decodePointer returns the block id and index a pointer refers to
+func decodePointer(pointer []byte) (id []byte, index int64, err error) {
+	if valueFormat(pointer) != pointerFormat {
+		return nil, 0, errBadPointer
+	}
+	ref, err := tuple.Unpack(pointer[headerLen:])
+	if err != nil || len(ref) != 2 {
+		return nil, 0, errBadPointer
+	}
+	id, ok1 := ref[0].([]byte)
+	index, ok2 := ref[1].(int64)
+	if !ok1 || !ok2 {
+		return nil, 0, errBadPointer
+	}
+	return id, index, nil
+}
+
+// unarchiveRemove drops the envelope a pointer refers to from its block,
+// clearing the block once it holds no envelope. Returns the number of
+// keys and bytes removed.
+func (es *EventStore) unarchiveRemove(tr fdb.Transaction, pointer []byte) (int, int) {
+	id, index, err := decodePointer(pointer)
+	if err != nil {
+		return 0, 0
+	}
+	key := es.archive.Pack(tuple.Tuple{id})
+	val := tr.Get(key).GetOrPanic()
+	block, err := tuple.Unpack(val)
+	if err != nil || index < 0 || index >= int64(len(block)) {
+		return 0, 0
+	}
+	env, ok := block[index].([]byte)
+	if !ok {
+		return 0, 0
+	}
+
+	block[index] = nil
+	for _, el := range block {
+		if el != nil {
+			tr.Set(key, block.Pack())
+			return 0, len(env)
+		}
+	}
+	tr.Clear(key)
+	return 1, len(key) + len(val)
+}
@@ -0,0 +1,85 @@
+package eventstore
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"github.com/FoundationDB/fdb-go/fdb"
+	"github.com/abdullin/go-layers/internal/fdbtest"
+	"reflect"
+	"testing"
+)
+
+func TestArchiveRoundTrip(t *testing.T) {
+	db, sub := fdbtest.Open(t)
+	es := New(sub)
+	ctx := context.Background()
+
+	// more than a block, interleaving streams
+	streams := []string{"a", "b", "c"}
+	for i := 0; i < 50; i++ {
+		for _, stream := range streams {
+			record := EventRecord{Contract: "C", Data: bytes.Repeat([]byte(fmt.Sprint(i)), 500)}
+			if err := es.Append(db, stream, ExpectedAny, []EventRecord{record}); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	readAll := func() []RecordedEvent {
+		events, _, err := es.ReadAll(db, StartPosition, 0, Filter{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return events
+	}
+	readStreams := func() [][]RecordedEvent {
+		var all [][]RecordedEvent
+		for _, stream := range streams {
+			events, err := es.ReadStream(db, stream, ReadOptions{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			all = append(all, events)
+		}
+		return all
+	}
+	before, beforeStreams := readAll(), readStreams()
+
+	report, err := es.Archive(ctx, db, before[100].GlobalPosition)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Events != 100 || report.Blocks < 2 {
+		t.Fatalf("archived %+v", report)
+	}
+
+	if after := readAll(); !reflect.DeepEqual(after, before) {
+		t.Fatal("archived events read back differently from all streams")
+	}
+	if after := readStreams(); !reflect.DeepEqual(after, beforeStreams) {
+		t.Fatal("archived events read back differently from their streams")
+	}
+	evt, ok, err := es.ReadEventByID(db, before[0].EventID)
+	if err != nil || !ok || !reflect.DeepEqual(evt, before[0]) {
+		t.Fatalf("archived event read by id as %+v, %v, %v", evt, ok, err)
+	}
+
+	// nothing is left of the blocks once their events are scavenged
+	for _, stream := range streams {
+		if err := es.DeleteStream(db, stream); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := es.Scavenge(ctx, db, ScavengeOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	v, err := db.Transact(func(tr fdb.Transaction) (interface{}, error) {
+		return tr.GetRange(es.archive, fdb.RangeOptions{Limit: 1}).GetSliceWithError()
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if kvs := v.([]fdb.KeyValue); len(kvs) != 0 {
+		t.Fatalf("block %s left after scavenging", fdb.Printable(kvs[0].Key))
+	}
+}
@@ -0,0 +1,32 @@
+package eventstore
+
+import "github.com/FoundationDB/fdb-go/fdb"
+
+// AppendFuture is the pending result of AppendAsync
+type AppendFuture struct {
+	done    chan struct{}
+	results []WriteResult
+	err     error
+}
+
+// Wait blocks until the append commits or fails
+func (f *AppendFuture) Wait() ([]WriteResult, error) {
+	<-f.done
+	return f.results, f.err
+}
+
+// AppendAsync starts appending records to the end of the stream in its
+// own transaction and returns at once, so appends to different streams
+// proceed in parallel. Records of one call keep their order, but
+// concurrent calls for the same stream race for the next versions and
+// commit in no particular order; chain them through Wait, or use Append
+// with an expected version, when order across calls matters.
+func (es *EventStore) AppendAsync(db fdb.Database, stream string, records []EventRecord) *AppendFuture {
+	f := &AppendFuture{done: make(chan struct{})}
+
+	go func() {
+		defer close(f.done)
+		f.results, f.err = es.AppendMulti(db, []StreamAppend{{stream, ExpectedAny, records}})
+	}()
+	return f
+}
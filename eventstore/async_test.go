@@ -0,0 +1,75 @@
+package eventstore
+
+import (
+	"fmt"
+	"github.com/abdullin/go-layers/internal/fdbtest"
+	"testing"
+)
+
+func TestAppendAsync(t *testing.T) {
+	db, sub := fdbtest.Open(t)
+	es := New(sub)
+
+	const streams = 20
+	futures := make([]*AppendFuture, streams)
+	for i := range futures {
+		futures[i] = es.AppendAsync(db, fmt.Sprint("s", i), sameContract(3))
+	}
+	for i, f := range futures {
+		results, err := f.Wait()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(results) != 1 || results[0].Stream != fmt.Sprint("s", i) || len(results[0].Versions) != 3 || results[0].Versions[2] != 2 {
+			t.Fatalf("append %d returned %+v", i, results)
+		}
+	}
+
+	// a second round continues every stream
+	for i := range futures {
+		futures[i] = es.AppendAsync(db, fmt.Sprint("s", i), sameContract(1))
+	}
+	for i, f := range futures {
+		if results, err := f.Wait(); err != nil || results[0].Versions[0] != 3 {
+			t.Fatalf("append %d returned %+v, %v", i, results, err)
+		}
+	}
+}
+
+// the benchmarks append to 100 streams a round, one after another and all
+// at once
+
+const benchStreams = 100
+
+func BenchmarkAppendSequential(b *testing.B) {
+	db, sub := fdbtest.Open(b)
+	es := New(sub)
+	records := []EventRecord{benchRecord}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := es.Append(db, fmt.Sprint("s", i%benchStreams), ExpectedAny, records); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkAppendAsync(b *testing.B) {
+	db, sub := fdbtest.Open(b)
+	es := New(sub)
+	records := []EventRecord{benchRecord}
+
+	b.ResetTimer()
+	futures := make([]*AppendFuture, 0, benchStreams)
+	for i := 0; i < b.N; i++ {
+		futures = append(futures, es.AppendAsync(db, fmt.Sprint("s", i%benchStreams), records))
+		if len(futures) == benchStreams || i == b.N-1 {
+			for _, f := range futures {
+				if _, err := f.Wait(); err != nil {
+					b.Fatal(err)
+				}
+			}
+			futures = futures[:0]
+		}
+	}
+}
@@ -0,0 +1,186 @@
+package eventstore
+
+import (
+	"bytes"
+	"github.com/FoundationDB/fdb-go/fdb"
+	"github.com/FoundationDB/fdb-go/fdb/subspace"
+	"github.com/FoundationDB/fdb-go/fdb/tuple"
+	"github.com/abdullin/go-layers/versionstamp"
+	"time"
+)
+
+// Events are indexed by the minute they were appended in: every append
+// writes (minute, versionstamp, stream, version) -> created blindly, and
+// reads scan the buckets covering the requested range, filtering on the
+// stored timestamp. With Strings set, the stream in the key is interned
+// (see intern.go), and events of one transaction come in the order of
+// their tokens.
+//
+// Timestamps come from the clock of the appending process, so events of
+// writers with skewed clocks may appear out of order or outside the range
+// a reader expects. Events appended before the index existed are absent.
+
+const bucketSeconds = 60
+
+func timeBucket(unix int64) int64 {
+	return unix / bucketSeconds
+}
+
+func (es *EventStore) timeBucket(bucket int64) []byte {
+	return es.byTime.Pack(tuple.Tuple{bucket})
+}
+
+// indexTime adds an event being appended to the time index, the database
+// fills in the versionstamp at commit
+func (es *EventStore) indexTime(tr fdb.Transaction, stream string, version, created int64) error {
+	ref, err := es.indexRef(tr, stream, version)
+	if err != nil {
+		return err
+	}
+	bucket := es.timeBucket(timeBucket(created))
+	key := concat(bucket, make([]byte, stampLen), ref)
+	tr.SetVersionstampedKey(fdb.Key(versionstamp.Key(key, len(bucket))), tuple.Tuple{created}.Pack())
+	return nil
+}
+
+// unindexTime removes an event from the time index, returning the size of
+// the removed entries
+func (es *EventStore) unindexTime(tr fdb.Transaction, evt RecordedEvent) (keys, bytes int) {
+	prefix := concat(es.timeBucket(timeBucket(evt.CreatedAt.Unix())), evt.GlobalPosition[:stampLen])
+	for _, ref := range es.indexRefs(tr, evt.StreamName, evt.StreamVersion) {
+		key := fdb.Key(concat(prefix, ref))
+		if val := tr.Get(key).GetOrPanic(); val != nil {
+			tr.Clear(key)
+			keys++
+			bytes += len(key) + len(val)
+		}
+	}
+	return
+}
+
+// byTimePage is the number of index entries read per transaction
+const byTimePage = 1000
+
+// ReadByTime returns up to limit events appended within [from, to) after
+// the position, nil to start at from, and the position of the last one
+// returned to read the next page after. Events come by minute and in
+// global order within a minute, up to the order of tokens noted above.
+// The index is read a page of entries per
+// transaction, so wide ranges don't have to fit in one.
+func (es *EventStore) ReadByTime(db fdb.Database, from, to time.Time, after Position, limit int) ([]RecordedEvent, Position, error) {
+	begin, end := from.Unix(), to.Unix()
+	bucket := timeBucket(begin)
+	var start, skip Position
+
+	if len(after) > 0 {
+		v, err := db.Transact(func(tr fdb.Transaction) (interface{}, error) {
+			evt, ok, err := es.loadGlobal(tr, after)
+			if err != nil || !ok {
+				return byTimeCursor{}, err
+			}
+			indexed, err := es.indexedPosition(tr, after)
+			return byTimeCursor{evt.CreatedAt.Unix(), indexed, true}, err
+		})
+		if err != nil {
+			return nil, nil, err
+		}
+		switch c := v.(byTimeCursor); {
+		case !c.found:
+			// without the event its minute is unknown, so the scan
+			// restarts at from, skipping events before it in global order
+			skip = after
+		case timeBucket(c.created) >= bucket:
+			bucket = timeBucket(c.created)
+			start = c.indexed.Next()
+		}
+	}
+
+	var events []RecordedEvent
+	last := after
+	for bucket <= timeBucket(end) && (limit <= 0 || len(events) < limit) {
+		prefix := es.timeBucket(bucket)
+
+		v, err := db.Transact(func(tr fdb.Transaction) (interface{}, error) {
+			page := byTimeResult{}
+			_, stop := subspace.FromBytes(prefix).FDBRangeKeys()
+			r := fdb.KeyRange{Begin: fdb.Key(concat(prefix, start)), End: stop}
+			kvs := tr.GetRange(r, fdb.RangeOptions{Limit: byTimePage}).GetSliceOrPanic()
+			page.more = len(kvs) == byTimePage
+
+			for _, kv := range kvs {
+				created := decodeInt(kv.Value)
+				indexed := Position(kv.Key[len(prefix):])
+				page.next = indexed.Next()
+				if created < begin || created >= end {
+					continue
+				}
+				pos, err := es.resolvePosition(tr, indexed)
+				if err != nil {
+					return nil, err
+				}
+				if skip != nil && bytes.Compare(pos, skip) <= 0 {
+					continue
+				}
+
+				evt, ok, err := es.loadGlobal(tr, pos)
+				if err != nil {
+					return nil, err
+				}
+				if !ok {
+					continue
+				}
+				if evt, err = es.interceptRead(evt); err != nil {
+					return nil, err
+				}
+				page.events = append(page.events, evt)
+				page.last = pos
+				if limit > 0 && len(events)+len(page.events) == limit {
+					page.more = true
+					break
+				}
+			}
+			return page, nil
+		})
+		if err != nil {
+			return nil, nil, err
+		}
+
+		page := v.(byTimeResult)
+		events = append(events, page.events...)
+		if page.last != nil {
+			last = page.last
+		}
+		if page.more {
+			start = page.next
+			continue
+		}
+		bucket++
+		start = nil
+	}
+	return events, last, nil
+}
+
+type byTimeCursor struct {
+	created int64
+	indexed Position // as the time index holds it
+	found   bool
+}
+
+// byTimeResult is a page of the time index
+type byTimeResult struct {
+	events []RecordedEvent
+	last   Position
+	next   Position // where the page stopped in its bucket
+	more   bool
+}
+
+// loadGlobal reads the event at a position of the global space
+func (es *EventStore) loadGlobal(tr fdb.Transaction, pos Position) (RecordedEvent, bool, error) {
+	key := fdb.Key(concat(es.global.Bytes(), pos))
+	val := tr.Get(key).GetOrPanic()
+	if val == nil {
+		return RecordedEvent{}, false, nil
+	}
+	evt, err := es.decodeGlobal(tr, fdb.KeyValue{Key: key, Value: val})
+	return evt.RecordedEvent, err == nil, err
+}
@@ -0,0 +1,98 @@
+package eventstore
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"github.com/FoundationDB/fdb-go/fdb"
+	"github.com/abdullin/go-layers/internal/fdbtest"
+	"testing"
+	"time"
+)
+
+// importAt writes an event per offset from base, created at it, through
+// Import, so they are indexed at those times
+func importAt(t *testing.T, db fdb.Database, es *EventStore, stream string, base time.Time, offsets ...time.Duration) {
+	t.Helper()
+	var buf bytes.Buffer
+	for i, off := range offsets {
+		line, err := json.Marshal(ExportedEvent{Stream: stream, Version: int64(i), Contract: "C", Data: []byte(off.String()), Created: base.Add(off)})
+		if err != nil {
+			t.Fatal(err)
+		}
+		buf.Write(append(line, '\n'))
+	}
+	if _, err := es.Import(context.Background(), db, &buf, ImportOptions{}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestReadByTime(t *testing.T) {
+	db, sub := fdbtest.Open(t)
+	es := New(sub)
+
+	base := time.Now().Truncate(time.Minute).Add(-time.Hour)
+	importAt(t, db, es, "a", base,
+		-time.Second,                 // the minute before
+		10*time.Second,               // in the first minute, before from
+		30*time.Second,               // from here
+		2*time.Minute+10*time.Second, // buckets in between
+		4*time.Minute+59*time.Second,
+		5*time.Minute, // at to, excluded
+		6*time.Minute,
+	)
+	from, to := base.Add(20*time.Second), base.Add(5*time.Minute)
+	want := []string{"30s", "2m10s", "4m59s"}
+
+	events, last, err := es.ReadByTime(db, from, to, nil, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != len(want) {
+		t.Fatalf("read %d events, want %d", len(events), len(want))
+	}
+	for i, evt := range events {
+		if string(evt.Data) != want[i] || !evt.CreatedAt.Equal(base.Add(mustDuration(t, want[i]))) {
+			t.Fatalf("event %d created at %v with %q, want %q", i, evt.CreatedAt, evt.Data, want[i])
+		}
+	}
+	if !bytes.Equal(last, events[len(events)-1].GlobalPosition) {
+		t.Fatalf("last position %x, last event at %x", last, events[len(events)-1].GlobalPosition)
+	}
+
+	// paging one event at a time reads the same events
+	var after Position
+	for i := range want {
+		page, next, err := es.ReadByTime(db, from, to, after, 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(page) != 1 || string(page[0].Data) != want[i] {
+			t.Fatalf("page %d %+v", i, page)
+		}
+		after = next
+	}
+	if page, _, err := es.ReadByTime(db, from, to, after, 1); err != nil || len(page) != 0 {
+		t.Fatalf("read %d events past the last page, %v", len(page), err)
+	}
+
+	// scavenged events drop out of the results
+	if err := es.DeleteStream(db, "a"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := es.Scavenge(context.Background(), db, ScavengeOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if events, _, err = es.ReadByTime(db, from, to, nil, 0); err != nil || len(events) != 0 {
+		t.Fatalf("read %d events of a scavenged stream, %v", len(events), err)
+	}
+}
+
+func mustDuration(t *testing.T, s string) time.Duration {
+	t.Helper()
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return d
+}
@@ -0,0 +1,97 @@
+package eventstore
+
+import (
+	"bytes"
+	"context"
+	"github.com/FoundationDB/fdb-go/fdb"
+)
+
+// channelPage is the number of events read per transaction by the
+// channel readers
+const channelPage = 500
+
+// StreamEvents sends the events of a stream starting with the version to
+// the returned channel, reading a page at a time on its own goroutine.
+// The goroutine waits for the consumer, so a slow consumer slows the
+// reads. Both channels close once the end of the stream is reached, ctx
+// is cancelled or a read fails; the error channel then holds the error,
+// if any.
+func (es *EventStore) StreamEvents(ctx context.Context, db fdb.Database, stream string, from int64) (<-chan RecordedEvent, <-chan error) {
+	events := make(chan RecordedEvent, es.ChannelBuffer)
+	errs := make(chan error, 1)
+
+	go func() {
+		defer close(errs)
+		defer close(events)
+
+		for {
+			page, err := es.ReadStream(db, stream, ReadOptions{From: from, Limit: channelPage})
+			if err != nil {
+				errs <- err
+				return
+			}
+			if len(page) == 0 {
+				// retention can hide a whole page before the end of the
+				// stream
+				v, err := db.Transact(func(tr fdb.Transaction) (interface{}, error) {
+					return es.lastVersion(tr, stream), nil
+				})
+				if err == nil {
+					err = ctx.Err()
+				}
+				if err != nil {
+					errs <- err
+					return
+				}
+				if from+channelPage > v.(int64) {
+					return
+				}
+				from += channelPage
+				continue
+			}
+			for _, evt := range page {
+				select {
+				case events <- evt:
+				case <-ctx.Done():
+					errs <- ctx.Err()
+					return
+				}
+			}
+			from = page[len(page)-1].StreamVersion + 1
+		}
+	}()
+	return events, errs
+}
+
+// AllEvents is StreamEvents for the events of the global space after the
+// position, up to the latest one at the time of the last page
+func (es *EventStore) AllEvents(ctx context.Context, db fdb.Database, from Position) (<-chan RecordedEvent, <-chan error) {
+	events := make(chan RecordedEvent, es.ChannelBuffer)
+	errs := make(chan error, 1)
+
+	go func() {
+		defer close(errs)
+		defer close(events)
+
+		for {
+			page, next, err := es.ReadAllAfter(db, from, channelPage)
+			if err != nil {
+				errs <- err
+				return
+			}
+			if bytes.Equal(next, from) {
+				return
+			}
+			for _, evt := range page {
+				select {
+				case events <- evt:
+				case <-ctx.Done():
+					errs <- ctx.Err()
+					return
+				}
+			}
+			from = next
+		}
+	}()
+	return events, errs
+}
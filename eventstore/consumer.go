@@ -0,0 +1,156 @@
+package eventstore
+
+import (
+	"bytes"
+	"errors"
+	"github.com/FoundationDB/fdb-go/fdb"
+	"github.com/FoundationDB/fdb-go/fdb/tuple"
+	"github.com/abdullin/go-layers/subspaces"
+)
+
+var ErrConsumerNotFound = errors.New("consumer not found")
+
+// Consumer is a group reading the global space and its checkpoint
+type Consumer struct {
+	Group    string
+	Position Position
+}
+
+func (es *EventStore) consumerKey(group string) fdb.Key {
+	return es.consumers.Pack(tuple.Tuple{group})
+}
+
+// SaveConsumer checkpoints a consumer group as part of the caller's
+// transaction, typically the one that applied the events up to pos.
+// Projections over the global space checkpoint here too.
+func (es *EventStore) SaveConsumer(tr fdb.Transaction, group string, pos Position) {
+	subspaces.NewTx(tr, es.consumers).Set(tuple.Tuple{group}, pos)
+}
+
+// ListConsumers returns all consumer groups ordered by name
+func (es *EventStore) ListConsumers(db fdb.Database) ([]Consumer, error) {
+	v, err := db.Transact(func(tr fdb.Transaction) (interface{}, error) {
+		var consumers []Consumer
+		tx := subspaces.NewTx(tr, es.consumers)
+		for _, kv := range tx.GetRange(nil, fdb.RangeOptions{}).GetSliceOrPanic() {
+			t, err := tx.Unpack(kv.Key)
+			if err != nil {
+				return nil, err
+			}
+			consumers = append(consumers, Consumer{t[0].(string), Position(kv.Value)})
+		}
+		return consumers, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return v.([]Consumer), nil
+}
+
+// ResetConsumer moves the checkpoint of a consumer group, e.g. back to
+// nil to replay everything. Running consumers pick it up after their
+// current batch.
+func (es *EventStore) ResetConsumer(db fdb.Database, group string, to Position) error {
+	_, err := db.Transact(func(tr fdb.Transaction) (interface{}, error) {
+		if subspaces.NewTx(tr, es.consumers).Get(tuple.Tuple{group}).GetOrPanic() == nil {
+			return nil, ErrConsumerNotFound
+		}
+		es.SaveConsumer(tr, group, to)
+		return nil, nil
+	})
+	return err
+}
+
+// tailKey returns the global key of the latest event, nil if there is
+// none
+func (es *EventStore) tailKey(tr fdb.Transaction) fdb.Key {
+	_, end := es.global.FDBRangeKeys()
+	if key := tr.GetKey(fdb.LastLessThan(end)).GetOrPanic(); es.global.Contains(key) {
+		return key
+	}
+	return nil
+}
+
+// tailPosition returns the position of the latest event, nil if there is
+// none
+func (es *EventStore) tailPosition(tr fdb.Transaction) Position {
+	if key := es.tailKey(tr); key != nil {
+		return Position(key[len(es.global.Bytes()):])
+	}
+	return nil
+}
+
+// GetConsumerLag returns the number of events after the checkpoint of the
+// group up to the latest one, whether or not the consumer filters them.
+// The tail is found with a single key read; the events behind it are
+// counted with key selector offsets, reading keys but no values, so the
+// cost grows with the lag only in steps of lagStep events.
+func (es *EventStore) GetConsumerLag(db fdb.Database, group string) (int64, error) {
+	var from, tail fdb.Key
+	_, err := db.Transact(func(tr fdb.Transaction) (interface{}, error) {
+		pos := tr.Get(es.consumerKey(group)).GetOrPanic()
+		if pos == nil {
+			return nil, ErrConsumerNotFound
+		}
+		from = es.global.FDBKey()
+		if len(pos) > 0 {
+			from = fdb.Key(concat(es.global.Bytes(), pos, []byte{0x00}))
+		}
+		tail = es.tailKey(tr)
+		return nil, nil
+	})
+	if err != nil || tail == nil {
+		return 0, err
+	}
+
+	end := fdb.Key(concat(tail, []byte{0x00}))
+	lag := int64(0)
+	for {
+		var next fdb.Key
+		v, err := db.Transact(func(tr fdb.Transaction) (interface{}, error) {
+			n, after := countKeys(tr.Snapshot(), from, end, lagStep)
+			next = after
+			return n, nil
+		})
+		if err != nil {
+			return 0, err
+		}
+
+		lag += int64(v.(int))
+		if next == nil {
+			return lag, nil
+		}
+		from = next
+	}
+}
+
+// lagStep is the number of events GetConsumerLag skips per transaction
+const lagStep = 10000
+
+// countKeys counts the keys in [from, end) up to max without reading
+// values. With max keys found it also returns the key to continue
+// counting from, otherwise nil.
+func countKeys(rt fdb.Snapshot, from, end fdb.Key, max int) (int, fdb.Key) {
+	// nth returns the n-th key from the start of the range
+	nth := func(n int) fdb.Key {
+		sel := fdb.FirstGreaterOrEqual(from)
+		sel.Offset += n - 1
+		return rt.GetKey(sel).GetOrPanic()
+	}
+
+	if key := nth(max); bytes.Compare(key, end) < 0 {
+		return max, fdb.Key(concat(key, []byte{0x00}))
+	}
+
+	// fewer than max keys are left, the count is found by bisection
+	lo, hi := 0, max
+	for hi-lo > 1 {
+		mid := (lo + hi) / 2
+		if bytes.Compare(nth(mid), end) < 0 {
+			lo = mid
+		} else {
+			hi = mid
+		}
+	}
+	return lo, nil
+}
@@ -0,0 +1,53 @@
+package eventstore
+
+import (
+	"github.com/FoundationDB/fdb-go/fdb"
+	"github.com/abdullin/go-layers/internal/fdbtest"
+	"testing"
+)
+
+func TestConsumers(t *testing.T) {
+	db, sub := fdbtest.Open(t)
+	es := New(sub)
+
+	if err := es.Append(db, "a", ExpectedNoStream, []EventRecord{{Contract: "C"}, {Contract: "C"}, {Contract: "C"}}); err != nil {
+		t.Fatal(err)
+	}
+	events, _, err := es.ReadAll(db, nil, 0, Filter{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = db.Transact(func(tr fdb.Transaction) (interface{}, error) {
+		es.SaveConsumer(tr, "b", events[0].GlobalPosition)
+		es.SaveConsumer(tr, "a", events[2].GlobalPosition)
+		return nil, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	consumers, err := es.ListConsumers(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(consumers) != 2 || consumers[0].Group != "a" || consumers[1].Group != "b" {
+		t.Fatalf("listed %+v", consumers)
+	}
+	for group, want := range map[string]int64{"a": 0, "b": 2} {
+		if lag, err := es.GetConsumerLag(db, group); err != nil || lag != want {
+			t.Fatalf("lag of %s is %d, %v; want %d", group, lag, err, want)
+		}
+	}
+
+	// back to the start, every event is behind
+	if err := es.ResetConsumer(db, "a", nil); err != nil {
+		t.Fatal(err)
+	}
+	if lag, err := es.GetConsumerLag(db, "a"); err != nil || lag != 3 {
+		t.Fatalf("lag after the reset %d, %v", lag, err)
+	}
+	if err := es.ResetConsumer(db, "c", nil); err != ErrConsumerNotFound {
+		t.Fatalf("reset of an unknown group: %v", err)
+	}
+}
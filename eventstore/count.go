@@ -0,0 +1,188 @@
+package eventstore
+
+import (
+	"encoding/binary"
+	"github.com/FoundationDB/fdb-go/fdb"
+	"github.com/FoundationDB/fdb-go/fdb/tuple"
+	"time"
+)
+
+// Counters are little-endian int64 values updated with atomic ADD, so
+// appends to different streams never conflict on them. They count
+// events that are stored and not hard-deleted; events hidden by MaxCount
+// or MaxAge are counted until Scavenge removes them.
+
+func encodeCounter(n int64) []byte {
+	b := make([]byte, 8)
+	binary.LittleEndian.PutUint64(b, uint64(n))
+	return b
+}
+
+func decodeCounter(b []byte) int64 {
+	if len(b) != 8 {
+		return 0
+	}
+	return int64(binary.LittleEndian.Uint64(b))
+}
+
+func (es *EventStore) streamCounter(stream string) fdb.Key {
+	return es.counters.Pack(tuple.Tuple{"stream", stream})
+}
+
+func (es *EventStore) totalCounter() fdb.Key {
+	return es.counters.Pack(tuple.Tuple{"all"})
+}
+
+// count adjusts the counters of a stream and of the whole store. Metadata
+// streams are not counted.
+func (es *EventStore) count(tr fdb.Transaction, stream string, delta int64) {
+	if delta == 0 || isMetadataStream(stream) {
+		return
+	}
+	tr.Add(es.streamCounter(stream), encodeCounter(delta))
+	tr.Add(es.totalCounter(), encodeCounter(delta))
+}
+
+// limited tells whether retention may hide events of the stream that are
+// still counted
+func (m StreamMetadata) limited() bool {
+	return m.MaxCount > 0 || m.MaxAge > 0
+}
+
+// limitedCounter counts the streams whose metadata sets MaxCount or
+// MaxAge, which leave CountAll inexact
+func (es *EventStore) limitedCounter() fdb.Key {
+	return es.counters.Pack(tuple.Tuple{"limited"})
+}
+
+// countLimited adjusts the limited counter for metadata changing from was
+// to is
+func (es *EventStore) countLimited(tr fdb.Transaction, was, is bool) {
+	switch {
+	case is && !was:
+		tr.Add(es.limitedCounter(), encodeCounter(1))
+	case was && !is:
+		tr.Add(es.limitedCounter(), encodeCounter(-1))
+	}
+}
+
+// CountStream returns the number of events in a stream. It is exact
+// unless MaxCount or MaxAge currently hide events, which are counted until
+// Scavenge removes them.
+func (es *EventStore) CountStream(db fdb.Database, stream string) (int64, bool, error) {
+	v, err := db.Transact(func(tr fdb.Transaction) (interface{}, error) {
+		counted := tr.Get(es.streamCounter(stream))
+		meta, err := es.getMetadata(tr, stream)
+		if err != nil {
+			return nil, err
+		}
+		c := streamCount{n: decodeCounter(counted.GetOrPanic()), exact: true}
+		if meta.Deleted || c.n == 0 {
+			return c, nil
+		}
+		if meta.MaxCount > 0 && c.n > meta.MaxCount {
+			c.exact = false
+		} else if meta.MaxAge > 0 {
+			// the oldest counted event is the first to age out
+			events, err := es.scanStream(tr, stream, meta.DeletedBefore, 1)
+			if err != nil {
+				return nil, err
+			}
+			c.exact = len(events) == 0 || time.Since(events[0].CreatedAt) <= meta.MaxAge
+		}
+		return c, nil
+	})
+	if err != nil {
+		return 0, false, err
+	}
+	c := v.(streamCount)
+	return c.n, c.exact, nil
+}
+
+type streamCount struct {
+	n     int64
+	exact bool
+}
+
+// CountAll returns the number of events in the store. It is exact unless
+// a stream sets MaxCount or MaxAge, which may hide counted events; streams
+// whose metadata predates metadata streams are not accounted for.
+func (es *EventStore) CountAll(db fdb.Database) (int64, bool, error) {
+	v, err := db.Transact(func(tr fdb.Transaction) (interface{}, error) {
+		total, limited := tr.Get(es.totalCounter()), tr.Get(es.limitedCounter())
+		return streamCount{decodeCounter(total.GetOrPanic()), decodeCounter(limited.GetOrPanic()) <= 0}, nil
+	})
+	if err != nil {
+		return 0, false, err
+	}
+	c := v.(streamCount)
+	return c.n, c.exact, nil
+}
+
+// recountPage is the number of events counted per transaction by Recount
+const recountPage = 1000
+
+// Recount scans a stream and repairs its counter (and the store total)
+// if they drifted. Returns the actual number of events.
+//
+// The stream is counted a page per transaction. The last page is counted
+// in the transaction that applies the correction: it reads the counter at
+// snapshot isolation and adds the difference, while its reads of the head
+// and of the last page conflict with appends to the stream. Events
+// Scavenge removes from pages counted earlier are left for the next
+// Recount.
+func (es *EventStore) Recount(db fdb.Database, stream string) (int64, error) {
+	from, actual := int64(0), int64(0)
+	for {
+		v, err := db.Transact(func(tr fdb.Transaction) (interface{}, error) {
+			return es.recountPage(tr, stream, from, actual)
+		})
+		if err != nil {
+			return 0, err
+		}
+		page := v.(recountResult)
+		if page.done {
+			return page.actual, nil
+		}
+		from, actual = page.next, page.actual
+	}
+}
+
+type recountResult struct {
+	actual int64 // events counted so far
+	next   int64 // version to count from
+	done   bool
+}
+
+// recountPage counts the page of the stream from the version on top of
+// the events counted before it, applying the correction once the stream
+// is done
+func (es *EventStore) recountPage(tr fdb.Transaction, stream string, from, actual int64) (recountResult, error) {
+	meta, err := es.getMetadata(tr, stream)
+	if err != nil {
+		return recountResult{}, err
+	}
+	if from < meta.DeletedBefore {
+		// deleted meanwhile, the count starts over past the tombstone
+		from, actual = meta.DeletedBefore, 0
+	}
+
+	if meta.Deleted || isMetadataStream(stream) {
+		actual = 0
+	} else {
+		// the head is read for real, so appends to the stream conflict
+		// with the last page
+		last := es.lastVersion(tr, stream)
+		streamSpace := es.events.Sub(stream)
+		r := fdb.KeyRange{Begin: streamSpace.Pack(tuple.Tuple{from}), End: streamSpace.Pack(tuple.Tuple{from + recountPage})}
+		kvs := tr.GetRange(r, fdb.RangeOptions{}).GetSliceOrPanic()
+		actual += int64(len(kvs))
+		if from+recountPage <= last {
+			return recountResult{actual: actual, next: from + recountPage}, nil
+		}
+	}
+
+	counted := decodeCounter(tr.Snapshot().Get(es.streamCounter(stream)).GetOrPanic())
+	es.count(tr, stream, actual-counted)
+	return recountResult{actual: actual, done: true}, nil
+}
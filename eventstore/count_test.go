@@ -0,0 +1,106 @@
+package eventstore
+
+import (
+	"github.com/FoundationDB/fdb-go/fdb"
+	"github.com/abdullin/go-layers/internal/fdbtest"
+	"testing"
+)
+
+func TestCountExact(t *testing.T) {
+	db, sub := fdbtest.Open(t)
+	es := New(sub)
+
+	records := []EventRecord{{Contract: "C"}, {Contract: "C"}, {Contract: "C"}}
+	for _, stream := range []string{"a", "b"} {
+		if err := es.Append(db, stream, ExpectedNoStream, records); err != nil {
+			t.Fatal(err)
+		}
+	}
+	expect := func(stream string, want int64, exact bool) {
+		t.Helper()
+		count := func() (int64, bool, error) { return es.CountStream(db, stream) }
+		if stream == "" {
+			count = func() (int64, bool, error) { return es.CountAll(db) }
+		}
+		n, ok, err := count()
+		if err != nil || n != want || ok != exact {
+			t.Fatalf("count of %q is %d, exact %v, %v; want %d, exact %v", stream, n, ok, err, want, exact)
+		}
+	}
+	expect("a", 3, true)
+	expect("", 6, true)
+
+	// MaxCount hides the oldest event of a until Scavenge removes it
+	if err := es.SetStreamMetadata(db, "a", StreamMetadata{MaxCount: 2}); err != nil {
+		t.Fatal(err)
+	}
+	expect("a", 3, false)
+	expect("b", 3, true)
+	expect("", 6, false)
+
+	// a stream within its limit counts exactly, the store still may not
+	if err := es.SetStreamMetadata(db, "b", StreamMetadata{MaxCount: 5}); err != nil {
+		t.Fatal(err)
+	}
+	expect("b", 3, true)
+	expect("", 6, false)
+
+	for _, stream := range []string{"a", "b"} {
+		if err := es.SetStreamMetadata(db, stream, StreamMetadata{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	expect("a", 3, true)
+	expect("", 6, true)
+}
+
+func TestRecount(t *testing.T) {
+	db, sub := fdbtest.Open(t)
+	es := New(sub)
+
+	// more than a page, so the count spans transactions
+	const n = recountPage + recountPage/2
+	records := make([]EventRecord, n)
+	for i := range records {
+		records[i] = EventRecord{Contract: "C"}
+	}
+	if err := es.Append(db, "a", ExpectedNoStream, records); err != nil {
+		t.Fatal(err)
+	}
+	if err := es.Append(db, "b", ExpectedNoStream, records[:10]); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err := db.Transact(func(tr fdb.Transaction) (interface{}, error) {
+		es.count(tr, "a", 42)
+		return nil, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if counted, _, err := es.CountStream(db, "a"); err != nil || counted != n+42 {
+		t.Fatalf("drifted count %d, %v", counted, err)
+	}
+
+	actual, err := es.Recount(db, "a")
+	if err != nil || actual != n {
+		t.Fatalf("recounted %d, %v; want %d", actual, err, n)
+	}
+	if counted, exact, err := es.CountStream(db, "a"); err != nil || counted != n || !exact {
+		t.Fatalf("count after Recount %d, exact %v, %v", counted, exact, err)
+	}
+	if total, _, err := es.CountAll(db); err != nil || total != n+10 {
+		t.Fatalf("total after Recount %d, %v", total, err)
+	}
+
+	// a deleted stream recounts to nothing
+	if err := es.DeleteStream(db, "b"); err != nil {
+		t.Fatal(err)
+	}
+	if actual, err := es.Recount(db, "b"); err != nil || actual != 0 {
+		t.Fatalf("recounted %d events of a deleted stream, %v", actual, err)
+	}
+	if total, _, err := es.CountAll(db); err != nil || total != n {
+		t.Fatalf("total after the delete %d, %v", total, err)
+	}
+}
@@ -0,0 +1,74 @@
+package eventstore
+
+import "github.com/FoundationDB/fdb-go/fdb"
+
+// Encryptor encrypts payloads at rest, e.g. with keys of an external KMS.
+// It is applied to Data and Meta of every event on top of the data keys
+// of MasterKey. Events stored before it was set are read as they are.
+type Encryptor interface {
+	Encrypt(stream string, plaintext []byte) ([]byte, error)
+	Decrypt(stream string, ciphertext []byte) ([]byte, error)
+}
+
+// VersionedEncryptor is an Encryptor that rotates keys. The version of
+// the key is stored with every event it encrypted and passed back when
+// decrypting it.
+type VersionedEncryptor interface {
+	Encryptor
+	KeyVersion(stream string) string
+	DecryptVersion(stream, keyVersion string, ciphertext []byte) ([]byte, error)
+}
+
+// seal encodes the payload of an envelope for storage
+func (es *EventStore) seal(tr fdb.Transaction, stream string, env *envelope) error {
+	if err := es.sealStreamKey(tr, stream, env); err != nil {
+		return err
+	}
+	if es.Encryptor == nil {
+		return nil
+	}
+
+	var err error
+	if len(env.data) > 0 {
+		if env.data, err = es.Encryptor.Encrypt(stream, env.data); err != nil {
+			return err
+		}
+	}
+	if len(env.meta) > 0 {
+		if env.meta, err = es.Encryptor.Encrypt(stream, env.meta); err != nil {
+			return err
+		}
+	}
+	if v, ok := es.Encryptor.(VersionedEncryptor); ok {
+		env.keyVer = v.KeyVersion(stream)
+	}
+	env.codec |= codecEncryptor
+	return nil
+}
+
+// open decodes the payload of an envelope read from storage
+func (es *EventStore) open(tr fdb.Transaction, stream string, env *envelope) error {
+	if env.codec&codecEncryptor != 0 {
+		if es.Encryptor == nil {
+			return ErrNoEncryptor
+		}
+		var err error
+		if env.data, err = es.decrypt(stream, env.keyVer, env.data); err != nil {
+			return err
+		}
+		if env.meta, err = es.decrypt(stream, env.keyVer, env.meta); err != nil {
+			return err
+		}
+	}
+	return es.openStreamKey(tr, stream, env)
+}
+
+func (es *EventStore) decrypt(stream, keyVersion string, b []byte) ([]byte, error) {
+	if len(b) == 0 {
+		return b, nil
+	}
+	if v, ok := es.Encryptor.(VersionedEncryptor); ok {
+		return v.DecryptVersion(stream, keyVersion, b)
+	}
+	return es.Encryptor.Decrypt(stream, b)
+}
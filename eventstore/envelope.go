@@ -0,0 +1,176 @@
+package eventstore
+
+import (
+	"errors"
+	"github.com/FoundationDB/fdb-go/fdb"
+	"github.com/FoundationDB/fdb-go/fdb/tuple"
+	"time"
+)
+
+// Every copy of an event is stored in a single value:
+//
+//	versionstamp (10 bytes) | format (1 byte) | tuple of (tag, value) pairs
+//
+// The versionstamp is filled in by the database for the stream copy and
+// left zero in the global copy, whose key already holds it. It leads the
+// value since before API version 520 the database writes versionstamps
+// only at the start of values. Archive pointers share the header with a
+// format of their own. Readers skip
+// tags they don't know and missing tags keep their zero value, so fields
+// can be added without rewriting old events.
+
+const envelopeFormat = 1
+
+const (
+	tagContract   = 1
+	tagData       = 2
+	tagMeta       = 3
+	tagCreated    = 4 // unix seconds, in events written before tagCreatedNano
+	tagCodec      = 5 // flags of how Data and Meta are encoded
+	tagKeyVersion = 6 // key of the Encryptor used, if it tells
+	tagEventID    = 7
+	// tagCreatedNano is the creation time in unix nanoseconds. Ordering
+	// comes from versions and versionstamps, never from this time.
+	tagCreatedNano = 8
+)
+
+// Codec flags, plain if none
+const (
+	codecPlain     = 0
+	codecStreamKey = 1 // encrypted with the data key of the stream
+	codecEncryptor = 2 // encrypted by the Encryptor of the store
+)
+
+var errBadEnvelope = errors.New("malformed event envelope")
+
+type envelope struct {
+	id       string
+	contract string
+	data     []byte
+	meta     []byte
+	created  int64 // unix seconds
+	nanos    int64 // unix nanoseconds, zero in old events
+	codec    int64
+	keyVer   string
+	stamp    []byte
+}
+
+func (e envelope) encode() []byte {
+	t := tuple.Tuple{
+		int64(tagContract), e.contract,
+		int64(tagData), e.data,
+		int64(tagCreatedNano), e.nanos,
+	}
+	// absent meta reads back as nil, empty meta as empty
+	if e.meta != nil {
+		t = append(t, int64(tagMeta), e.meta)
+	}
+	if e.codec != codecPlain {
+		t = append(t, int64(tagCodec), e.codec)
+	}
+	if e.keyVer != "" {
+		t = append(t, int64(tagKeyVersion), e.keyVer)
+	}
+	if e.id != "" {
+		t = append(t, int64(tagEventID), e.id)
+	}
+	return concat(make([]byte, stampLen), []byte{envelopeFormat}, t.Pack())
+}
+
+// stampOffset is where the versionstamp placeholder sits in a stored value
+const stampOffset = 0
+
+// headerLen is the size of the versionstamp and format starting a value
+const headerLen = stampLen + 1
+
+// valueFormat returns the format of a stored value, zero if it has none
+func valueFormat(b []byte) byte {
+	if len(b) < headerLen {
+		return 0
+	}
+	return b[stampLen]
+}
+
+func decodeEnvelope(b []byte) (e envelope, err error) {
+	if valueFormat(b) != envelopeFormat {
+		return e, errBadEnvelope
+	}
+	e.stamp = b[stampOffset : stampOffset+stampLen]
+
+	t, err := tuple.Unpack(b[headerLen:])
+	if err != nil || len(t)%2 != 0 {
+		return e, errBadEnvelope
+	}
+
+	for i := 0; i < len(t); i += 2 {
+		tag, ok := t[i].(int64)
+		if !ok {
+			return e, errBadEnvelope
+		}
+		switch v := t[i+1].(type) {
+		case string:
+			switch tag {
+			case tagContract:
+				e.contract = v
+			case tagKeyVersion:
+				e.keyVer = v
+			case tagEventID:
+				e.id = v
+			}
+		case []byte:
+			switch tag {
+			case tagData:
+				e.data = v
+			case tagMeta:
+				e.meta = v
+			}
+		case int64:
+			switch tag {
+			case tagCreated:
+				e.created = v
+			case tagCreatedNano:
+				e.nanos = v
+				e.created = time.Unix(0, v).Unix()
+			case tagCodec:
+				e.codec = v
+			}
+		}
+	}
+	if e.nanos == 0 && len(e.meta) == 0 {
+		// old events stored meta even when there was none
+		e.meta = nil
+	}
+	return e, nil
+}
+
+func (e envelope) recorded(stream string, version int64) RecordedEvent {
+	created := time.Unix(e.created, 0).UTC()
+	if e.nanos != 0 {
+		created = time.Unix(0, e.nanos).UTC()
+	}
+	return RecordedEvent{
+		EventID:       e.id,
+		Contract:      e.contract,
+		Data:          e.data,
+		Meta:          e.meta,
+		StreamName:    stream,
+		StreamVersion: version,
+		CreatedAt:     created,
+	}
+}
+
+// openEnvelope decodes an envelope read from the stream, following it
+// into the archive, and decrypts its payload
+func (es *EventStore) openEnvelope(tr fdb.Transaction, b []byte, stream string) (envelope, error) {
+	if valueFormat(b) == pointerFormat {
+		var err error
+		if b, err = es.unarchive(tr, b); err != nil {
+			return envelope{}, err
+		}
+	}
+	env, err := decodeEnvelope(b)
+	if err != nil {
+		return env, err
+	}
+	return env, es.open(tr, stream, &env)
+}
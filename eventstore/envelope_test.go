@@ -0,0 +1,41 @@
+package eventstore
+
+import (
+	"bytes"
+	"github.com/FoundationDB/fdb-go/fdb/tuple"
+	"github.com/abdullin/go-layers/versionstamp"
+	"testing"
+)
+
+func TestEnvelopeLayout(t *testing.T) {
+	e := envelope{id: "id", contract: "C", data: []byte("data"), meta: []byte{}, nanos: 1500000000123456789}
+	b := e.encode()
+
+	// the stream copy is versionstamped, which the bindings before API
+	// version 520 only do at the start of a value
+	if _, err := versionstamp.Value(append([]byte(nil), b...), stampOffset); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(b[stampOffset:stampOffset+stampLen], make([]byte, stampLen)) {
+		t.Fatalf("no placeholder at the offset of %x", b)
+	}
+
+	copy(b[stampOffset:], "0123456789")
+	d, err := decodeEnvelope(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(d.stamp) != "0123456789" || d.id != e.id || d.contract != e.contract || string(d.data) != "data" || d.meta == nil || len(d.meta) != 0 || d.nanos != e.nanos {
+		t.Fatalf("decoded %+v", d)
+	}
+	if _, err := decodeEnvelope(b[:headerLen-1]); err != errBadEnvelope {
+		t.Fatalf("decoded a short value with %v", err)
+	}
+
+	// pointers share the header
+	pointer := concat([]byte("0123456789"), []byte{pointerFormat}, tuple.Tuple{[]byte("block"), int64(3)}.Pack())
+	id, index, err := decodePointer(pointer)
+	if err != nil || string(id) != "block" || index != 3 {
+		t.Fatalf("decoded pointer as %q, %d, %v", id, index, err)
+	}
+}
@@ -1,11 +1,14 @@
 package eventstore
 
 import (
-	_ "bytes"
 	"crypto/rand"
+	"errors"
 	"github.com/FoundationDB/fdb-go/fdb"
 	"github.com/FoundationDB/fdb-go/fdb/subspace"
-	_ "sync"
+	"github.com/FoundationDB/fdb-go/fdb/tuple"
+	"github.com/abdullin/go-layers/stringintern"
+	"github.com/abdullin/go-layers/subspaces"
+	"github.com/abdullin/go-layers/versionstamp"
 	"time"
 )
 
@@ -19,56 +22,387 @@ func nextRandom() []byte {
 	}
 }
 
+// EventRecord is an event to be appended
 type EventRecord struct {
-	contract string
+	Contract string
 	Data     []byte
 	Meta     []byte
+	// EventID identifies the event across the store, a ULID is
+	// generated if empty
+	EventID string
+}
+
+// RecordedEvent is an event as returned by reads
+type RecordedEvent struct {
+	EventID        string
+	Contract       string
+	Data           []byte
+	Meta           []byte
+	StreamName     string
+	StreamVersion  int64
+	GlobalPosition Position
+	CreatedAt      time.Time
+}
+
+// ToRecord returns the part of the event that was appended
+func (e RecordedEvent) ToRecord() EventRecord {
+	return EventRecord{e.Contract, e.Data, e.Meta, e.EventID}
+}
+
+// FromRecord returns a record as it would be read back from the stream
+// at the given version
+func FromRecord(r EventRecord, stream string, version int64) RecordedEvent {
+	return RecordedEvent{
+		EventID:       r.EventID,
+		Contract:      r.Contract,
+		Data:          r.Data,
+		Meta:          r.Meta,
+		StreamName:    stream,
+		StreamVersion: version,
+	}
 }
 
 type EventStore struct {
-	space subspace.Subspace
+	Serializer Serializer // payload encoding of AppendValues and Decode
+	Types      *Registry  // contract to Go type mapping
+	// SnapshotsToKeep is the number of latest snapshots kept per stream
+	SnapshotsToKeep int
+	// RetryPolicy limits retries of conflicting appends, nil retries
+	// them like db.Transact
+	RetryPolicy *RetryPolicy
+	// MaxEventSize limits Data plus Meta of appended records, capped at
+	// DefaultMaxEventSize
+	MaxEventSize int
+	// IdempotencyWindow is how long idempotency tokens of appends are
+	// remembered
+	IdempotencyWindow time.Duration
+	// Keys enables encryption of payloads with a data key per stream,
+	// which ShredStream deletes to erase the stream
+	Keys MasterKey
+	// Encryptor encrypts payloads at rest
+	Encryptor Encryptor
+	// Strings interns stream names in index entries. Once entries were
+	// written with it, it has to stay set for them to be read.
+	Strings *stringintern.StringIntern
+	// ChannelBuffer is the buffer of channels of StreamEvents and
+	// AllEvents, zero for unbuffered
+	ChannelBuffer int
+
+	interceptors     []Interceptor
+	readInterceptors []ReadInterceptor
+	commitHooks      []CommitHook
+	versions         *versionCache
+	upcasters        map[string][]Upcaster
+
+	space     subspace.Subspace
+	global    subspace.Subspace // versionstamp + (stream, version) -> envelope
+	streams   subspace.Subspace // stream -> last written version
+	events    subspace.Subspace // (stream, version) -> envelope
+	metadata  subspace.Subspace // stream -> StreamMetadata before metadata streams
+	cursors   subspace.Subspace // job name -> resume position
+	counters  subspace.Subspace // event counts per stream and in total
+	snapshots subspace.Subspace // (stream, version) -> snapshot
+	byTime    subspace.Subspace // (minute) + position -> created
+
+	persistent subspace.Subspace // group -> filter, checkpoint and queue
+	config     subspace.Subspace // store-wide settings
+	tokens     subspace.Subspace // idempotency token -> append result
+	notify     subspace.Subspace // stream -> counter bumped by appends
+	tenants    subspace.Subspace // tenant -> store of the tenant
+	keys       subspace.Subspace // stream -> wrapped data key
+	consumers  subspace.Subspace // consumer group -> checkpoint
+	archive    subspace.Subspace // block id -> packed envelopes
+	ids        subspace.Subspace // event id -> (stream, version)
 }
 
-func (es *EventStore) Clear(db fdb.Database) {
+// New event store is created within a given subspace
+func New(space subspace.Subspace) *EventStore {
+	return &EventStore{
+		Serializer:        JSONSerializer{},
+		Types:             NewRegistry(),
+		SnapshotsToKeep:   1,
+		MaxEventSize:      DefaultMaxEventSize,
+		IdempotencyWindow: DefaultIdempotencyWindow,
+
+		space:     space,
+		global:    space.Sub("glob"),
+		streams:   space.Sub("streams"),
+		events:    space.Sub("stream"),
+		metadata:  space.Sub("meta"),
+		cursors:   space.Sub("cursor"),
+		counters:  space.Sub("count"),
+		snapshots: space.Sub("snap"),
+		byTime:    space.Sub("time"),
+
+		persistent: space.Sub("psub"),
+		config:     space.Sub("config"),
+		tokens:     space.Sub("idem"),
+		notify:     space.Sub("notify"),
+		tenants:    space.Sub("tenant"),
+		keys:       space.Sub("keys"),
+		consumers:  space.Sub("consumer"),
+		archive:    space.Sub("archive"),
+		ids:        space.Sub("id"),
+	}
+}
 
-	db.Transact(func(tr fdb.Transaction) (interface{}, error) {
+// Clear removes all events together with indexes, counters and metadata,
+// and the stores of all tenants: everything the store keeps is in its
+// subspace. Watchers of the notification keys wake up as they are
+// cleared.
+func (es *EventStore) Clear(db fdb.Transactor) error {
+	_, err := db.Transact(func(tr fdb.Transaction) (interface{}, error) {
 		tr.ClearRange(es.space)
 		return nil, nil
 	})
+	return err
+}
 
+// Append records to the stream if it is at the expected version, which
+// is either the version of its last event or one of ExpectedAny,
+// ExpectedNoStream and ExpectedStreamExists. A mismatch fails with
+// *WrongExpectedVersion, and running out of the RetryPolicy with
+// *ErrTooMuchContention. Records without a valid contract fail with
+// *ErrInvalidEvent and those over MaxEventSize with *ErrEventTooLarge
+// before anything is written.
+func (es *EventStore) Append(db fdb.Database, stream string, expectedVersion int64, records []EventRecord) error {
+	return es.appendChecked(db, stream, expectedVersion, records, nil)
 }
 
-func (es *EventStore) Append(db fdb.Database, stream string, records []EventRecord) {
+// appendChecked is Append that first runs check, if given, in every
+// attempt of the transaction
+func (es *EventStore) appendChecked(db fdb.Database, stream string, expectedVersion int64, records []EventRecord, check func(fdb.Transaction) error) error {
+	if err := es.checkRecords(stream, records); err != nil {
+		return err
+	}
+
+	var written []EventRecord
+	var stamp fdb.FutureKey
+	var state streamState
+	var token []byte
+	v, _, err := es.transact(db, func(tr fdb.Transaction) (interface{}, error) {
+		if check != nil {
+			if err := check(tr); err != nil {
+				return nil, err
+			}
+		}
+		var versions []int64
+		var err error
+		if cached, ok := es.versions.get(stream); ok && matchesExpected(expectedVersion, cached.version) {
+			state = cached
+			written, versions, err = es.appendCached(tr, stream, cached, records)
+		} else {
+			if es.versions != nil {
+				// read before the writes, for the cache to use on the next append
+				if state.meta, state.metaVersion, err = es.loadMetadata(tr, stream); err != nil {
+					return nil, err
+				}
+			}
+			if err = es.checkExpected(tr, stream, expectedVersion); err == nil {
+				written, versions, err = es.appendStream(tr, stream, records, false)
+			}
+		}
+		if err != nil {
+			return nil, err
+		}
+		token = es.streamToken(tr, stream)
+		if len(es.commitHooks) > 0 {
+			// positions for the hooks
+			stamp = tr.GetVersionstamp()
+		}
+		return versions, nil
+	})
 
-	rand := nextRandom()
+	var wrong *WrongExpectedVersion
+	switch {
+	case err == nil:
+		if versions := v.([]int64); len(versions) > 0 {
+			state.version = versions[len(versions)-1]
+			es.versions.put(stream, state)
+			es.internCommitted(stream, token)
+			es.notifyCommitted(stamp, stream, written, versions)
+		}
+	case errors.As(err, &wrong):
+		state.version = wrong.Actual
+		es.versions.put(stream, state)
+	}
+	return err
 
-	globalSpace := es.space.Sub("glob", rand)
+}
 
-	// TODO add random key to reduce contention
+// AppendTr appends records to the stream as part of the caller's
+// transaction, leaving commit and retries to the caller, and returns the
+// versions given to the records.
+//
+// Global positions are assigned by the database at commit, so they are
+// only known after the transaction commits: request tr.GetVersionstamp()
+// before committing and pass it to Positions afterwards.
+func (es *EventStore) AppendTr(tr fdb.Transaction, stream string, records []EventRecord) ([]int64, error) {
+	return es.appendTr(tr, stream, records)
+}
 
-	_, err := db.Transact(func(tr fdb.Transaction) (interface{}, error) {
+// appendTr writes records to the end of the stream and to the global
+// space, returning their versions
+func (es *EventStore) appendTr(tr fdb.Transaction, stream string, records []EventRecord) ([]int64, error) {
+	_, versions, err := es.appendStream(tr, stream, records, false)
+	return versions, err
+}
+
+// appendStream is appendTr that recreates a deleted stream if asked to,
+// continuing after its tombstone. It also returns the records as written.
+func (es *EventStore) appendStream(tr fdb.Transaction, stream string, records []EventRecord, recreate bool) ([]EventRecord, []int64, error) {
+	if err := validateStreamName(stream, true); err != nil {
+		return nil, nil, err
+	}
+	meta, err := es.getMetadata(tr, stream)
+	if err != nil {
+		return nil, nil, err
+	}
+	if meta.Deleted && !recreate {
+		return nil, nil, ErrStreamDeleted
+	}
 
-		// TODO : use get next index to sort them more nicely
+	if records, err = es.prepareRecords(stream, records); err != nil {
+		return nil, nil, err
+	}
+	versions, err := es.writeEventsMeta(tr, stream, meta, es.lastVersion(tr, stream), records, time.Now())
+	if err != nil || !meta.Deleted || len(versions) == 0 {
+		return records, versions, err
+	}
 
-		for _, evt := range records {
+	// written after the events, as the metadata event can't be read back
+	// in the transaction that wrote it
+	meta.Deleted = false
+	tr.Add(es.streamsCounter(), encodeCounter(1))
+	return records, versions, es.setMetadata(tr, stream, meta)
+}
 
-			gKey := globalSpace.Sub(time.Now().Unix(), evt.contract)
-			//sKey := streamSpace.Item(tuple.Tuple{time.Now().Unix(), evt.contract})
+// prepareRecords runs the interceptors and gives ids to records without
+// one, copying the batch rather than changing the caller's records
+func (es *EventStore) prepareRecords(stream string, records []EventRecord) ([]EventRecord, error) {
+	records, err := es.interceptAppend(stream, records)
+	if err != nil {
+		return nil, err
+	}
+	prepared := make([]EventRecord, len(records))
+	for i, r := range records {
+		if r.EventID == "" {
+			r.EventID = newEventID()
+		}
+		prepared[i] = r
+	}
+	return prepared, nil
+}
 
-			// TODO - join data and meta
-			tr.Set(gKey.Sub("data"), evt.Data)
-			tr.Set(gKey.Sub("meta"), evt.Meta)
-			//tr.Set(sKey.Item(tuple.Tuple{"data"}).AsFoundationDbKey(), evt.Data)
-			//tr.Set(sKey.Item(tuple.Tuple{"meta"}).AsFoundationDbKey(), evt.Meta)
+// writeEventsMeta appends records as they are after the last version,
+// bypassing interceptors, creating the events at now. meta is the
+// metadata of the stream, which callers have loaded already.
+//
+// Events of a batch share the versionstamp of the transaction, and the
+// rest of their global keys is (stream, version), so within a stream the
+// batch reads back in slice order from both the stream and the global
+// space. They also share a creation time, keeping the time index in the
+// same order.
+func (es *EventStore) writeEventsMeta(tr fdb.Transaction, stream string, meta StreamMetadata, last int64, records []EventRecord, now time.Time) ([]int64, error) {
+	// metadata streams are not counted, indexed or watched, they only hold
+	// the metadata of their stream
+	user := !isMetadataStream(stream)
+	first := last + 1
+	if user && first == 0 && len(records) > 0 {
+		tr.Add(es.streamsCounter(), encodeCounter(1))
+	}
+	if meta.MaxLength > 0 && first+int64(len(records)) > meta.MaxLength {
+		return nil, &ErrStreamTooLong{stream, meta.MaxLength}
+	}
+	versions := make([]int64, len(records))
+
+	// keys of the batch differ only in the version, and the binding copies
+	// what it is given, so they are built in buffers reused for every event
+	gPrefix := concat(es.global.Bytes(), make([]byte, stampLen), tuple.Tuple{stream}.Pack())
+	sPrefix := es.events.Sub(stream).Bytes()
+	gKey := make([]byte, 0, len(gPrefix)+16)
+	sKey := make([]byte, 0, len(sPrefix)+16)
+	created := now.Unix()
 
+	for i, evt := range records {
+
+		version := first + int64(i)
+		v := tuple.Tuple{version}.Pack()
+		gKey = append(append(gKey[:0], gPrefix...), v...)
+		sKey = append(append(sKey[:0], sPrefix...), v...)
+		id := evt.EventID
+		if id == "" {
+			id = newEventID()
+		}
+		e := envelope{id: id, contract: evt.Contract, data: evt.Data, meta: evt.Meta, created: created, nanos: now.UnixNano()}
+		if err := es.seal(tr, stream, &e); err != nil {
+			return nil, err
+		}
+		env := e.encode()
+		if len(env) > maxValueBytes {
+			// escaping in the tuple or an interceptor grew the record
+			return nil, &ErrEventTooLarge{stream, i, len(env), maxValueBytes}
 		}
 
-		return nil, nil
+		val, err := versionstamp.Value(env, stampOffset)
+		if err != nil {
+			return nil, err
+		}
+		tr.SetVersionstampedKey(fdb.Key(versionstamp.Key(gKey, len(es.global.Bytes()))), env)
+		tr.SetVersionstampedValue(fdb.Key(sKey), val)
+		if user {
+			if err := es.indexTime(tr, stream, version, created); err != nil {
+				return nil, err
+			}
+			if err := es.indexEventID(tr, id, stream, version); err != nil {
+				return nil, err
+			}
+		}
 
-	})
+		versions[i] = version
+	}
 
-	if err != nil {
-		panic(err)
+	if len(records) > 0 {
+		es.setHead(tr, stream, versions[len(versions)-1])
+		if user {
+			es.count(tr, stream, int64(len(records)))
+			subspaces.Bump(tr, es.notifySpace(stream))
+		}
 	}
 
+	return versions, nil
+}
+
+// setHead moves the head of the stream to the version. Heads hold
+// (version, created, updated) with times in unix seconds; heads written
+// before the times were kept have only the version.
+func (es *EventStore) setHead(tr fdb.Transaction, stream string, version int64) {
+	key := es.streams.Pack(tuple.Tuple{stream})
+	now := time.Now().Unix()
+	created := now
+	if val := tr.Get(key).GetOrPanic(); val != nil {
+		created = 0
+		if t, err := tuple.Unpack(val); err == nil && len(t) > 1 {
+			created = t[1].(int64)
+		}
+	}
+	tr.Set(key, tuple.Tuple{version, created, now}.Pack())
+}
+
+// lastVersion returns the version of the last event written to the stream
+// or -1 if there is none. Versions start at 0
+func (es *EventStore) lastVersion(tr fdb.Transaction, stream string) int64 {
+	val := tr.Get(es.streams.Pack(tuple.Tuple{stream})).GetOrPanic()
+	if val == nil {
+		return -1
+	}
+	return decodeInt(val)
+}
+
+func decodeInt(val []byte) int64 {
+	if t, err := tuple.Unpack(val); err != nil {
+		panic(err)
+	} else {
+		return t[0].(int64)
+	}
 }
@@ -0,0 +1,249 @@
+package eventstore
+
+import (
+	"bytes"
+	"github.com/FoundationDB/fdb-go/fdb"
+	"github.com/FoundationDB/fdb-go/fdb/tuple"
+	"github.com/abdullin/go-layers/internal/fdbtest"
+	"github.com/abdullin/go-layers/versionstamp"
+	"strconv"
+	"testing"
+)
+
+// sameContract returns n records of one contract, told apart by data
+func sameContract(n int) []EventRecord {
+	records := make([]EventRecord, n)
+	for i := range records {
+		records[i] = EventRecord{Contract: "Same", Data: []byte(strconv.Itoa(i))}
+	}
+	return records
+}
+
+func TestAppendSameContract(t *testing.T) {
+	db, sub := fdbtest.Open(t)
+	es := New(sub)
+
+	// one call, so one second and one contract for every event
+	if err := es.Append(db, "s", ExpectedAny, sameContract(100)); err != nil {
+		t.Fatal(err)
+	}
+	events, err := es.ReadStream(db, "s", ReadOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 100 {
+		t.Fatalf("read %d events, want 100", len(events))
+	}
+	all, _, err := es.ReadAll(db, StartPosition, 0, Filter{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(all) != 100 {
+		t.Fatalf("read %d events of all streams, want 100", len(all))
+	}
+}
+
+func TestClear(t *testing.T) {
+	db, sub := fdbtest.Open(t)
+	es := New(sub)
+
+	for _, stream := range []string{"a", "b"} {
+		if err := es.Append(db, stream, ExpectedAny, sameContract(3)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := es.ForTenant("t").Append(db, "a", ExpectedAny, sameContract(1)); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := es.Clear(db); err != nil {
+		t.Fatal(err)
+	}
+
+	events, _, err := es.ReadAll(db, StartPosition, 0, Filter{})
+	if err != nil || len(events) != 0 {
+		t.Fatalf("read %d events after clearing, %v", len(events), err)
+	}
+	if events, err = es.ReadStream(db, "a", ReadOptions{}); err != nil || len(events) != 0 {
+		t.Fatalf("read %d events of a stream after clearing, %v", len(events), err)
+	}
+	stats, err := es.Stats(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Streams != 0 || stats.Events != 0 || stats.LastPosition != nil {
+		t.Fatalf("stats after clearing %+v", stats)
+	}
+
+	v, err := db.Transact(func(tr fdb.Transaction) (interface{}, error) {
+		return tr.GetRange(sub, fdb.RangeOptions{Limit: 1}).GetSliceWithError()
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if kvs := v.([]fdb.KeyValue); len(kvs) != 0 {
+		t.Fatalf("stray key %s after clearing", fdb.Printable(kvs[0].Key))
+	}
+
+	// the store works as new
+	if err := es.Append(db, "a", ExpectedNoStream, sameContract(1)); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestAppendBatchOrder(t *testing.T) {
+	db, sub := fdbtest.Open(t)
+	es := New(sub)
+
+	const n = 1000
+	if err := es.Append(db, "s", ExpectedAny, sameContract(n)); err != nil {
+		t.Fatal(err)
+	}
+
+	stream, err := es.ReadStream(db, "s", ReadOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	all, _, err := es.ReadAll(db, StartPosition, 0, Filter{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, events := range map[string][]RecordedEvent{"stream": stream, "all": all} {
+		if len(events) != n {
+			t.Fatalf("read %d events of %s, want %d", len(events), name, n)
+		}
+		for i, evt := range events {
+			if string(evt.Data) != strconv.Itoa(i) || evt.StreamVersion != int64(i) {
+				t.Fatalf("event %d of %s is %q at version %d", i, name, evt.Data, evt.StreamVersion)
+			}
+		}
+	}
+}
+
+// every kind of write versionstamps the stream copy of its events, which
+// the default API version only allows at the start of values
+func TestWritesAtDefaultAPIVersion(t *testing.T) {
+	db, sub := fdbtest.Open(t)
+	if fdbtest.APIVersion() != versionstamp.DefaultAPIVersion {
+		t.Skip("needs the tests at the default API version")
+	}
+	es := New(sub)
+
+	if err := es.Append(db, "a", ExpectedNoStream, sameContract(2)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := es.AppendMulti(db, []StreamAppend{{"b", ExpectedAny, sameContract(1)}, {"c", ExpectedAny, sameContract(1)}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := es.SetStreamMetadata(db, "a", StreamMetadata{MaxCount: 10}); err != nil {
+		t.Fatal(err)
+	}
+	if err := es.DeleteStream(db, "c"); err != nil {
+		t.Fatal(err)
+	}
+
+	var stamp fdb.FutureKey
+	v, err := db.Transact(func(tr fdb.Transaction) (interface{}, error) {
+		stamp = tr.GetVersionstamp()
+		return es.AppendTr(tr, "a", sameContract(1))
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	positions, err := Positions(stamp, "a", v.([]int64))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	events, err := es.ReadStream(db, "a", ReadOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 3 || string(events[2].GlobalPosition) != string(positions[0]) {
+		t.Fatalf("read %d events, the last at %x, appended at %x", len(events), events[len(events)-1].GlobalPosition, positions[0])
+	}
+}
+
+func TestStats(t *testing.T) {
+	db, sub := fdbtest.Open(t)
+	es := New(sub)
+
+	// streams of different sizes, all clustered behind the prefixes of
+	// the store
+	for s := 0; s < 5; s++ {
+		records := sameContract(200)
+		for i := range records {
+			records[i].Data = make([]byte, 100*(s+1))
+		}
+		if err := es.Append(db, "stream-"+strconv.Itoa(s), ExpectedNoStream, records); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	stats, err := es.Stats(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Streams != 5 || stats.Events != 1000 || stats.LastPosition == nil || stats.LastAppend.IsZero() {
+		t.Fatalf("stats %+v", stats)
+	}
+
+	v, err := db.Transact(func(tr fdb.Transaction) (interface{}, error) {
+		return tr.GetRange(sub, fdb.RangeOptions{}).GetSliceWithError()
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var size int64
+	for _, kv := range v.([]fdb.KeyValue) {
+		size += int64(len(kv.Key) + len(kv.Value))
+	}
+	if stats.ApproxBytes < size/2 || stats.ApproxBytes > size*2 {
+		t.Fatalf("%d bytes estimated at %d", size, stats.ApproxBytes)
+	}
+}
+
+func TestAppendKeys(t *testing.T) {
+	db, sub := fdbtest.Open(t)
+	es := New(sub)
+
+	// a name that is escaped in tuples, and versions past the one byte
+	// integer encoding
+	const stream, n = "a\x00b", 300
+	if err := es.Append(db, stream, ExpectedNoStream, sameContract(n)); err != nil {
+		t.Fatal(err)
+	}
+
+	v, err := db.Transact(func(tr fdb.Transaction) (interface{}, error) {
+		events, err := tr.GetRange(es.events.Sub(stream), fdb.RangeOptions{}).GetSliceWithError()
+		if err != nil {
+			return nil, err
+		}
+		global, err := tr.GetRange(es.global, fdb.RangeOptions{}).GetSliceWithError()
+		return [][]fdb.KeyValue{events, global}, err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	events, global := v.([][]fdb.KeyValue)[0], v.([][]fdb.KeyValue)[1]
+	if len(events) != n || len(global) != n {
+		t.Fatalf("%d stream keys and %d global keys for %d events", len(events), len(global), n)
+	}
+	prefix := len(es.global.Bytes())
+	for i := 0; i < n; i++ {
+		if want := es.events.Sub(stream).Pack(tuple.Tuple{int64(i)}); !bytes.Equal(events[i].Key, want) {
+			t.Fatalf("stream key %d is %s, want %s", i, fdb.Printable(events[i].Key), fdb.Printable(want))
+		}
+		key := global[i].Key
+		if !bytes.Equal(key[:prefix], es.global.Bytes()) {
+			t.Fatalf("global key %d is %s", i, fdb.Printable(key))
+		}
+		if want := (tuple.Tuple{stream, int64(i)}).Pack(); !bytes.Equal(key[prefix+stampLen:], want) {
+			t.Fatalf("global key %d ends in %s, want %s", i, fdb.Printable(key[prefix+stampLen:]), fdb.Printable(want))
+		}
+		// the stream key holds the versionstamp of the global key
+		if !bytes.Equal(events[i].Value[:stampLen], key[prefix:prefix+stampLen]) {
+			t.Fatalf("event %d stamped %x in its stream, %x globally", i, events[i].Value[:stampLen], key[prefix:prefix+stampLen])
+		}
+	}
+}
@@ -0,0 +1,143 @@
+package eventstore
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"github.com/FoundationDB/fdb-go/fdb"
+	"io"
+	"time"
+)
+
+// ExportedEvent is a single line of an export. Data and Meta are base64
+// encoded by encoding/json; absent Meta is null, so it stays apart from
+// empty Meta.
+type ExportedEvent struct {
+	Stream   string    `json:"stream"`
+	Version  int64     `json:"version"`
+	Contract string    `json:"contract"`
+	Data     []byte    `json:"data,omitempty"`
+	Meta     []byte    `json:"meta"`
+	Created  time.Time `json:"created"`
+	Position Position  `json:"position,omitempty"`
+	EventID  string    `json:"eventId,omitempty"`
+}
+
+func exported(evt RecordedEvent) ExportedEvent {
+	return ExportedEvent{evt.StreamName, evt.StreamVersion, evt.Contract, evt.Data, evt.Meta, evt.CreatedAt, evt.GlobalPosition, evt.EventID}
+}
+
+type ExportOptions struct {
+	// From resumes a global export after this position, usually the
+	// position of the last exported line
+	From Position
+	// Streams exports only these streams, one after another, instead of
+	// the whole store in global order
+	Streams []string
+	// BatchSize is the number of events read per transaction, 500 by
+	// default
+	BatchSize int
+}
+
+// Export writes events as JSON Lines to w, returning the number of events
+// written. Output is flushed after every batch.
+func (es *EventStore) Export(ctx context.Context, db fdb.Database, w io.Writer, opts ExportOptions) (int64, error) {
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = 500
+	}
+
+	bw := bufio.NewWriter(w)
+	enc := json.NewEncoder(bw)
+
+	if len(opts.Streams) > 0 {
+		return es.exportStreams(ctx, db, bw, enc, opts)
+	}
+
+	count, from := int64(0), opts.From
+	for {
+		if err := ctx.Err(); err != nil {
+			return count, err
+		}
+
+		var events []storedEvent
+		var next Position
+		_, err := db.Transact(func(tr fdb.Transaction) (interface{}, error) {
+			var err error
+			events, next, err = es.scanAll(tr, from, opts.BatchSize, Filter{IncludeMetadata: true})
+			return nil, err
+		})
+		if err != nil {
+			return count, err
+		}
+
+		for _, evt := range events {
+			if err := enc.Encode(exported(evt.RecordedEvent)); err != nil {
+				return count, err
+			}
+			count++
+		}
+		if err := bw.Flush(); err != nil {
+			return count, err
+		}
+
+		if bytes.Equal(next, from) {
+			return count, nil
+		}
+		from = next
+	}
+}
+
+func (es *EventStore) exportStreams(ctx context.Context, db fdb.Database, bw *bufio.Writer, enc *json.Encoder, opts ExportOptions) (int64, error) {
+	count := int64(0)
+
+	for _, stream := range opts.Streams {
+		for version := int64(0); ; version += int64(opts.BatchSize) {
+			if err := ctx.Err(); err != nil {
+				return count, err
+			}
+
+			var events []storedEvent
+			var last int64
+			_, err := db.Transact(func(tr fdb.Transaction) (interface{}, error) {
+				events = nil
+				meta, err := es.getMetadata(tr, stream)
+				if err != nil || meta.Deleted {
+					last = -1
+					return nil, err
+				}
+
+				now := time.Now().Unix()
+				last = es.lastVersion(tr, stream)
+				stored, err := es.scanStream(tr, stream, version, opts.BatchSize)
+				if err != nil {
+					return nil, err
+				}
+				for _, evt := range stored {
+					if meta.retains(evt.StreamVersion, evt.CreatedAt.Unix(), last, now) {
+						events = append(events, evt)
+					}
+				}
+				return nil, nil
+			})
+			if err != nil {
+				return count, err
+			}
+
+			for _, evt := range events {
+				if err := enc.Encode(exported(evt.RecordedEvent)); err != nil {
+					return count, err
+				}
+				count++
+			}
+			if err := bw.Flush(); err != nil {
+				return count, err
+			}
+
+			if version+int64(opts.BatchSize) > last {
+				break
+			}
+		}
+	}
+	return count, nil
+}
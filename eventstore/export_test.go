@@ -0,0 +1,67 @@
+package eventstore
+
+import (
+	"bytes"
+	"context"
+	"github.com/abdullin/go-layers/internal/fdbtest"
+	"testing"
+	"time"
+)
+
+func TestExportImport(t *testing.T) {
+	db, sub := fdbtest.Open(t)
+	from, to := New(sub.Sub("from")), New(sub.Sub("to"))
+
+	records := []EventRecord{
+		{Contract: "NoMeta", Data: []byte("1"), EventID: "id-1"},
+		{Contract: "EmptyMeta", Data: []byte("2"), Meta: []byte{}},
+		{Contract: "Meta", Data: []byte("3"), Meta: []byte("m")},
+	}
+	if err := from.Append(db, "s", ExpectedNoStream, records); err != nil {
+		t.Fatal(err)
+	}
+	if err := from.SetStreamMetadata(db, "s", StreamMetadata{MaxCount: 10}); err != nil {
+		t.Fatal(err)
+	}
+	// imported events are written later than the originals
+	time.Sleep(1100 * time.Millisecond)
+
+	var buf bytes.Buffer
+	n, err := from.Export(context.Background(), db, &buf, ExportOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	imported, err := to.Import(context.Background(), db, &buf, ImportOptions{})
+	if err != nil || imported != n {
+		t.Fatalf("imported %d of %d events, %v", imported, n, err)
+	}
+
+	want, err := from.ReadStream(db, "s", ReadOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := to.ReadStream(db, "s", ReadOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != len(want) {
+		t.Fatalf("read %d imported events, want %d", len(got), len(want))
+	}
+	for i := range want {
+		w, g := want[i], got[i]
+		if g.Contract != w.Contract || !bytes.Equal(g.Data, w.Data) || g.EventID != w.EventID || g.StreamVersion != w.StreamVersion {
+			t.Fatalf("event %d imported as %+v, want %+v", i, g, w)
+		}
+		if (g.Meta == nil) != (w.Meta == nil) || !bytes.Equal(g.Meta, w.Meta) {
+			t.Fatalf("meta of event %d imported as %q (nil %v), want %q (nil %v)", i, g.Meta, g.Meta == nil, w.Meta, w.Meta == nil)
+		}
+		if !g.CreatedAt.Equal(w.CreatedAt) {
+			t.Fatalf("event %d imported as created at %v, want %v", i, g.CreatedAt, w.CreatedAt)
+		}
+	}
+
+	meta, err := to.GetStreamMetadata(db, "s")
+	if err != nil || meta.MaxCount != 10 {
+		t.Fatalf("imported metadata %+v, %v", meta, err)
+	}
+}
@@ -0,0 +1,148 @@
+package eventstore
+
+import (
+	"github.com/FoundationDB/fdb-go/fdb"
+	"github.com/FoundationDB/fdb-go/fdb/tuple"
+	"github.com/abdullin/go-layers/versionstamp"
+	"time"
+)
+
+// DefaultIdempotencyWindow is how long tokens are remembered by default
+const DefaultIdempotencyWindow = 24 * time.Hour
+
+// AppendOptions are optional settings of AppendWithOptions
+type AppendOptions struct {
+	// IdempotencyToken identifies the append across retries. An append
+	// with a token already committed within the IdempotencyWindow of the
+	// store writes nothing and returns the result of the first one.
+	IdempotencyToken string
+	// AllowRecreate lets the append recreate a deleted stream instead of
+	// failing with ErrStreamDeleted. Versions continue after the
+	// tombstone and the events from before the delete stay hidden.
+	AllowRecreate bool
+}
+
+func (es *EventStore) tokenKey(token string) fdb.Key {
+	return es.tokens.Pack(tuple.Tuple{"token", token})
+}
+
+// AppendWithOptions appends like Append and reports where the records
+// went. With an idempotency token it is safe to retry after an ambiguous
+// commit, e.g. commit_unknown_result, or a lost connection.
+func (es *EventStore) AppendWithOptions(db fdb.Database, stream string, expectedVersion int64, records []EventRecord, opts AppendOptions) (WriteResult, error) {
+	if err := es.checkRecords(stream, records); err != nil {
+		return WriteResult{}, err
+	}
+
+	var stamp fdb.FutureKey
+	var recorded []byte
+	var written []EventRecord
+	v, retries, err := es.transact(db, func(tr fdb.Transaction) (interface{}, error) {
+		recorded = nil
+		if opts.IdempotencyToken != "" {
+			es.expireTokens(tr)
+			if recorded = es.recordedToken(tr, opts.IdempotencyToken); recorded != nil {
+				return nil, nil
+			}
+		}
+
+		if err := es.checkExpected(tr, stream, expectedVersion); err != nil {
+			return nil, err
+		}
+		w, versions, err := es.appendStream(tr, stream, records, opts.AllowRecreate)
+		written = w
+		if err != nil {
+			return nil, err
+		}
+		if opts.IdempotencyToken != "" && len(versions) > 0 {
+			es.recordToken(tr, opts.IdempotencyToken, stream, versions)
+		}
+		stamp = tr.GetVersionstamp()
+		return versions, nil
+	})
+	if err != nil {
+		return WriteResult{}, err
+	}
+
+	if recorded != nil {
+		return decodeToken(recorded)
+	}
+
+	result := WriteResult{Stream: stream, Versions: v.([]int64), Retries: retries}
+	if result.Positions, err = Positions(stamp, stream, result.Versions); err != nil {
+		return WriteResult{}, err
+	}
+	es.committed(stream, written, result.Versions, result.Positions)
+	return result, nil
+}
+
+// recordToken stores the result of an append under its token. The value
+// is the versionstamp of the transaction followed by (stream, first
+// version, count, expiry), and the token is indexed by expiry for cleanup.
+func (es *EventStore) recordToken(tr fdb.Transaction, token, stream string, versions []int64) {
+	window := es.IdempotencyWindow
+	if window <= 0 {
+		window = DefaultIdempotencyWindow
+	}
+	expires := time.Now().Add(window).Unix()
+
+	val := concat(make([]byte, stampLen), tuple.Tuple{stream, versions[0], int64(len(versions)), expires}.Pack())
+	// a placeholder at the start fits every API version
+	val, _ = versionstamp.Value(val, 0)
+	tr.SetVersionstampedValue(es.tokenKey(token), val)
+	tr.Set(es.tokens.Pack(tuple.Tuple{"expiry", expires, token}), nil)
+}
+
+// recordedToken returns the stored result of a token that hasn't expired
+func (es *EventStore) recordedToken(tr fdb.Transaction, token string) []byte {
+	val := tr.Get(es.tokenKey(token)).GetOrPanic()
+	if val == nil {
+		return nil
+	}
+	t, err := tuple.Unpack(val[stampLen:])
+	if err != nil {
+		panic(err)
+	}
+	if t[3].(int64) <= time.Now().Unix() {
+		return nil
+	}
+	return val
+}
+
+func decodeToken(val []byte) (WriteResult, error) {
+	t, err := tuple.Unpack(val[stampLen:])
+	if err != nil {
+		return WriteResult{}, err
+	}
+	stream, first, count := t[0].(string), t[1].(int64), t[2].(int64)
+
+	result := WriteResult{Stream: stream, Versions: make([]int64, count)}
+	result.Positions = make([]Position, count)
+	for i := range result.Versions {
+		result.Versions[i] = first + int64(i)
+		result.Positions[i] = Position(concat(val[:stampLen], tuple.Tuple{stream, result.Versions[i]}.Pack()))
+	}
+	return result, nil
+}
+
+// expireTokens lazily removes a few tokens past their expiry
+func (es *EventStore) expireTokens(tr fdb.Transaction) {
+	expiry := es.tokens.Sub("expiry")
+	begin, _ := expiry.FDBRangeKeys()
+	r := fdb.KeyRange{Begin: begin, End: expiry.Pack(tuple.Tuple{time.Now().Unix()})}
+
+	for _, kv := range tr.Snapshot().GetRange(r, fdb.RangeOptions{Limit: 10}).GetSliceOrPanic() {
+		t, err := expiry.Unpack(kv.Key)
+		if err != nil {
+			panic(err)
+		}
+		key := es.tokenKey(t[1].(string))
+		// the token may have been recorded again since
+		if val := tr.Get(key).GetOrPanic(); val != nil {
+			if v, err := tuple.Unpack(val[stampLen:]); err == nil && v[3].(int64) == t[0].(int64) {
+				tr.Clear(key)
+			}
+		}
+		tr.Clear(kv.Key)
+	}
+}
@@ -0,0 +1,95 @@
+package eventstore
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"github.com/FoundationDB/fdb-go/fdb"
+	"github.com/FoundationDB/fdb-go/fdb/tuple"
+	"time"
+)
+
+// crockford is the alphabet of ULIDs
+const crockford = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+
+// newEventID returns a ULID: 48 bits of unix milliseconds followed by 80
+// random bits in 26 characters, so ids sort roughly by creation time
+func newEventID() string {
+	var b [16]byte
+	binary.BigEndian.PutUint64(b[:8], uint64(time.Now().UnixNano()/int64(time.Millisecond))<<16)
+	if _, err := rand.Read(b[6:]); err != nil {
+		panic(err)
+	}
+
+	hi, lo := binary.BigEndian.Uint64(b[:8]), binary.BigEndian.Uint64(b[8:])
+	var id [26]byte
+	for i := len(id) - 1; i >= 0; i-- {
+		id[i] = crockford[lo&31]
+		lo = lo>>5 | hi<<59
+		hi >>= 5
+	}
+	return string(id[:])
+}
+
+func (es *EventStore) eventIDKey(id string) fdb.Key {
+	return es.ids.Pack(tuple.Tuple{id})
+}
+
+// indexEventID points the id at the event with a blind write. Reusing an
+// id moves it to the latest event.
+func (es *EventStore) indexEventID(tr fdb.Transaction, id, stream string, version int64) error {
+	ref, err := es.indexRef(tr, stream, version)
+	if err != nil {
+		return err
+	}
+	tr.Set(es.eventIDKey(id), ref)
+	return nil
+}
+
+// unindexEventID removes the id of an event unless it was reused since,
+// returning the size of the removed entry
+func (es *EventStore) unindexEventID(tr fdb.Transaction, evt RecordedEvent) (keys, bytes int) {
+	if evt.EventID == "" {
+		return 0, 0
+	}
+	key := es.eventIDKey(evt.EventID)
+	val := tr.Get(key).GetOrPanic()
+	if val == nil {
+		return 0, 0
+	}
+	for _, ref := range es.indexRefs(tr, evt.StreamName, evt.StreamVersion) {
+		if string(val) == string(ref) {
+			tr.Clear(key)
+			return 1, len(key) + len(val)
+		}
+	}
+	return 0, 0
+}
+
+// ReadEventByID returns the event with the id with a point lookup of the
+// id index. Events outside retention or of deleted streams are not found.
+func (es *EventStore) ReadEventByID(db fdb.Database, id string) (RecordedEvent, bool, error) {
+	v, err := db.Transact(func(tr fdb.Transaction) (interface{}, error) {
+		val := tr.Get(es.eventIDKey(id)).GetOrPanic()
+		if val == nil {
+			return nil, nil
+		}
+		stream, version, err := es.resolveRef(tr, val)
+		if err != nil {
+			return nil, err
+		}
+		evt, ok := es.readEvent(tr, StreamPosition{stream, version})
+		if !ok || evt.EventID != id {
+			return nil, nil
+		}
+		return evt, nil
+	})
+	if err != nil || v == nil {
+		return RecordedEvent{}, false, err
+	}
+
+	evt, err := es.interceptRead(v.(RecordedEvent))
+	if err != nil {
+		return RecordedEvent{}, false, err
+	}
+	return evt, true, nil
+}
@@ -0,0 +1,183 @@
+package eventstore
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/FoundationDB/fdb-go/fdb"
+	"io"
+	"time"
+)
+
+var ErrStreamExists = errors.New("stream already exists")
+
+type ImportOptions struct {
+	// SkipExisting skips streams that already have events instead of
+	// failing the import
+	SkipExisting bool
+	// BatchSize is the number of events written per transaction, 500 by
+	// default
+	BatchSize int
+}
+
+// ImportError reports the line of the input an import failed at
+type ImportError struct {
+	Line int
+	Err  error
+}
+
+func (e *ImportError) Error() string {
+	return fmt.Sprintf("line %d: %v", e.Line, e.Err)
+}
+
+func (e *ImportError) Unwrap() error {
+	return e.Err
+}
+
+type importLine struct {
+	line  int
+	event ExportedEvent
+}
+
+// validateImported checks an event like appends check records. Exports
+// hold the "$" streams the store writes itself, so names are checked as
+// for reads.
+func (es *EventStore) validateImported(evt ExportedEvent) error {
+	if evt.Version < 0 {
+		return fmt.Errorf("invalid version %d", evt.Version)
+	}
+	if err := validateStreamName(evt.Stream, false); err != nil {
+		return err
+	}
+	return es.checkRecords(evt.Stream, []EventRecord{{evt.Contract, evt.Data, evt.Meta, evt.EventID}})
+}
+
+// Import appends events read as JSON Lines (the format of Export),
+// returning the number of events written. Streams keep their names,
+// order and original versions; positions in the global order are new.
+func (es *EventStore) Import(ctx context.Context, db fdb.Database, r io.Reader, opts ImportOptions) (int64, error) {
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = 500
+	}
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), maxTransactionBytes)
+
+	skip := make(map[string]bool) // streams decided on by committed batches
+	count, line, size := int64(0), 0, 0
+	var batch []importLine
+
+	flush := func() error {
+		n, err := es.importBatch(db, batch, skip, opts)
+		count += n
+		batch, size = batch[:0], 0
+		return err
+	}
+
+	for scanner.Scan() {
+		line++
+		if err := ctx.Err(); err != nil {
+			return count, err
+		}
+		if len(bytes.TrimSpace(scanner.Bytes())) == 0 {
+			continue
+		}
+
+		var evt ExportedEvent
+		if err := json.Unmarshal(scanner.Bytes(), &evt); err != nil {
+			return count, &ImportError{line, err}
+		}
+		if err := es.validateImported(evt); err != nil {
+			return count, &ImportError{line, err}
+		}
+
+		batch = append(batch, importLine{line, evt})
+		size += appendSize(evt.Stream, []EventRecord{{evt.Contract, evt.Data, evt.Meta, evt.EventID}})
+		if len(batch) >= opts.BatchSize || size >= maxTransactionBytes/2 {
+			if err := flush(); err != nil {
+				return count, err
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return count, &ImportError{line + 1, err}
+	}
+	return count, flush()
+}
+
+// importBatch writes a batch of lines in one transaction. skip is only
+// updated once the transaction has committed.
+func (es *EventStore) importBatch(db fdb.Database, batch []importLine, skip map[string]bool, opts ImportOptions) (int64, error) {
+	if len(batch) == 0 {
+		return 0, nil
+	}
+
+	var decided map[string]bool
+	v, err := db.Transact(func(tr fdb.Transaction) (interface{}, error) {
+		decided = make(map[string]bool)
+		n := int64(0)
+
+		for _, l := range batch {
+			stream := l.event.Stream
+
+			skipped, seen := skip[stream]
+			if !seen {
+				skipped, seen = decided[stream]
+			}
+			if !seen {
+				if es.lastVersion(tr, stream) >= 0 {
+					if !opts.SkipExisting {
+						return nil, &ImportError{l.line, ErrStreamExists}
+					}
+					skipped = true
+				}
+				decided[stream] = skipped
+			}
+			if skipped {
+				continue
+			}
+
+			if err := es.importEvent(tr, l.event); err != nil {
+				return nil, &ImportError{l.line, err}
+			}
+			n++
+		}
+		return n, nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	for stream, skipped := range decided {
+		skip[stream] = skipped
+	}
+	return v.(int64), nil
+}
+
+// importEvent appends an event at its original version and creation
+// time. Exports hold events as stored, so interceptors are bypassed, and
+// metadata streams are written like any other.
+func (es *EventStore) importEvent(tr fdb.Transaction, evt ExportedEvent) error {
+	next := es.lastVersion(tr, evt.Stream) + 1
+	switch {
+	case evt.Version < next:
+		return fmt.Errorf("version %d of %q is out of order", evt.Version, evt.Stream)
+	case evt.Version > next && next == 0 && !isMetadataStream(evt.Stream):
+		// the export started after the beginning of the stream
+		tr.Add(es.streamsCounter(), encodeCounter(1))
+	}
+
+	meta, err := es.getMetadata(tr, evt.Stream)
+	if err != nil {
+		return err
+	}
+	created := evt.Created
+	if created.IsZero() {
+		created = time.Now()
+	}
+	_, err = es.writeEventsMeta(tr, evt.Stream, meta, evt.Version-1, []EventRecord{{evt.Contract, evt.Data, evt.Meta, evt.EventID}}, created)
+	return err
+}
@@ -0,0 +1,358 @@
+package eventstore
+
+import (
+	"context"
+	"fmt"
+	"github.com/FoundationDB/fdb-go/fdb"
+	"github.com/FoundationDB/fdb-go/fdb/tuple"
+)
+
+// Kinds of anomalies found by CheckIntegrity
+const (
+	AnomalyMissingGlobal = "missing_global" // stream entry without its global entry
+	AnomalyMissingStream = "missing_stream" // global entry without its stream entry
+	AnomalyVersionGap    = "version_gap"    // versions of a stream are not contiguous up to its head
+	AnomalyCount         = "count_mismatch" // counter differs from the events counted
+	AnomalyDanglingIndex = "dangling_index" // index entry pointing at no event
+	AnomalyBadEntry      = "bad_entry"      // key or value that can't be decoded
+)
+
+type IntegrityOptions struct {
+	// BatchSize is the number of keys checked per transaction, 500 by
+	// default
+	BatchSize int
+	// Repair clears dangling index entries as they are found
+	Repair bool
+}
+
+// Anomaly is an inconsistency found by CheckIntegrity
+type Anomaly struct {
+	Kind    string  `json:"kind"`
+	Stream  string  `json:"stream,omitempty"`
+	Version int64   `json:"version,omitempty"`
+	Key     fdb.Key `json:"key"`
+	Detail  string  `json:"detail,omitempty"`
+}
+
+type IntegrityReport struct {
+	StreamsChecked int64     `json:"streamsChecked"`
+	EventsChecked  int64     `json:"eventsChecked"`
+	IndexChecked   int64     `json:"indexChecked"`
+	Repaired       int64     `json:"repaired"`
+	Anomalies      []Anomaly `json:"anomalies"`
+}
+
+func (r *IntegrityReport) add(a Anomaly) {
+	r.Anomalies = append(r.Anomalies, a)
+}
+
+func (r *IntegrityReport) merge(o IntegrityReport) {
+	r.StreamsChecked += o.StreamsChecked
+	r.EventsChecked += o.EventsChecked
+	r.IndexChecked += o.IndexChecked
+	r.Repaired += o.Repaired
+	r.Anomalies = append(r.Anomalies, o.Anomalies...)
+}
+
+// CheckIntegrity verifies the store in bounded transactions: stream and
+// global entries match one to one, versions of every stream are
+// contiguous from its oldest kept event to its head, counters match the
+// events counted and the time and id indexes point at stored events. With
+// Repair, dangling index entries are cleared.
+//
+// Each batch is consistent in itself, but the check as a whole is not a
+// snapshot: on a store written meanwhile, counters of the streams written
+// may be reported off.
+func (es *EventStore) CheckIntegrity(ctx context.Context, db fdb.Database, opts IntegrityOptions) (IntegrityReport, error) {
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = 500
+	}
+	var report IntegrityReport
+
+	total, err := es.checkStreams(ctx, db, opts, &report)
+	if err != nil {
+		return report, err
+	}
+	if err := es.checkGlobal(ctx, db, opts, &report); err != nil {
+		return report, err
+	}
+	if err := es.checkIndexes(ctx, db, opts, &report); err != nil {
+		return report, err
+	}
+
+	counted, _, err := es.CountAll(db)
+	if err != nil {
+		return report, err
+	}
+	if counted != total {
+		report.add(Anomaly{Kind: AnomalyCount, Key: es.totalCounter(), Detail: fmt.Sprintf("counter is %d, counted %d", counted, total)})
+	}
+	return report, nil
+}
+
+// scanBatches calls check with batches of the keys in [begin, end), one
+// transaction each, until the range is done. Anomalies go to a report of
+// the attempt, merged once it commits, and then sees each committed batch.
+func (es *EventStore) scanBatches(ctx context.Context, db fdb.Database, begin, end fdb.Key, limit int, report *IntegrityReport,
+	check func(tr fdb.Transaction, kvs []fdb.KeyValue, batch *IntegrityReport) error, then func(kvs []fdb.KeyValue)) error {
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		var batch IntegrityReport
+		v, err := db.Transact(func(tr fdb.Transaction) (interface{}, error) {
+			batch = IntegrityReport{}
+			kvs := tr.GetRange(fdb.KeyRange{Begin: begin, End: end}, fdb.RangeOptions{Limit: limit}).GetSliceOrPanic()
+			return kvs, check(tr, kvs, &batch)
+		})
+		if err != nil {
+			return err
+		}
+
+		kvs := v.([]fdb.KeyValue)
+		report.merge(batch)
+		if then != nil {
+			then(kvs)
+		}
+		if len(kvs) < limit {
+			return nil
+		}
+		begin = fdb.Key(concat(kvs[len(kvs)-1].Key, []byte{0x00}))
+	}
+}
+
+// checkStreams checks every stream against its head, counter and global
+// entries, returning the number of events that should be counted. Streams
+// are listed a page at a time and checked in transactions of their own.
+func (es *EventStore) checkStreams(ctx context.Context, db fdb.Database, opts IntegrityOptions, report *IntegrityReport) (int64, error) {
+	begin, end := es.streams.FDBRangeKeys()
+	from := begin.FDBKey()
+	total := int64(0)
+
+	for {
+		v, err := db.Transact(func(tr fdb.Transaction) (interface{}, error) {
+			r := fdb.KeyRange{Begin: from, End: end}
+			return tr.GetRange(r, fdb.RangeOptions{Limit: opts.BatchSize}).GetSliceOrPanic(), nil
+		})
+		if err != nil {
+			return total, err
+		}
+
+		page := v.([]fdb.KeyValue)
+		for _, kv := range page {
+			t, err := es.streams.Unpack(kv.Key)
+			if err != nil {
+				report.add(Anomaly{Kind: AnomalyBadEntry, Key: kv.Key, Detail: err.Error()})
+				continue
+			}
+			counted, err := es.checkStream(ctx, db, t[0].(string), decodeInt(kv.Value), opts, report)
+			if err != nil {
+				return total, err
+			}
+			total += counted
+			report.StreamsChecked++
+		}
+		if len(page) < opts.BatchSize {
+			return total, nil
+		}
+		from = fdb.Key(concat(page[len(page)-1].Key, []byte{0x00}))
+	}
+}
+
+// checkStream checks the events of a stream whose head is at the version,
+// returning the number of them that count
+func (es *EventStore) checkStream(ctx context.Context, db fdb.Database, stream string, head int64, opts IntegrityOptions, report *IntegrityReport) (int64, error) {
+	streamSpace := es.events.Sub(stream)
+	begin, end := streamSpace.FDBRangeKeys()
+
+	var meta StreamMetadata
+	check := func(tr fdb.Transaction, kvs []fdb.KeyValue, batch *IntegrityReport) error {
+		var err error
+		if meta, err = es.getMetadata(tr, stream); err != nil {
+			return err
+		}
+
+		globals := make([]fdb.FutureByteSlice, len(kvs))
+		keys := make([]fdb.Key, len(kvs))
+		for i, kv := range kvs {
+			t, err := streamSpace.Unpack(kv.Key)
+			if err != nil || len(t) != 1 || len(kv.Value) < headerLen {
+				continue
+			}
+			keys[i] = fdb.Key(concat(es.global.Bytes(), kv.Value[stampOffset:stampOffset+stampLen], tuple.Tuple{stream, t[0]}.Pack()))
+			globals[i] = tr.Get(keys[i])
+		}
+		for i, kv := range kvs {
+			batch.EventsChecked++
+			if keys[i] == nil {
+				batch.add(Anomaly{Kind: AnomalyBadEntry, Stream: stream, Key: kv.Key})
+			} else if globals[i].GetOrPanic() == nil {
+				batch.add(Anomaly{Kind: AnomalyMissingGlobal, Stream: stream, Key: keys[i]})
+			}
+		}
+		return nil
+	}
+
+	// versions are followed across batches once each has committed
+	next := int64(-1)
+	counted := int64(0)
+	then := func(kvs []fdb.KeyValue) {
+		for _, kv := range kvs {
+			t, err := streamSpace.Unpack(kv.Key)
+			if err != nil || len(t) != 1 {
+				continue
+			}
+			version, _ := t[0].(int64)
+			if next >= 0 && version != next {
+				report.add(Anomaly{Kind: AnomalyVersionGap, Stream: stream, Version: next, Key: kv.Key, Detail: fmt.Sprintf("versions %d to %d are missing", next, version-1)})
+			}
+			next = version + 1
+			if !meta.Deleted && version >= meta.DeletedBefore && !isMetadataStream(stream) {
+				counted++
+			}
+		}
+	}
+
+	if err := es.scanBatches(ctx, db, begin.FDBKey(), end.FDBKey(), opts.BatchSize, report, check, then); err != nil {
+		return 0, err
+	}
+
+	if next >= 0 && next-1 != head {
+		report.add(Anomaly{Kind: AnomalyVersionGap, Stream: stream, Version: next, Key: es.streams.Pack(tuple.Tuple{stream}), Detail: fmt.Sprintf("head is at %d, the last event at %d", head, next-1)})
+	}
+
+	stored, _, err := es.CountStream(db, stream)
+	if err != nil {
+		return 0, err
+	}
+	if stored != counted {
+		report.add(Anomaly{Kind: AnomalyCount, Stream: stream, Key: es.streamCounter(stream), Detail: fmt.Sprintf("counter is %d, counted %d", stored, counted)})
+	}
+	return counted, nil
+}
+
+// checkGlobal checks that every global entry has its stream entry
+func (es *EventStore) checkGlobal(ctx context.Context, db fdb.Database, opts IntegrityOptions, report *IntegrityReport) error {
+	begin, end := es.global.FDBRangeKeys()
+	return es.scanBatches(ctx, db, begin.FDBKey(), end.FDBKey(), opts.BatchSize, report, func(tr fdb.Transaction, kvs []fdb.KeyValue, batch *IntegrityReport) error {
+		entries := make([]fdb.FutureByteSlice, len(kvs))
+		refs := make([]tuple.Tuple, len(kvs))
+		for i, kv := range kvs {
+			pos := Position(kv.Key[len(es.global.Bytes()):])
+			if len(pos) < stampLen {
+				continue
+			}
+			if t, err := tuple.Unpack(pos[stampLen:]); err == nil && len(t) == 2 {
+				refs[i] = t
+				entries[i] = tr.Get(es.events.Pack(t))
+			}
+		}
+
+		for i, kv := range kvs {
+			if refs[i] == nil {
+				batch.add(Anomaly{Kind: AnomalyBadEntry, Key: kv.Key})
+				continue
+			}
+			if entries[i].GetOrPanic() == nil {
+				stream, _ := refs[i][0].(string)
+				version, _ := refs[i][1].(int64)
+				batch.add(Anomaly{Kind: AnomalyMissingStream, Stream: stream, Version: version, Key: kv.Key})
+			}
+		}
+		return nil
+	}, nil)
+}
+
+// checkIndexes checks the time and id indexes, clearing dangling entries
+// with Repair
+func (es *EventStore) checkIndexes(ctx context.Context, db fdb.Database, opts IntegrityOptions, report *IntegrityReport) error {
+	begin, end := es.byTime.FDBRangeKeys()
+	err := es.scanBatches(ctx, db, begin.FDBKey(), end.FDBKey(), opts.BatchSize, report, func(tr fdb.Transaction, kvs []fdb.KeyValue, batch *IntegrityReport) error {
+		events := make([]fdb.FutureByteSlice, len(kvs))
+		found := make([]bool, len(kvs))
+		for i, kv := range kvs {
+			pos, err := es.resolvePosition(tr, es.timeKeyPosition(kv.Key))
+			if err == errNoStrings {
+				return err
+			}
+			if err == nil {
+				events[i] = tr.Get(fdb.Key(concat(es.global.Bytes(), pos)))
+				found[i] = true
+			}
+		}
+		for i, kv := range kvs {
+			batch.IndexChecked++
+			if !found[i] || events[i].GetOrPanic() == nil {
+				es.dangling(tr, kv.Key, opts, batch)
+			}
+		}
+		return nil
+	}, nil)
+	if err != nil {
+		return err
+	}
+
+	begin, end = es.ids.FDBRangeKeys()
+	return es.scanBatches(ctx, db, begin.FDBKey(), end.FDBKey(), opts.BatchSize, report, func(tr fdb.Transaction, kvs []fdb.KeyValue, batch *IntegrityReport) error {
+		events := make([]fdb.FutureByteSlice, len(kvs))
+		ids := make([]string, len(kvs))
+		for i, kv := range kvs {
+			id, err := es.ids.Unpack(kv.Key)
+			stream, version, err2 := es.resolveRef(tr, kv.Value)
+			if err2 == errNoStrings {
+				return err2
+			}
+			if err == nil && err2 == nil && len(id) == 1 {
+				ids[i], _ = id[0].(string)
+				events[i] = tr.Get(es.events.Pack(tuple.Tuple{stream, version}))
+			}
+		}
+		for i, kv := range kvs {
+			batch.IndexChecked++
+			if ids[i] == "" {
+				es.dangling(tr, kv.Key, opts, batch)
+				continue
+			}
+			// the entry must point at the event carrying the id
+			val := events[i].GetOrPanic()
+			if valueFormat(val) == pointerFormat {
+				var err error
+				if val, err = es.unarchive(tr, val); err != nil {
+					return err
+				}
+			}
+			if env, err := decodeEnvelope(val); err != nil || env.id != ids[i] {
+				es.dangling(tr, kv.Key, opts, batch)
+			}
+		}
+		return nil
+	}, nil)
+}
+
+// dangling reports an index entry pointing at no event and clears it with
+// Repair
+func (es *EventStore) dangling(tr fdb.Transaction, key fdb.Key, opts IntegrityOptions, report *IntegrityReport) {
+	report.add(Anomaly{Kind: AnomalyDanglingIndex, Key: key})
+	if opts.Repair {
+		tr.Clear(key)
+		report.Repaired++
+	}
+}
+
+// timeKeyPosition returns the position a time index key points at. Keys
+// are a tuple holding the minute followed by the raw position; the first
+// byte of a tuple integer tells its length.
+func (es *EventStore) timeKeyPosition(key fdb.Key) Position {
+	b := key[len(es.byTime.Bytes()):]
+	if len(b) == 0 {
+		return nil
+	}
+	n := int(b[0]) - 0x14
+	if n < 0 {
+		n = -n
+	}
+	if len(b) < 1+n+stampLen {
+		return nil
+	}
+	return Position(b[1+n:])
+}
@@ -0,0 +1,100 @@
+package eventstore
+
+import (
+	"bytes"
+	"context"
+	"github.com/FoundationDB/fdb-go/fdb"
+	"github.com/FoundationDB/fdb-go/fdb/tuple"
+	"github.com/abdullin/go-layers/internal/fdbtest"
+	"testing"
+)
+
+func TestCheckIntegrity(t *testing.T) {
+	db, sub := fdbtest.Open(t)
+	es := New(sub)
+	ctx := context.Background()
+
+	streams := map[string][]RecordedEvent{}
+	for _, stream := range []string{"a", "b", "c", "ok"} {
+		err := es.Append(db, stream, ExpectedNoStream, []EventRecord{{Contract: "C"}, {Contract: "C"}, {Contract: "C"}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		events, err := es.ReadStream(db, stream, ReadOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		streams[stream] = events
+	}
+
+	report, err := es.CheckIntegrity(ctx, db, IntegrityOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Anomalies) != 0 || report.StreamsChecked != 4 || report.EventsChecked != 12 || report.IndexChecked != 24 {
+		t.Fatalf("report of a sound store %+v", report)
+	}
+
+	ghost := tuple.Tuple{"d", int64(0)}.Pack()
+	_, err = db.Transact(func(tr fdb.Transaction) (interface{}, error) {
+		// a@1 loses its global entry
+		tr.Clear(fdb.Key(concat(es.global.Bytes(), streams["a"][1].GlobalPosition)))
+		// b@1 is gone with its entries and counted, leaving a gap
+		gone := streams["b"][1]
+		tr.Clear(es.events.Pack(tuple.Tuple{"b", int64(1)}))
+		tr.Clear(fdb.Key(concat(es.global.Bytes(), gone.GlobalPosition)))
+		tr.Clear(fdb.Key(concat(es.timeBucket(timeBucket(gone.CreatedAt.Unix())), gone.GlobalPosition)))
+		tr.Clear(es.eventIDKey(gone.EventID))
+		es.count(tr, "b", -1)
+		// the counter of c drifts
+		tr.Add(es.streamCounter("c"), encodeCounter(2))
+		// a global entry of a stream never written, and an id pointing at it
+		tr.Set(fdb.Key(concat(es.global.Bytes(), bytes.Repeat([]byte{0xfe}, stampLen), ghost)), []byte{})
+		tr.Set(es.eventIDKey("ghost"), ghost)
+		return nil, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string]string{
+		AnomalyMissingGlobal: "a",
+		AnomalyVersionGap:    "b",
+		AnomalyCount:         "c",
+		AnomalyMissingStream: "d",
+		AnomalyDanglingIndex: "",
+	}
+	check := func(opts IntegrityOptions) IntegrityReport {
+		t.Helper()
+		report, err := es.CheckIntegrity(ctx, db, opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(report.Anomalies) != len(want) {
+			t.Fatalf("found %+v", report.Anomalies)
+		}
+		for _, a := range report.Anomalies {
+			if stream, ok := want[a.Kind]; !ok || a.Stream != stream {
+				t.Fatalf("unexpected anomaly %+v", a)
+			}
+			if a.Kind == AnomalyVersionGap && a.Version != 1 {
+				t.Fatalf("gap reported at %d", a.Version)
+			}
+		}
+		return report
+	}
+
+	// small batches carry versions and counts across transactions
+	for _, batch := range []int{0, 1, 2} {
+		if report := check(IntegrityOptions{BatchSize: batch}); report.Repaired != 0 {
+			t.Fatalf("repaired %d entries without Repair", report.Repaired)
+		}
+	}
+
+	// with Repair the dangling id is cleared, the rest is only reported
+	if report := check(IntegrityOptions{Repair: true}); report.Repaired != 1 {
+		t.Fatalf("repaired %d entries", report.Repaired)
+	}
+	delete(want, AnomalyDanglingIndex)
+	check(IntegrityOptions{})
+}
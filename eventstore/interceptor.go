@@ -0,0 +1,85 @@
+package eventstore
+
+import "github.com/FoundationDB/fdb-go/fdb"
+
+// Interceptor transforms or validates records before Append writes them.
+// Returning an error aborts the append.
+type Interceptor func(stream string, records []EventRecord) ([]EventRecord, error)
+
+// ReadInterceptor transforms an event before a read returns it
+type ReadInterceptor func(event RecordedEvent) (RecordedEvent, error)
+
+// CommitHook gets the events of a stream once the append that wrote them
+// has committed, with their versions, positions and ids. CreatedAt is not
+// set.
+type CommitHook func(stream string, events []RecordedEvent)
+
+// Use registers an append interceptor. Interceptors run in registration
+// order, each getting the output of the previous one. Register them
+// before the store is used, Use is not safe for concurrent calls.
+func (es *EventStore) Use(interceptor Interceptor) {
+	es.interceptors = append(es.interceptors, interceptor)
+}
+
+// UseRead registers a read interceptor, applied by ReadStream, ReadAll
+// and LoadAggregate in registration order, before upcasters
+func (es *EventStore) UseRead(interceptor ReadInterceptor) {
+	es.readInterceptors = append(es.readInterceptors, interceptor)
+}
+
+func (es *EventStore) interceptAppend(stream string, records []EventRecord) ([]EventRecord, error) {
+	var err error
+	for _, fn := range es.interceptors {
+		if records, err = fn(stream, records); err != nil {
+			return nil, err
+		}
+	}
+	return records, nil
+}
+
+func (es *EventStore) interceptRead(event RecordedEvent) (RecordedEvent, error) {
+	var err error
+	for _, fn := range es.readInterceptors {
+		if event, err = fn(event); err != nil {
+			return RecordedEvent{}, err
+		}
+	}
+	return es.upcast(event)
+}
+
+// OnCommitted registers a hook that Append, AppendWithOptions and
+// AppendMulti call exactly once per commit, for every stream written,
+// after the transaction commits. Attempts that conflicted and were retried
+// don't call it, and neither do failed appends or idempotent appends that
+// wrote nothing. Hooks run on the appending goroutine in registration
+// order; AppendTr leaves them to the caller, who owns the commit.
+func (es *EventStore) OnCommitted(fn CommitHook) {
+	es.commitHooks = append(es.commitHooks, fn)
+}
+
+// notifyCommitted calls the hooks with the events of a committed append
+func (es *EventStore) notifyCommitted(stamp fdb.FutureKey, stream string, records []EventRecord, versions []int64) {
+	if len(es.commitHooks) == 0 || len(versions) == 0 {
+		return
+	}
+	// the stamp of a committed transaction is always ready
+	positions, err := Positions(stamp, stream, versions)
+	if err != nil {
+		return
+	}
+	es.committed(stream, records, versions, positions)
+}
+
+func (es *EventStore) committed(stream string, records []EventRecord, versions []int64, positions []Position) {
+	if len(es.commitHooks) == 0 || len(versions) == 0 {
+		return
+	}
+	events := make([]RecordedEvent, len(versions))
+	for i := range versions {
+		events[i] = FromRecord(records[i], stream, versions[i])
+		events[i].GlobalPosition = positions[i]
+	}
+	for _, fn := range es.commitHooks {
+		fn(stream, events)
+	}
+}
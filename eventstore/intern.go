@@ -0,0 +1,127 @@
+package eventstore
+
+import (
+	"errors"
+	"github.com/FoundationDB/fdb-go/fdb"
+	"github.com/FoundationDB/fdb-go/fdb/tuple"
+)
+
+// Index entries name the stream of their event. With Strings set they
+// hold the interned token of the name instead, a few bytes in place of
+// the name in every entry:
+//
+//	time: (minute) + versionstamp | (token, version) -> created
+//	id:   (id) -> (token, version)
+//
+// Reads resolve tokens back to names. Entries of both kinds can be mixed,
+// so interning can be turned on for an existing store, but not off: the
+// entries written with it can't be read without Strings. Contracts are
+// not part of any index entry.
+
+var errBadIndexEntry = errors.New("malformed index entry")
+
+// errNoStrings is returned for entries holding a token when Strings is
+// not set
+var errNoStrings = errors.New("index entry holds an interned stream but Strings is not set")
+
+// indexRef returns the (stream, version) of an event as index entries
+// hold it
+func (es *EventStore) indexRef(tr fdb.Transaction, stream string, version int64) ([]byte, error) {
+	if es.Strings == nil {
+		return tuple.Tuple{stream, version}.Pack(), nil
+	}
+	token, err := es.Strings.Intern(tr, stream)
+	if err != nil {
+		return nil, err
+	}
+	return tuple.Tuple{token, version}.Pack(), nil
+}
+
+// streamToken returns the token of the stream as tr sees it, nil without
+// Strings. A token allocated by tr is only cached once tr commits, see
+// internCommitted.
+func (es *EventStore) streamToken(tr fdb.Transaction, stream string) []byte {
+	if es.Strings == nil {
+		return nil
+	}
+	token, _ := es.Strings.Find(tr, stream)
+	return token
+}
+
+// internCommitted caches the token of a stream once the transaction that
+// may have allocated it committed
+func (es *EventStore) internCommitted(stream string, token []byte) {
+	if token != nil {
+		es.Strings.Committed(stream, token)
+	}
+}
+
+// indexRefs returns every form index entries of an event can have, for
+// finding the entries of an event written with or without Strings
+func (es *EventStore) indexRefs(tr fdb.Transaction, stream string, version int64) [][]byte {
+	refs := [][]byte{tuple.Tuple{stream, version}.Pack()}
+	if es.Strings != nil {
+		if token, ok := es.Strings.Find(tr, stream); ok {
+			refs = append(refs, tuple.Tuple{token, version}.Pack())
+		}
+	}
+	return refs
+}
+
+// resolveRef returns the stream and version an index entry refers to
+func (es *EventStore) resolveRef(tr fdb.Transaction, ref []byte) (string, int64, error) {
+	t, err := tuple.Unpack(ref)
+	if err != nil || len(t) != 2 {
+		return "", 0, errBadIndexEntry
+	}
+	version, ok := t[1].(int64)
+	if !ok {
+		return "", 0, errBadIndexEntry
+	}
+	switch name := t[0].(type) {
+	case string:
+		return name, version, nil
+	case []byte:
+		if es.Strings == nil {
+			return "", 0, errNoStrings
+		}
+		stream, err := es.Strings.Lookup(tr, name)
+		return stream, version, err
+	}
+	return "", 0, errBadIndexEntry
+}
+
+// resolvePosition returns the global position of an event from its
+// position as time index keys hold it
+func (es *EventStore) resolvePosition(tr fdb.Transaction, indexed []byte) (Position, error) {
+	if len(indexed) < stampLen {
+		return nil, errBadIndexEntry
+	}
+	stream, version, err := es.resolveRef(tr, indexed[stampLen:])
+	if err != nil {
+		return nil, err
+	}
+	return Position(concat(indexed[:stampLen], tuple.Tuple{stream, version}.Pack())), nil
+}
+
+// indexedPosition returns a global position as time index keys hold it,
+// with the token of the stream if it has one
+func (es *EventStore) indexedPosition(tr fdb.Transaction, pos Position) (Position, error) {
+	if es.Strings == nil {
+		return pos, nil
+	}
+	if len(pos) < stampLen {
+		return nil, errBadIndexEntry
+	}
+	t, err := tuple.Unpack(pos[stampLen:])
+	if err != nil || len(t) != 2 {
+		return nil, errBadIndexEntry
+	}
+	stream, ok1 := t[0].(string)
+	version, ok2 := t[1].(int64)
+	if !ok1 || !ok2 {
+		return nil, errBadIndexEntry
+	}
+	refs := es.indexRefs(tr, stream, version)
+	return Position(concat(pos[:stampLen], refs[len(refs)-1])), nil
+}
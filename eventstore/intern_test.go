@@ -0,0 +1,110 @@
+package eventstore
+
+import (
+	"context"
+	"github.com/FoundationDB/fdb-go/fdb"
+	"github.com/abdullin/go-layers/internal/fdbtest"
+	"github.com/abdullin/go-layers/stringintern"
+	"testing"
+	"time"
+)
+
+func TestInternedIndexes(t *testing.T) {
+	db, sub := fdbtest.Open(t)
+	es := New(sub.Sub("store"))
+
+	// entries written before interning and after it are read alike
+	if err := es.Append(db, "plain", ExpectedAny, []EventRecord{{Contract: "C", EventID: "id-plain"}}); err != nil {
+		t.Fatal(err)
+	}
+	es.Strings = stringintern.New(sub.Sub("strings"))
+	if err := es.Append(db, "interned", ExpectedAny, []EventRecord{{Contract: "C", EventID: "id-interned"}}); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, id := range []string{"id-plain", "id-interned"} {
+		evt, ok, err := es.ReadEventByID(db, id)
+		if err != nil || !ok || evt.EventID != id {
+			t.Fatalf("read %q as %+v, %v, %v", id, evt, ok, err)
+		}
+	}
+
+	now := time.Now()
+	events, _, err := es.ReadByTime(db, now.Add(-time.Hour), now.Add(time.Hour), nil, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 2 || events[0].StreamName != "plain" || events[1].StreamName != "interned" {
+		t.Fatalf("read by time %+v", events)
+	}
+
+	report, err := es.CheckIntegrity(context.Background(), db, IntegrityOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Anomalies) != 0 {
+		t.Fatalf("anomalies %+v", report.Anomalies)
+	}
+
+	// removing the events removes their entries of either kind
+	for _, stream := range []string{"plain", "interned"} {
+		if err := es.DeleteStream(db, stream); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := es.Scavenge(context.Background(), db, ScavengeOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	for _, id := range []string{"id-plain", "id-interned"} {
+		if _, ok, err := es.ReadEventByID(db, id); err != nil || ok {
+			t.Fatalf("read %q after scavenging: %v, %v", id, ok, err)
+		}
+	}
+	if report, err = es.CheckIntegrity(context.Background(), db, IntegrityOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Anomalies) != 0 {
+		t.Fatalf("anomalies after scavenging %+v", report.Anomalies)
+	}
+}
+
+func TestInternedFirstAppend(t *testing.T) {
+	db, sub := fdbtest.Open(t)
+	es := New(sub.Sub("store"))
+	es.Strings = stringintern.New(sub.Sub("strings"))
+
+	// the first append allocates the token and indexes every event with it
+	records := make([]EventRecord, 1000)
+	for i := range records {
+		records[i] = EventRecord{Contract: "C", Data: []byte("data")}
+	}
+	if err := es.Append(db, "first", ExpectedNoStream, records); err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now()
+	events, _, err := es.ReadByTime(db, now.Add(-time.Hour), now.Add(time.Hour), nil, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != len(records) {
+		t.Fatalf("read %d events by time, want %d", len(events), len(records))
+	}
+	for i, evt := range events {
+		if evt.StreamName != "first" || evt.StreamVersion != int64(i) {
+			t.Fatalf("event %d read by time as %s@%d", i, evt.StreamName, evt.StreamVersion)
+		}
+	}
+
+	// the token was cached at commit: it is still found with the mappings
+	// gone from the database
+	strings := sub.Sub("strings")
+	v, err := db.Transact(func(tr fdb.Transaction) (interface{}, error) {
+		tr.ClearRange(strings)
+		_, ok := es.Strings.Find(tr, "first")
+		return ok, nil
+	})
+	if err != nil || !v.(bool) {
+		t.Fatalf("token of the stream not cached: %v, %v", v, err)
+	}
+}
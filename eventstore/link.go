@@ -0,0 +1,68 @@
+package eventstore
+
+import (
+	"errors"
+	"github.com/FoundationDB/fdb-go/fdb"
+	"github.com/FoundationDB/fdb-go/fdb/tuple"
+)
+
+const (
+	// LinkContract marks a record that points at an event in another stream
+	LinkContract = "$>"
+	// TombstoneContract replaces a link whose target event no longer
+	// exists (truncated or deleted). Data holds the original link and the
+	// stream fields are those of the link.
+	TombstoneContract = "$tombstone"
+)
+
+var ErrEventNotFound = errors.New("event not found")
+
+// StreamPosition identifies a single event within a stream
+type StreamPosition struct {
+	Stream  string
+	Version int64
+}
+
+func encodeLink(pos StreamPosition) []byte {
+	return tuple.Tuple{pos.Stream, pos.Version}.Pack()
+}
+
+func decodeLink(data []byte) (pos StreamPosition, ok bool) {
+	t, err := tuple.Unpack(data)
+	if err != nil || len(t) != 2 {
+		return
+	}
+	stream, ok1 := t[0].(string)
+	version, ok2 := t[1].(int64)
+	if !ok1 || !ok2 {
+		return
+	}
+	return StreamPosition{stream, version}, true
+}
+
+// AppendLink appends to targetStream a lightweight record pointing at an
+// existing event instead of copying its payload. ReadStream resolves links
+// unless ReadOptions.RawLinks is set. The link is appended like Append
+// with ExpectedAny.
+func (es *EventStore) AppendLink(db fdb.Database, targetStream string, source StreamPosition) error {
+	link := EventRecord{Contract: LinkContract, Data: encodeLink(source)}
+	return es.appendChecked(db, targetStream, ExpectedAny, []EventRecord{link}, func(tr fdb.Transaction) error {
+		if _, ok := es.readEvent(tr, source); !ok {
+			return ErrEventNotFound
+		}
+		return nil
+	})
+}
+
+// resolveLink returns the event a link points at, or a tombstone in place
+// of the link when the target is gone. Links are resolved a single level
+// deep.
+func (es *EventStore) resolveLink(tr fdb.Transaction, link RecordedEvent) RecordedEvent {
+	if pos, ok := decodeLink(link.Data); ok {
+		if evt, ok := es.readEvent(tr, pos); ok {
+			return evt
+		}
+	}
+	link.Contract = TombstoneContract
+	return link
+}
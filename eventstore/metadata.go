@@ -0,0 +1,227 @@
+package eventstore
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/FoundationDB/fdb-go/fdb"
+	"github.com/FoundationDB/fdb-go/fdb/tuple"
+	"strings"
+	"time"
+)
+
+// ErrStreamDeleted is returned by reads of a deleted stream and by appends
+// to it that don't allow recreating it
+var ErrStreamDeleted = errors.New("stream deleted")
+
+// StreamDeletedContract is the contract of the tombstone DeleteStream
+// appends to a stream, so readers of the global space see the delete
+const StreamDeletedContract = "$streamDeleted"
+
+// StreamDeleted is the data of a tombstone
+type StreamDeleted struct {
+	Stream      string `json:"stream"`
+	LastVersion int64  `json:"lastVersion"` // of the last event deleted, -1 for none
+}
+
+// MetadataContract is the contract of events in metadata streams
+const MetadataContract = "$metadata"
+
+// MetadataStream returns the name of the stream that records metadata
+// changes of a stream. Its latest event holds the current metadata and
+// earlier ones the history of changes.
+func MetadataStream(stream string) string {
+	return "$$" + stream
+}
+
+func isMetadataStream(stream string) bool {
+	return strings.HasPrefix(stream, "$$")
+}
+
+// ErrStreamTooLong is returned by Append when the stream would grow past
+// its MaxLength
+type ErrStreamTooLong struct {
+	Stream string
+	Limit  int64
+}
+
+func (e *ErrStreamTooLong) Error() string {
+	return fmt.Sprintf("stream %q would exceed %d events", e.Stream, e.Limit)
+}
+
+// StreamMetadata holds per-stream retention settings. Zero values mean
+// no limit. Events outside retention are hidden at once from reads of the
+// stream: ReadStream, ReadLast, ReadEventByID, exports and the stream
+// channels and projections built on them. Reads of the global space,
+// ReadByTime and subscriptions to all streams return them until Scavenge
+// physically removes them.
+type StreamMetadata struct {
+	MaxCount int64         `json:"maxCount,omitempty"` // keep only the newest events
+	MaxAge   time.Duration `json:"maxAge,omitempty"`   // drop events older than this
+	Deleted  bool          `json:"deleted,omitempty"`  // stream was hard-deleted
+	// DeletedBefore is the version after the tombstone of the last delete.
+	// Events before it stay hidden once the stream is recreated.
+	DeletedBefore int64 `json:"deletedBefore,omitempty"`
+	// TruncateBefore is the first version after the last soft delete.
+	// Events before it are hidden from reads without IncludeDeleted but
+	// kept by Scavenge.
+	TruncateBefore int64 `json:"truncateBefore,omitempty"`
+	// MaxLength is a hard cap on the number of events ever appended.
+	// Appends past it fail with ErrStreamTooLong instead of trimming.
+	MaxLength int64 `json:"maxLength,omitempty"`
+}
+
+// retains tells whether an event is still within retention of the stream
+// whose last version is last. created and now are unix seconds
+func (m StreamMetadata) retains(version, created, last, now int64) bool {
+	if m.Deleted || version < m.DeletedBefore {
+		return false
+	}
+	if m.MaxCount > 0 && version <= last-m.MaxCount {
+		return false
+	}
+	if m.MaxAge > 0 && time.Duration(now-created)*time.Second > m.MaxAge {
+		return false
+	}
+	return true
+}
+
+// softDeleted tells whether the stream with the last version was
+// soft-deleted and nothing was appended since
+func (m StreamMetadata) softDeleted(last int64) bool {
+	return m.TruncateBefore > 0 && last < m.TruncateBefore
+}
+
+// SetStreamMetadata records new metadata of the stream as an event of its
+// metadata stream
+func (es *EventStore) SetStreamMetadata(db fdb.Database, stream string, meta StreamMetadata) error {
+	if err := validateStreamName(stream, true); err != nil {
+		return err
+	}
+	_, err := db.Transact(func(tr fdb.Transaction) (interface{}, error) {
+		old, last, err := es.loadMetadata(tr, stream)
+		if err != nil {
+			return nil, err
+		}
+		// metadata stored before metadata streams was never counted
+		es.countLimited(tr, last >= 0 && old.limited(), meta.limited())
+		return nil, es.setMetadata(tr, stream, meta)
+	})
+	return err
+}
+
+func (es *EventStore) GetStreamMetadata(db fdb.Database, stream string) (StreamMetadata, error) {
+	v, err := db.Transact(func(tr fdb.Transaction) (interface{}, error) {
+		return es.getMetadata(tr, stream)
+	})
+	if err != nil {
+		return StreamMetadata{}, err
+	}
+	return v.(StreamMetadata), nil
+}
+
+// DeleteStream hard-deletes a stream. Its events disappear from reads at
+// once and their storage is reclaimed by the next Scavenge. A tombstone
+// with StreamDeletedContract is appended in their place; later appends
+// fail with ErrStreamDeleted unless AppendOptions.AllowRecreate is set.
+func (es *EventStore) DeleteStream(db fdb.Database, stream string) error {
+	if err := validateStreamName(stream, true); err != nil {
+		return err
+	}
+	_, err := db.Transact(func(tr fdb.Transaction) (interface{}, error) {
+		meta, err := es.getMetadata(tr, stream)
+		if err != nil {
+			return nil, err
+		}
+		if meta.Deleted {
+			return nil, nil
+		}
+		last := es.lastVersion(tr, stream)
+		data, err := json.Marshal(StreamDeleted{stream, last})
+		if err != nil {
+			return nil, err
+		}
+		counted := decodeCounter(tr.Get(es.streamCounter(stream)).GetOrPanic())
+		tombstone := EventRecord{Contract: StreamDeletedContract, Data: data}
+		if _, err := es.writeEventsMeta(tr, stream, meta, last, []EventRecord{tombstone}, time.Now()); err != nil {
+			return nil, err
+		}
+
+		// the tombstone counts neither as an event nor as a stream
+		es.count(tr, stream, -counted-1)
+		tr.Add(es.streamsCounter(), encodeCounter(-1))
+
+		meta.Deleted = true
+		meta.DeletedBefore = last + 2
+		return nil, es.setMetadata(tr, stream, meta)
+	})
+	return err
+}
+
+// SoftDeleteStream hides the events of a stream from reads, keeping them
+// for reads with IncludeDeleted. The next append resurrects the stream:
+// versions continue where they left off and only events appended since
+// are read by default. Until then ExpectedNoStream appends succeed.
+func (es *EventStore) SoftDeleteStream(db fdb.Database, stream string) error {
+	if err := validateStreamName(stream, true); err != nil {
+		return err
+	}
+	_, err := db.Transact(func(tr fdb.Transaction) (interface{}, error) {
+		meta, err := es.getMetadata(tr, stream)
+		if err != nil {
+			return nil, err
+		}
+		if meta.Deleted {
+			return nil, ErrStreamDeleted
+		}
+		last := es.lastVersion(tr, stream)
+		if last < 0 || meta.softDeleted(last) {
+			return nil, nil
+		}
+		meta.TruncateBefore = last + 1
+		return nil, es.setMetadata(tr, stream, meta)
+	})
+	return err
+}
+
+// setMetadata appends the metadata to the metadata stream of the stream
+func (es *EventStore) setMetadata(tr fdb.Transaction, stream string, meta StreamMetadata) error {
+	data, err := json.Marshal(meta)
+	if err != nil {
+		return err
+	}
+	record := EventRecord{Contract: MetadataContract, Data: data}
+	// metadata streams have no metadata of their own
+	_, err = es.writeEventsMeta(tr, MetadataStream(stream), StreamMetadata{}, es.lastVersion(tr, MetadataStream(stream)), []EventRecord{record}, time.Now())
+	return err
+}
+
+// getMetadata returns the latest event of the metadata stream, falling
+// back to metadata stored before metadata streams existed. Repeated reads
+// within a transaction are served by its read cache.
+func (es *EventStore) getMetadata(tr fdb.Transaction, stream string) (StreamMetadata, error) {
+	meta, _, err := es.loadMetadata(tr, stream)
+	return meta, err
+}
+
+// loadMetadata is getMetadata that also returns the last version of the
+// metadata stream, -1 if the metadata predates metadata streams
+func (es *EventStore) loadMetadata(tr fdb.Transaction, stream string) (meta StreamMetadata, last int64, err error) {
+	var data []byte
+	if last = es.lastVersion(tr, MetadataStream(stream)); last >= 0 {
+		var events []storedEvent
+		if events, err = es.scanStream(tr, MetadataStream(stream), last, 1); err != nil {
+			return
+		}
+		if len(events) == 1 {
+			data = events[0].Data
+		}
+	} else {
+		data = tr.Get(es.metadata.Pack(tuple.Tuple{stream})).GetOrPanic()
+	}
+
+	if data != nil {
+		err = json.Unmarshal(data, &meta)
+	}
+	return
+}
@@ -0,0 +1,61 @@
+package eventstore
+
+import (
+	"errors"
+	"github.com/abdullin/go-layers/internal/fdbtest"
+	"testing"
+)
+
+func TestSoftDeleteResurrect(t *testing.T) {
+	for _, cache := range []bool{false, true} {
+		db, sub := fdbtest.Open(t)
+		es := New(sub)
+		if cache {
+			es.WithVersionCache(16)
+		}
+
+		versions := func(opts ReadOptions) []int64 {
+			events, err := es.ReadStream(db, "s", opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var vs []int64
+			for _, evt := range events {
+				vs = append(vs, evt.StreamVersion)
+			}
+			return vs
+		}
+
+		if err := es.Append(db, "s", ExpectedNoStream, sameContract(3)); err != nil {
+			t.Fatal(err)
+		}
+		if err := es.SoftDeleteStream(db, "s"); err != nil {
+			t.Fatal(err)
+		}
+		if vs := versions(ReadOptions{}); len(vs) != 0 {
+			t.Fatalf("read %v from a soft-deleted stream", vs)
+		}
+		if vs := versions(ReadOptions{IncludeDeleted: true}); len(vs) != 3 {
+			t.Fatalf("read %v including deleted", vs)
+		}
+
+		var wrong *WrongExpectedVersion
+		if err := es.Append(db, "s", ExpectedStreamExists, sameContract(1)); !errors.As(err, &wrong) {
+			t.Fatalf("appended to a soft-deleted stream expecting it with %v", err)
+		}
+		if err := es.Append(db, "s", ExpectedNoStream, sameContract(1)); err != nil {
+			t.Fatal(err)
+		}
+
+		// versions continue where they left off
+		if vs := versions(ReadOptions{}); len(vs) != 1 || vs[0] != 3 {
+			t.Fatalf("read %v from a resurrected stream (cache %v)", vs, cache)
+		}
+		if vs := versions(ReadOptions{IncludeDeleted: true}); len(vs) != 4 || vs[3] != 3 {
+			t.Fatalf("read %v including deleted (cache %v)", vs, cache)
+		}
+		if err := es.Append(db, "s", ExpectedNoStream, sameContract(1)); !errors.As(err, &wrong) {
+			t.Fatalf("appended to a resurrected stream expecting none with %v", err)
+		}
+	}
+}
@@ -0,0 +1,204 @@
+package eventstore
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"github.com/FoundationDB/fdb-go/fdb"
+	"github.com/FoundationDB/fdb-go/fdb/tuple"
+	"time"
+)
+
+// Events written before the envelope stored each field under a key of
+// its own, in one of two layouts:
+//
+//	baseline: glob / (random, unix seconds, contract, field)
+//	fields:   glob / versionstamp | (stream, version, contract, field)
+//	          stream / (stream, version, contract, field)
+//
+// Fields are "data" and "meta", plus "time" (unix seconds) and, in stream
+// copies, the "glob" key of the global copy in the second layout. Reads
+// don't understand them; Migrate rewrites them as envelopes.
+
+// LegacyStream receives the events of the baseline layout, which kept no
+// stream and no version
+const LegacyStream = "$legacy"
+
+// ErrLegacyLayout is returned by reads of the global space that meet an
+// event written before the envelope. Migrate rewrites those events.
+var ErrLegacyLayout = errors.New("event in a legacy layout, run Migrate")
+
+// migrateBatch is the number of keys Migrate reads per transaction
+const migrateBatch = 1000
+
+type MigrateReport struct {
+	Events   int64 // events of the fields layout rewritten in place
+	Baseline int64 // events of the baseline layout appended to LegacyStream
+}
+
+// legacyEvent is an event of a legacy layout assembled from its fields
+type legacyEvent struct {
+	key      fdb.Key // shared by all fields of the event
+	first    fdb.Key // key of its first field
+	keys     []fdb.Key
+	stamp    []byte // nil in the baseline layout
+	stream   string
+	version  int64
+	contract string
+	created  int64 // unix seconds
+	data     []byte
+	meta     []byte
+}
+
+// Migrate rewrites events stored before the envelope. Events of the
+// fields layout keep their keys, and so their positions and versions.
+// Baseline events are appended to LegacyStream at their original
+// creation time, in the order of their keys. It works a batch per
+// transaction and resumes where the last run stopped.
+func (es *EventStore) Migrate(ctx context.Context, db fdb.Database) (MigrateReport, error) {
+	var report MigrateReport
+	for {
+		if err := ctx.Err(); err != nil {
+			return report, err
+		}
+
+		var batch MigrateReport
+		v, err := db.Transact(func(tr fdb.Transaction) (interface{}, error) {
+			batch = MigrateReport{}
+			return es.migrateBatch(tr, &batch)
+		})
+		if err != nil {
+			return report, err
+		}
+
+		report.Events += batch.Events
+		report.Baseline += batch.Baseline
+		if done := v.(bool); done {
+			return report, nil
+		}
+	}
+}
+
+// migrateBatch rewrites the legacy events of the next batch of keys.
+// Returns true once the global space is done.
+func (es *EventStore) migrateBatch(tr fdb.Transaction, report *MigrateReport) (bool, error) {
+	cursor := es.cursors.Pack(tuple.Tuple{"migrate"})
+	begin, end := es.global.FDBRangeKeys()
+	from := begin.FDBKey()
+	if val := tr.Get(cursor).GetOrPanic(); val != nil {
+		from = fdb.Key(val)
+	}
+
+	kvs := tr.GetRange(fdb.KeyRange{Begin: from, End: end}, fdb.RangeOptions{Limit: migrateBatch}).GetSliceOrPanic()
+	if len(kvs) == 0 {
+		tr.Clear(cursor)
+		return true, nil
+	}
+	next := fdb.Key(concat(kvs[len(kvs)-1].Key, []byte{0x00}))
+
+	var events []*legacyEvent
+	for _, kv := range kvs {
+		evt, field, ok := es.parseLegacy(kv.Key)
+		if !ok {
+			continue
+		}
+		if n := len(events); n == 0 || !bytes.Equal(events[n-1].key, evt.key) {
+			evt.first = kv.Key
+			events = append(events, evt)
+		}
+		evt = events[len(events)-1]
+		evt.keys = append(evt.keys, kv.Key)
+		switch field {
+		case "data":
+			evt.data = kv.Value
+		case "meta":
+			evt.meta = kv.Value
+		case "time":
+			evt.created = decodeInt(kv.Value)
+		}
+	}
+
+	// the fields of the last event may go on in the next batch, which
+	// then starts with them
+	if n := len(events); len(kvs) == migrateBatch && n > 0 {
+		last := events[n-1]
+		if !bytes.Equal(last.first, kvs[0].Key) && bytes.Equal(last.keys[len(last.keys)-1], kvs[len(kvs)-1].Key) {
+			next = last.first
+			events = events[:n-1]
+		}
+	}
+
+	var legacyMeta *StreamMetadata
+	for _, evt := range events {
+		for _, key := range evt.keys {
+			tr.Clear(key)
+		}
+		// events without meta read back as nil
+		if len(evt.meta) == 0 {
+			evt.meta = nil
+		}
+
+		if evt.stamp == nil {
+			// the new global keys start with a versionstamp, so they sort
+			// before the tuples of baseline keys, behind the cursor
+			if legacyMeta == nil {
+				meta, err := es.getMetadata(tr, LegacyStream)
+				if err != nil {
+					return false, err
+				}
+				legacyMeta = &meta
+			}
+			record := EventRecord{Contract: evt.contract, Data: evt.data, Meta: evt.meta}
+			last := es.lastVersion(tr, LegacyStream)
+			if _, err := es.writeEventsMeta(tr, LegacyStream, *legacyMeta, last, []EventRecord{record}, time.Unix(evt.created, 0)); err != nil {
+				return false, err
+			}
+			report.Baseline++
+			continue
+		}
+
+		e := envelope{contract: evt.contract, data: evt.data, meta: evt.meta, created: evt.created, nanos: time.Unix(evt.created, 0).UnixNano()}
+		tr.Set(evt.key, e.encode())
+		// the stream copy carries the versionstamp of its event
+		val := e.encode()
+		copy(val[stampOffset:], evt.stamp)
+		tr.ClearRange(es.events.Sub(evt.stream, evt.version))
+		tr.Set(es.events.Pack(tuple.Tuple{evt.stream, evt.version}), val)
+		report.Events++
+	}
+
+	tr.Set(cursor, next)
+	return false, nil
+}
+
+// parseLegacy parses a key of the global space written in a legacy
+// layout, returning the event it belongs to and the field it holds
+func (es *EventStore) parseLegacy(key fdb.Key) (*legacyEvent, string, bool) {
+	if t, err := es.global.Unpack(key); err == nil && len(t) == 4 {
+		_, ok1 := t[0].([]byte)
+		created, ok2 := t[1].(int64)
+		contract, ok3 := t[2].(string)
+		field, ok4 := t[3].(string)
+		if ok1 && ok2 && ok3 && ok4 {
+			return &legacyEvent{key: es.global.Pack(t[:3]), contract: contract, created: created}, field, true
+		}
+	}
+
+	pos := key[len(es.global.Bytes()):]
+	if len(pos) <= stampLen {
+		return nil, "", false
+	}
+	t, err := tuple.Unpack(pos[stampLen:])
+	if err != nil || len(t) != 4 {
+		return nil, "", false
+	}
+	stream, ok1 := t[0].(string)
+	version, ok2 := t[1].(int64)
+	contract, ok3 := t[2].(string)
+	field, ok4 := t[3].(string)
+	if !ok1 || !ok2 || !ok3 || !ok4 {
+		return nil, "", false
+	}
+	eventKey := fdb.Key(concat(es.global.Bytes(), pos[:stampLen], tuple.Tuple{stream, version}.Pack()))
+	return &legacyEvent{key: eventKey, stamp: pos[:stampLen], stream: stream, version: version, contract: contract}, field, true
+}
@@ -0,0 +1,69 @@
+package eventstore
+
+import (
+	"context"
+	"errors"
+	"github.com/FoundationDB/fdb-go/fdb"
+	"github.com/FoundationDB/fdb-go/fdb/tuple"
+	"github.com/abdullin/go-layers/internal/fdbtest"
+	"testing"
+)
+
+func TestMigrate(t *testing.T) {
+	db, sub := fdbtest.Open(t)
+	es := New(sub)
+
+	stamp := []byte{0, 0, 0, 0, 0, 0, 0, 1, 0, 0}
+	_, err := db.Transact(func(tr fdb.Transaction) (interface{}, error) {
+		// an event of the fields layout
+		prefix := concat(es.global.Bytes(), stamp)
+		for field, value := range map[string][]byte{"data": []byte("fields"), "meta": nil, "time": tuple.Tuple{int64(1000)}.Pack()} {
+			tr.Set(fdb.Key(concat(prefix, tuple.Tuple{"s", int64(0), "Old", field}.Pack())), value)
+			tr.Set(es.events.Pack(tuple.Tuple{"s", int64(0), "Old", field}), value)
+		}
+		tr.Set(es.streams.Pack(tuple.Tuple{"s"}), tuple.Tuple{int64(0)}.Pack())
+
+		// and one of the baseline
+		event := es.global.Sub([]byte("random"), int64(2000), "Older")
+		tr.Set(event.Pack(tuple.Tuple{"data"}), []byte("baseline"))
+		tr.Set(event.Pack(tuple.Tuple{"meta"}), []byte("m"))
+		return nil, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, _, err := es.ReadAll(db, StartPosition, 10, Filter{}); !errors.Is(err, ErrLegacyLayout) {
+		t.Fatalf("reading legacy events returned %v", err)
+	}
+
+	report, err := es.Migrate(context.Background(), db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Events != 1 || report.Baseline != 1 {
+		t.Fatalf("migrated %+v", report)
+	}
+
+	events, _, err := es.ReadAll(db, StartPosition, 10, Filter{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 2 {
+		t.Fatalf("read %d events, want 2", len(events))
+	}
+	if e := events[0]; e.StreamName != "s" || e.Contract != "Old" || string(e.Data) != "fields" || e.Meta != nil || e.CreatedAt.Unix() != 1000 {
+		t.Fatalf("fields layout read back as %+v", e)
+	}
+	if e := events[1]; e.StreamName != LegacyStream || e.Contract != "Older" || string(e.Data) != "baseline" || string(e.Meta) != "m" || e.CreatedAt.Unix() != 2000 {
+		t.Fatalf("baseline read back as %+v", e)
+	}
+
+	stream, err := es.ReadStream(db, "s", ReadOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(stream) != 1 || string(stream[0].Data) != "fields" {
+		t.Fatalf("stream read back as %+v", stream)
+	}
+}
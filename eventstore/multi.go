@@ -0,0 +1,150 @@
+package eventstore
+
+import (
+	"errors"
+	"fmt"
+	"github.com/FoundationDB/fdb-go/fdb"
+)
+
+const (
+	// ExpectedAny skips the expected version check
+	ExpectedAny int64 = -2
+	// ExpectedNoStream requires the stream to have no events, or none
+	// since it was soft-deleted
+	ExpectedNoStream int64 = -1
+	// ExpectedStreamExists requires the stream to have at least one event
+	ExpectedStreamExists int64 = -4
+)
+
+// maxTransactionBytes is the size limit FoundationDB puts on the
+// mutations of a single transaction
+const maxTransactionBytes = 10000000
+
+var ErrTransactionTooLarge = errors.New("appends exceed the transaction size limit")
+
+// WrongExpectedVersion is returned when a stream is not at the version
+// the append expects. Actual is the version observed by the failing
+// transaction. Match it with errors.As(err, &wrong) where wrong is a
+// *WrongExpectedVersion.
+type WrongExpectedVersion struct {
+	Stream   string
+	Expected int64
+	Actual   int64
+}
+
+func (e *WrongExpectedVersion) Error() string {
+	return fmt.Sprintf("stream %q is at version %d, expected %d", e.Stream, e.Actual, e.Expected)
+}
+
+// StreamAppend is the part of AppendMulti that goes to a single stream
+type StreamAppend struct {
+	Stream          string
+	ExpectedVersion int64
+	Records         []EventRecord
+}
+
+// WriteResult reports where the records of an append were written to
+type WriteResult struct {
+	Stream    string
+	Versions  []int64
+	Positions []Position
+	Retries   int // conflicts retried before the append committed
+}
+
+// checkExpected fails unless the stream is at the expected version
+func (es *EventStore) checkExpected(tr fdb.Transaction, stream string, expected int64) error {
+	if expected == ExpectedAny {
+		return nil
+	}
+	actual := es.lastVersion(tr, stream)
+	if actual >= 0 && (expected == ExpectedNoStream || expected == ExpectedStreamExists) {
+		meta, err := es.getMetadata(tr, stream)
+		if err != nil {
+			return err
+		}
+		if meta.softDeleted(actual) {
+			if expected == ExpectedNoStream {
+				return nil
+			}
+			return &WrongExpectedVersion{stream, expected, actual}
+		}
+	}
+	if !matchesExpected(expected, actual) {
+		return &WrongExpectedVersion{stream, expected, actual}
+	}
+	return nil
+}
+
+// matchesExpected tells whether a stream at the actual version satisfies
+// the expected version
+func matchesExpected(expected, actual int64) bool {
+	switch {
+	case expected == ExpectedAny:
+		return true
+	case expected == ExpectedStreamExists:
+		return actual >= 0
+	}
+	return actual == expected
+}
+
+// appendSize estimates the bytes a batch of records adds to a transaction
+func appendSize(stream string, records []EventRecord) int {
+	size := 0
+	for _, r := range records {
+		// every event is written to the stream and to the global space
+		size += 2 * (len(r.Data) + len(r.Meta) + 4*(len(stream)+len(r.Contract)+32))
+	}
+	return size
+}
+
+// AppendMulti appends to several streams in a single transaction, so
+// either all appends succeed or none does
+func (es *EventStore) AppendMulti(db fdb.Database, appends []StreamAppend) ([]WriteResult, error) {
+	size := 0
+	for _, a := range appends {
+		if err := es.checkRecords(a.Stream, a.Records); err != nil {
+			return nil, err
+		}
+		size += appendSize(a.Stream, a.Records)
+	}
+	if size > maxTransactionBytes {
+		return nil, ErrTransactionTooLarge
+	}
+
+	var stamp fdb.FutureKey
+	written := make([][]EventRecord, len(appends))
+	tokens := make([][]byte, len(appends))
+	v, retries, err := es.transact(db, func(tr fdb.Transaction) (interface{}, error) {
+		results := make([]WriteResult, len(appends))
+		for i, a := range appends {
+			if err := es.checkExpected(tr, a.Stream, a.ExpectedVersion); err != nil {
+				return nil, err
+			}
+			records, versions, err := es.appendStream(tr, a.Stream, a.Records, false)
+			if err != nil {
+				return nil, err
+			}
+			written[i] = records
+			tokens[i] = es.streamToken(tr, a.Stream)
+			results[i] = WriteResult{Stream: a.Stream, Versions: versions}
+		}
+		stamp = tr.GetVersionstamp()
+		return results, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	results := v.([]WriteResult)
+	for i := range results {
+		results[i].Retries = retries
+		if results[i].Positions, err = Positions(stamp, results[i].Stream, results[i].Versions); err != nil {
+			return nil, err
+		}
+	}
+	for i, r := range results {
+		es.internCommitted(r.Stream, tokens[i])
+		es.committed(r.Stream, written[i], r.Versions, r.Positions)
+	}
+	return results, nil
+}
@@ -0,0 +1,79 @@
+package eventstore
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+// MaxStreamNameLength is the longest stream name in bytes. Names are part
+// of several keys of every event, so they are kept well below the key
+// size limit.
+const MaxStreamNameLength = 1000
+
+// ErrInvalidStreamName is returned for stream names that can't be stored
+type ErrInvalidStreamName struct {
+	Stream string
+	Reason string
+}
+
+func (e *ErrInvalidStreamName) Error() string {
+	return fmt.Sprintf("invalid stream name %q: %s", e.Stream, e.Reason)
+}
+
+// validateStreamName checks a stream name given by a caller. Names go into
+// keys as tuple strings, whose encoding escapes every byte that could end
+// the element, so distinct names never share keys. Names starting with "$"
+// are reserved for streams the store writes itself and can be read but
+// not written.
+//
+// Names must be valid UTF-8 so they survive the JSON of Export unchanged.
+func validateStreamName(stream string, write bool) error {
+	switch {
+	case stream == "":
+		return &ErrInvalidStreamName{stream, "empty"}
+	case len(stream) > MaxStreamNameLength:
+		return &ErrInvalidStreamName{stream, fmt.Sprintf("longer than %d bytes", MaxStreamNameLength)}
+	case !utf8.ValidString(stream):
+		return &ErrInvalidStreamName{stream, "not valid UTF-8"}
+	case write && strings.HasPrefix(stream, "$"):
+		return &ErrInvalidStreamName{stream, `the "$" prefix is reserved`}
+	}
+	return nil
+}
+
+// MaxContractLength is the longest contract in bytes
+const MaxContractLength = 256
+
+// MaxEventIDLength is the longest event id in bytes
+const MaxEventIDLength = 128
+
+// ErrInvalidEvent is returned by appends for a record that can't be
+// stored. Index is the position of the record in the appended batch.
+type ErrInvalidEvent struct {
+	Index  int
+	Reason string
+}
+
+func (e *ErrInvalidEvent) Error() string {
+	return fmt.Sprintf("invalid event %d: %s", e.Index, e.Reason)
+}
+
+// checkRecords validates a batch before anything is written
+func (es *EventStore) checkRecords(stream string, records []EventRecord) error {
+	for i, r := range records {
+		switch {
+		case r.Contract == "":
+			return &ErrInvalidEvent{i, "empty contract"}
+		case len(r.Contract) > MaxContractLength:
+			return &ErrInvalidEvent{i, fmt.Sprintf("contract longer than %d bytes", MaxContractLength)}
+		case !utf8.ValidString(r.Contract):
+			return &ErrInvalidEvent{i, "contract is not valid UTF-8"}
+		case len(r.EventID) > MaxEventIDLength:
+			return &ErrInvalidEvent{i, fmt.Sprintf("event id longer than %d bytes", MaxEventIDLength)}
+		case !utf8.ValidString(r.EventID):
+			return &ErrInvalidEvent{i, "event id is not valid UTF-8"}
+		}
+	}
+	return es.checkSizes(stream, records)
+}
@@ -0,0 +1,308 @@
+package eventstore
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/FoundationDB/fdb-go/fdb"
+	"github.com/FoundationDB/fdb-go/fdb/subspace"
+	"github.com/FoundationDB/fdb-go/fdb/tuple"
+	"github.com/abdullin/go-layers/queue"
+	"time"
+)
+
+var (
+	ErrSubscriptionExists   = errors.New("persistent subscription already exists")
+	ErrSubscriptionNotFound = errors.New("persistent subscription not found")
+)
+
+// persistentMaxRetries is the number of times an event is handed out
+// before it is parked
+const persistentMaxRetries = 10
+
+// persistentAckTimeout is how long a consumer may hold an event before it
+// is handed out again
+const persistentAckTimeout = 30 * time.Second
+
+// persistentWindow is the number of queued events consumers pick from at
+// random, so they rarely claim the same one
+const persistentWindow = 20
+
+// subscriptionGroup is the storage of one persistent subscription
+type subscriptionGroup struct {
+	config    fdb.Key           // Filter as JSON
+	position  fdb.Key           // pump checkpoint
+	queue     queue.Queue       // (position, attempts) waiting for a consumer
+	inFlight  subspace.Subspace // position -> (attempts, deadline)
+	deadlines subspace.Subspace // (deadline, position) -> ''
+	parked    subspace.Subspace // position -> attempts
+}
+
+func (es *EventStore) group(name string) subscriptionGroup {
+	sub := es.persistent.Sub(name)
+	return subscriptionGroup{
+		config:    sub.Pack(tuple.Tuple{"config"}),
+		position:  sub.Pack(tuple.Tuple{"pos"}),
+		queue:     queue.New(sub.Sub("queue"), false),
+		inFlight:  sub.Sub("inflight"),
+		deadlines: sub.Sub("deadline"),
+		parked:    sub.Sub("parked"),
+	}
+}
+
+// delivery is an event handed to a consumer
+type delivery struct {
+	pos      Position
+	attempts int64
+	deadline int64
+	event    RecordedEvent
+}
+
+func encodeDelivery(pos Position, attempts int64) []byte {
+	return tuple.Tuple{[]byte(pos), attempts}.Pack()
+}
+
+func decodeDelivery(val []byte) (Position, int64) {
+	t, err := tuple.Unpack(val)
+	if err != nil {
+		panic(err)
+	}
+	return Position(t[0].([]byte)), t[1].(int64)
+}
+
+// CreatePersistentSubscription registers a subscription group that
+// receives events matching the filter from the beginning of the store.
+// Events reach the group once PumpPersistentSubscription runs for it.
+func (es *EventStore) CreatePersistentSubscription(db fdb.Database, group string, filter Filter) error {
+	config, err := json.Marshal(filter)
+	if err != nil {
+		return err
+	}
+
+	g := es.group(group)
+	_, err = db.Transact(func(tr fdb.Transaction) (interface{}, error) {
+		if tr.Get(g.config).GetOrPanic() != nil {
+			return nil, ErrSubscriptionExists
+		}
+		tr.Set(g.config, config)
+		return nil, nil
+	})
+	return err
+}
+
+// PumpPersistentSubscription copies events matching the group filter into
+// the group queue until ctx is cancelled. The checkpoint is written in the
+// same transaction as the pushes, so the pump can be stopped and restarted
+// at any point without skipping or duplicating events.
+func (es *EventStore) PumpPersistentSubscription(ctx context.Context, db fdb.Database, group string) error {
+	g := es.group(group)
+	backoff := 0.01
+
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		moved, err := db.Transact(func(tr fdb.Transaction) (interface{}, error) {
+			return es.pumpBatch(tr, g)
+		})
+		if err != nil {
+			return err
+		}
+		if moved.(bool) {
+			backoff = 0.01
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(time.Duration(backoff * float64(time.Second))):
+		}
+		backoff = backoff * 2
+		if backoff > 1 {
+			backoff = 1
+		}
+	}
+}
+
+// pumpBatch queues the next batch of matching events and reports whether
+// the checkpoint moved
+func (es *EventStore) pumpBatch(tr fdb.Transaction, g subscriptionGroup) (bool, error) {
+	config := tr.Get(g.config).GetOrPanic()
+	if config == nil {
+		return false, ErrSubscriptionNotFound
+	}
+	var filter Filter
+	if err := json.Unmarshal(config, &filter); err != nil {
+		return false, err
+	}
+
+	from := Position(tr.Get(g.position).GetOrPanic())
+	events, next, err := es.scanAll(tr, from, 500, filter)
+	if err != nil {
+		return false, err
+	}
+
+	for _, evt := range events {
+		g.queue.Push(tr, encodeDelivery(evt.GlobalPosition, 0))
+	}
+	if bytes.Equal(next, from) {
+		return false, nil
+	}
+	tr.Set(g.position, next)
+	return true, nil
+}
+
+// ConsumePersistent competes with other consumers of the group for queued
+// events and passes them to handler one at a time until ctx is cancelled.
+// An event is acknowledged when handler returns nil. A failed event is
+// queued again and parked after persistentMaxRetries attempts; one held
+// longer than persistentAckTimeout, e.g. by a crashed consumer, is handed
+// out again, so handlers must tolerate repeats. Events are not delivered
+// in order.
+func (es *EventStore) ConsumePersistent(ctx context.Context, db fdb.Database, group string, handler func(RecordedEvent) error) error {
+	g := es.group(group)
+	backoff := 0.01
+
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		d, err := es.takeDelivery(db, g)
+		if err != nil {
+			return err
+		}
+
+		if d != nil {
+			backoff = 0.01
+			if err := es.settle(db, g, d, handler(d.event)); err != nil {
+				return err
+			}
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(time.Duration(backoff * float64(time.Second))):
+		}
+		backoff = backoff * 2
+		if backoff > 1 {
+			backoff = 1
+		}
+	}
+}
+
+// takeDelivery claims one of the first queued events that still exists
+// and marks it as in flight. Nil means the queue is empty.
+func (es *EventStore) takeDelivery(db fdb.Database, g subscriptionGroup) (*delivery, error) {
+	v, err := db.Transact(func(tr fdb.Transaction) (interface{}, error) {
+		now := time.Now()
+		es.requeueExpired(tr, g, now.Unix())
+
+		for {
+			value, ok := g.queue.PopAnyTr(tr, persistentWindow)
+			if !ok {
+				return (*delivery)(nil), nil
+			}
+
+			pos, attempts := decodeDelivery(value)
+			evt, found, err := es.loadGlobal(tr, pos)
+			if err != nil {
+				return nil, err
+			}
+			if !found {
+				// scavenged since it was queued
+				continue
+			}
+
+			deadline := now.Add(persistentAckTimeout).Unix()
+			tr.Set(g.inFlight.Pack(tuple.Tuple{[]byte(pos)}), tuple.Tuple{attempts, deadline}.Pack())
+			tr.Set(g.deadlines.Pack(tuple.Tuple{deadline, []byte(pos)}), []byte(""))
+			return &delivery{pos, attempts, deadline, evt}, nil
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	d := v.(*delivery)
+	if d != nil {
+		if d.event, err = es.interceptRead(d.event); err != nil {
+			return nil, err
+		}
+	}
+	return d, nil
+}
+
+// requeueExpired queues again events whose consumer did not settle them
+// by now, the earliest deadlines first
+func (es *EventStore) requeueExpired(tr fdb.Transaction, g subscriptionGroup, now int64) {
+	begin, _ := g.deadlines.FDBRangeKeys()
+	expired := fdb.KeyRange{Begin: begin, End: g.deadlines.Pack(tuple.Tuple{now + 1})}
+	kvs := tr.Snapshot().GetRange(expired, fdb.RangeOptions{Limit: 10}).GetSliceOrPanic()
+
+	for _, kv := range kvs {
+		k, err := g.deadlines.Unpack(kv.Key)
+		if err != nil {
+			panic(err)
+		}
+		pos := Position(k[1].([]byte))
+		// conflict with consumers settling or requeueing the same event
+		attempts, ok := es.unsettled(tr, g, pos, k[0].(int64))
+		if !ok {
+			// left behind by an older delivery of the event
+			tr.Clear(kv.Key)
+			continue
+		}
+		es.clearInFlight(tr, g, pos, k[0].(int64))
+		es.retry(tr, g, pos, attempts+1)
+	}
+}
+
+// unsettled returns the attempts of an in-flight event if it is still
+// held until the deadline, and so by the same delivery
+func (es *EventStore) unsettled(tr fdb.Transaction, g subscriptionGroup, pos Position, deadline int64) (int64, bool) {
+	val := tr.Get(g.inFlight.Pack(tuple.Tuple{[]byte(pos)})).GetOrPanic()
+	if val == nil {
+		return 0, false
+	}
+	t, err := tuple.Unpack(val)
+	if err != nil {
+		panic(err)
+	}
+	return t[0].(int64), t[1].(int64) == deadline
+}
+
+func (es *EventStore) clearInFlight(tr fdb.Transaction, g subscriptionGroup, pos Position, deadline int64) {
+	tr.Clear(g.inFlight.Pack(tuple.Tuple{[]byte(pos)}))
+	tr.Clear(g.deadlines.Pack(tuple.Tuple{deadline, []byte(pos)}))
+}
+
+// settle acknowledges the delivery or hands it out again after a failure
+func (es *EventStore) settle(db fdb.Database, g subscriptionGroup, d *delivery, failure error) error {
+	_, err := db.Transact(func(tr fdb.Transaction) (interface{}, error) {
+		attempts, ok := es.unsettled(tr, g, d.pos, d.deadline)
+		if !ok || attempts != d.attempts {
+			// timed out and already handed to another consumer
+			return nil, nil
+		}
+		es.clearInFlight(tr, g, d.pos, d.deadline)
+		if failure != nil {
+			es.retry(tr, g, d.pos, d.attempts+1)
+		}
+		return nil, nil
+	})
+	return err
+}
+
+func (es *EventStore) retry(tr fdb.Transaction, g subscriptionGroup, pos Position, attempts int64) {
+	if attempts >= persistentMaxRetries {
+		tr.Set(g.parked.Pack(tuple.Tuple{[]byte(pos)}), tuple.Tuple{attempts}.Pack())
+		return
+	}
+	g.queue.Push(tr, encodeDelivery(pos, attempts))
+}
@@ -0,0 +1,264 @@
+package eventstore
+
+import (
+	"context"
+	"errors"
+	"github.com/FoundationDB/fdb-go/fdb"
+	"github.com/FoundationDB/fdb-go/fdb/tuple"
+	"github.com/abdullin/go-layers/internal/fdbtest"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+// pumpAll queues every event the pump has not queued yet
+func pumpAll(t *testing.T, db fdb.Database, es *EventStore, group string) {
+	t.Helper()
+	g := es.group(group)
+	for {
+		moved, err := db.Transact(func(tr fdb.Transaction) (interface{}, error) {
+			return es.pumpBatch(tr, g)
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !moved.(bool) {
+			return
+		}
+	}
+}
+
+// queued returns the positions waiting in the queue of the group
+func queued(t *testing.T, db fdb.Database, es *EventStore, group string) map[string]int {
+	t.Helper()
+	g := es.group(group)
+	v, err := db.Transact(func(tr fdb.Transaction) (interface{}, error) {
+		return tr.GetRange(g.queue.Subspace.Sub("item"), fdb.RangeOptions{}).GetSliceWithError()
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	positions := map[string]int{}
+	for _, kv := range v.([]fdb.KeyValue) {
+		item, err := tuple.Unpack(kv.Value)
+		if err != nil {
+			t.Fatal(err)
+		}
+		pos, _ := decodeDelivery(item[0].([]byte))
+		positions[string(pos)]++
+	}
+	return positions
+}
+
+// rangeLen returns the number of keys in the range
+func rangeLen(t *testing.T, db fdb.Database, r fdb.ExactRange) int {
+	t.Helper()
+	v, err := db.Transact(func(tr fdb.Transaction) (interface{}, error) {
+		kvs, err := tr.GetRange(r, fdb.RangeOptions{}).GetSliceWithError()
+		return len(kvs), err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return v.(int)
+}
+
+func appendEvents(t *testing.T, db fdb.Database, es *EventStore, streams, perStream int) {
+	t.Helper()
+	for s := 0; s < streams; s++ {
+		if err := es.Append(db, "s-"+strconv.Itoa(s), ExpectedAny, sameContract(perStream)); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestPersistentPumpRestart(t *testing.T) {
+	db, sub := fdbtest.Open(t)
+	es := New(sub)
+	if err := es.CreatePersistentSubscription(db, "g", Filter{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := es.CreatePersistentSubscription(db, "g", Filter{}); err != ErrSubscriptionExists {
+		t.Fatalf("created twice: %v", err)
+	}
+
+	// several batches of the pump, appended while it is stopped and
+	// restarted
+	const total = 1300
+	appendEvents(t, db, es, 5, 100)
+	for round := 0; round < 4; round++ {
+		ctx, cancel := context.WithCancel(context.Background())
+		done := make(chan error, 1)
+		go func() { done <- es.PumpPersistentSubscription(ctx, db, "g") }()
+		time.Sleep(50 * time.Millisecond)
+		cancel()
+		if err := <-done; err != context.Canceled {
+			t.Fatal(err)
+		}
+		if round < 2 {
+			appendEvents(t, db, es, 2, 200)
+		}
+	}
+	pumpAll(t, db, es, "g")
+
+	events, _, err := es.ReadAll(db, nil, 0, Filter{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != total {
+		t.Fatalf("read %d events, want %d", len(events), total)
+	}
+	positions := queued(t, db, es, "g")
+	if len(positions) != total {
+		t.Fatalf("%d events queued, want %d", len(positions), total)
+	}
+	for _, evt := range events {
+		if n := positions[string(evt.GlobalPosition)]; n != 1 {
+			t.Fatalf("%s@%d queued %d times", evt.StreamName, evt.StreamVersion, n)
+		}
+	}
+}
+
+func TestPersistentAck(t *testing.T) {
+	db, sub := fdbtest.Open(t)
+	es := New(sub)
+	if err := es.CreatePersistentSubscription(db, "g", Filter{}); err != nil {
+		t.Fatal(err)
+	}
+	const total = 100
+	appendEvents(t, db, es, 4, total/4)
+	pumpAll(t, db, es, "g")
+
+	// competing consumers share the events between them
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	var mu sync.Mutex
+	seen := map[string]int{}
+	var wg sync.WaitGroup
+	errs := make(chan error, 4)
+	for c := 0; c < 4; c++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs <- es.ConsumePersistent(ctx, db, "g", func(evt RecordedEvent) error {
+				mu.Lock()
+				defer mu.Unlock()
+				seen[string(evt.GlobalPosition)]++
+				if len(seen) == total {
+					cancel()
+				}
+				return nil
+			})
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != context.Canceled {
+			t.Fatal(err)
+		}
+	}
+
+	for pos, n := range seen {
+		if n != 1 {
+			t.Fatalf("event at %x handled %d times", pos, n)
+		}
+	}
+	g := es.group("g")
+	if n := len(queued(t, db, es, "g")); n != 0 {
+		t.Fatalf("%d events left queued", n)
+	}
+	if n := rangeLen(t, db, g.inFlight); n != 0 {
+		t.Fatalf("%d events left in flight", n)
+	}
+	if n := rangeLen(t, db, g.deadlines); n != 0 {
+		t.Fatalf("%d deadlines left", n)
+	}
+}
+
+func TestPersistentParked(t *testing.T) {
+	db, sub := fdbtest.Open(t)
+	es := New(sub)
+	if err := es.CreatePersistentSubscription(db, "g", Filter{}); err != nil {
+		t.Fatal(err)
+	}
+	appendEvents(t, db, es, 1, 1)
+	pumpAll(t, db, es, "g")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	calls := 0
+	err := es.ConsumePersistent(ctx, db, "g", func(evt RecordedEvent) error {
+		if calls++; calls == persistentMaxRetries {
+			cancel()
+		}
+		return errors.New("failed")
+	})
+	if err != context.Canceled {
+		t.Fatal(err)
+	}
+
+	g := es.group("g")
+	if n := rangeLen(t, db, g.parked); n != 1 {
+		t.Fatalf("%d events parked after %d failures", n, calls)
+	}
+	if n := len(queued(t, db, es, "g")); n != 0 {
+		t.Fatalf("parked event still queued %d times", n)
+	}
+	if n := rangeLen(t, db, g.inFlight); n != 0 {
+		t.Fatalf("parked event still in flight")
+	}
+}
+
+func TestPersistentTimeout(t *testing.T) {
+	db, sub := fdbtest.Open(t)
+	es := New(sub)
+	if err := es.CreatePersistentSubscription(db, "g", Filter{}); err != nil {
+		t.Fatal(err)
+	}
+	appendEvents(t, db, es, 1, 1)
+	pumpAll(t, db, es, "g")
+	g := es.group("g")
+
+	held, err := es.takeDelivery(db, g)
+	if err != nil || held == nil {
+		t.Fatalf("took %v, %v", held, err)
+	}
+	if again, err := es.takeDelivery(db, g); err != nil || again != nil {
+		t.Fatalf("took a held event again: %v, %v", again, err)
+	}
+
+	// the consumer holding the event stops answering past its deadline
+	_, err = db.Transact(func(tr fdb.Transaction) (interface{}, error) {
+		es.requeueExpired(tr, g, time.Now().Add(persistentAckTimeout+time.Second).Unix())
+		return nil, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	redelivered, err := es.takeDelivery(db, g)
+	if err != nil || redelivered == nil {
+		t.Fatalf("took %v, %v after the deadline", redelivered, err)
+	}
+	if string(redelivered.pos) != string(held.pos) || redelivered.attempts != 1 {
+		t.Fatalf("redelivered %x attempt %d, held %x", redelivered.pos, redelivered.attempts, held.pos)
+	}
+
+	// the late answer of the first consumer leaves the new delivery alone
+	if err := es.settle(db, g, held, nil); err != nil {
+		t.Fatal(err)
+	}
+	if n := rangeLen(t, db, g.inFlight); n != 1 {
+		t.Fatalf("%d events in flight after a late ack", n)
+	}
+	if err := es.settle(db, g, redelivered, nil); err != nil {
+		t.Fatal(err)
+	}
+	if n := rangeLen(t, db, g.inFlight); n != 0 {
+		t.Fatalf("%d events in flight after the ack", n)
+	}
+	if n := rangeLen(t, db, g.deadlines); n != 0 {
+		t.Fatalf("%d deadlines left after the ack", n)
+	}
+}
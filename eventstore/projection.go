@@ -0,0 +1,155 @@
+package eventstore
+
+import (
+	"bytes"
+	"context"
+	"github.com/FoundationDB/fdb-go/fdb"
+	"github.com/FoundationDB/fdb-go/fdb/tuple"
+	"time"
+)
+
+// Source selects the events a projection folds over: a single stream,
+// the streams of a category, or the global space with a filter
+type Source struct {
+	Stream string
+	// Category matches streams named "<Category>-<id>"
+	Category string
+	// Filter selects events of the global space when Stream and Category
+	// are empty
+	Filter Filter
+
+	// BatchSize is the number of events per transaction, 100 by default
+	BatchSize int
+	// PollInterval is the wait before looking for new events once the
+	// projection caught up, 500ms by default
+	PollInterval time.Duration
+}
+
+func StreamSource(stream string) Source {
+	return Source{Stream: stream}
+}
+
+func CategorySource(category string) Source {
+	return Source{Category: category}
+}
+
+func AllSource(filter Filter) Source {
+	return Source{Filter: filter}
+}
+
+func (es *EventStore) projectionCheckpoint(name string) fdb.Key {
+	return es.cursors.Pack(tuple.Tuple{"projection", name})
+}
+
+// RunProjection folds handler over the events of the source until ctx is
+// cancelled or handler fails. Each batch runs in one transaction together
+// with the writes of handler and the checkpoint of the projection, so
+// after a crash or a failed batch the projection resumes right after the
+// last committed batch. handler may be called again for events of a
+// batch that was retried.
+func (es *EventStore) RunProjection(ctx context.Context, db fdb.Database, name string, source Source, handler func(tr fdb.Transaction, ev RecordedEvent) error) error {
+	if source.BatchSize <= 0 {
+		source.BatchSize = 100
+	}
+	if source.PollInterval <= 0 {
+		source.PollInterval = 500 * time.Millisecond
+	}
+	if source.Stream == "" && source.Category != "" {
+		source.Filter = Filter{StreamPrefix: source.Category + "-"}
+	}
+	checkpoint := es.projectionCheckpoint(name)
+	if source.Stream == "" {
+		// listed and managed with the consumer groups
+		checkpoint = es.consumerKey(name)
+	}
+
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		moved, err := db.Transact(func(tr fdb.Transaction) (interface{}, error) {
+			if source.Stream != "" {
+				return es.projectStream(tr, checkpoint, source, handler)
+			}
+			return es.projectAll(tr, checkpoint, source, handler)
+		})
+		if err != nil {
+			return err
+		}
+		if moved.(bool) {
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(source.PollInterval):
+		}
+	}
+}
+
+// projectStream applies the next batch of a stream source and reports
+// whether the checkpoint moved. The checkpoint is the next version.
+func (es *EventStore) projectStream(tr fdb.Transaction, checkpoint fdb.Key, source Source, handler func(fdb.Transaction, RecordedEvent) error) (bool, error) {
+	from := int64(0)
+	if val := tr.Get(checkpoint).GetOrPanic(); val != nil {
+		from = decodeInt(val)
+	}
+
+	opts := ReadOptions{From: from, Limit: source.BatchSize, RawLinks: true}
+	events, err := es.readStream(tr, source.Stream, opts)
+	if err != nil {
+		return false, err
+	}
+
+	next := from
+	for _, evt := range events {
+		next = evt.StreamVersion + 1
+		if evt.Contract == LinkContract {
+			evt = es.resolveLink(tr, evt)
+		}
+		if evt, err = es.interceptRead(evt); err != nil {
+			return false, err
+		}
+		if err := handler(tr, evt); err != nil {
+			return false, err
+		}
+	}
+
+	// move past a window hidden by retention
+	if last := es.lastVersion(tr, source.Stream); len(events) == 0 && from <= last {
+		next = from + int64(source.BatchSize)
+		if next > last+1 {
+			next = last + 1
+		}
+	}
+
+	if next == from {
+		return false, nil
+	}
+	tr.Set(checkpoint, tuple.Tuple{next}.Pack())
+	return true, nil
+}
+
+// projectAll applies the next batch of the global space and reports
+// whether the checkpoint moved. The checkpoint is a Position.
+func (es *EventStore) projectAll(tr fdb.Transaction, checkpoint fdb.Key, source Source, handler func(fdb.Transaction, RecordedEvent) error) (bool, error) {
+	from := Position(tr.Get(checkpoint).GetOrPanic())
+
+	events, next, err := es.readAll(tr, from, source.BatchSize, source.Filter)
+	if err != nil {
+		return false, err
+	}
+	for _, evt := range events {
+		if err := handler(tr, evt); err != nil {
+			return false, err
+		}
+	}
+
+	if bytes.Equal(next, from) {
+		return false, nil
+	}
+	tr.Set(checkpoint, next)
+	return true, nil
+}
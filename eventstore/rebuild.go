@@ -0,0 +1,189 @@
+package eventstore
+
+import (
+	"bytes"
+	"context"
+	"github.com/FoundationDB/fdb-go/fdb"
+	"github.com/FoundationDB/fdb-go/fdb/subspace"
+	"github.com/FoundationDB/fdb-go/fdb/tuple"
+)
+
+// IndexSet selects secondary indexes
+type IndexSet int
+
+const (
+	IndexTime    IndexSet = 1 << iota // events by creation time, for ReadByTime
+	IndexEventID                      // events by id, for ReadEventByID
+
+	AllIndexes = IndexTime | IndexEventID
+)
+
+// rebuildBatch is the number of events indexed per transaction
+const rebuildBatch = 500
+
+type RebuildReport struct {
+	EventsScanned int64
+	// Written is the number of entries written per index
+	Written map[IndexSet]int64
+}
+
+// RebuildIndexes clears the selected indexes and writes them again from
+// the global space, one batch per transaction. The position is persisted
+// after each batch, so an interrupted run resumes where it stopped; a run
+// for a different set starts over.
+//
+// Appends running meanwhile index their own events. Index keys are derived
+// from the event, so the rebuild writing the same event again leaves a
+// single entry, and an id reused by a newer event keeps pointing at it.
+func (es *EventStore) RebuildIndexes(ctx context.Context, db fdb.Database, which IndexSet) (RebuildReport, error) {
+	report := RebuildReport{Written: map[IndexSet]int64{}}
+	cursor := es.cursors.Pack(tuple.Tuple{"rebuild"})
+
+	_, err := db.Transact(func(tr fdb.Transaction) (interface{}, error) {
+		if val := tr.Get(cursor).GetOrPanic(); val != nil {
+			if t, err := tuple.Unpack(val); err == nil && IndexSet(t[0].(int64)) == which {
+				return nil, nil
+			}
+		}
+		for _, sub := range es.indexSubspaces(which) {
+			tr.ClearRange(sub)
+		}
+		tr.Set(cursor, tuple.Tuple{int64(which), []byte(nil)}.Pack())
+		return nil, nil
+	})
+	if err != nil {
+		return report, err
+	}
+
+	for {
+		if err := ctx.Err(); err != nil {
+			return report, err
+		}
+
+		var batch RebuildReport
+		v, err := db.Transact(func(tr fdb.Transaction) (interface{}, error) {
+			batch = RebuildReport{Written: map[IndexSet]int64{}}
+			return es.rebuildBatch(tr, cursor, which, &batch)
+		})
+		if err != nil {
+			return report, err
+		}
+
+		report.EventsScanned += batch.EventsScanned
+		for index, n := range batch.Written {
+			report.Written[index] += n
+		}
+		if done := v.(bool); done {
+			return report, nil
+		}
+	}
+}
+
+func (es *EventStore) indexSubspaces(which IndexSet) []subspace.Subspace {
+	var subs []subspace.Subspace
+	if which&IndexTime != 0 {
+		subs = append(subs, es.byTime)
+	}
+	if which&IndexEventID != 0 {
+		subs = append(subs, es.ids)
+	}
+	return subs
+}
+
+// rebuildBatch indexes the next events after the cursor. Returns true once
+// the global space is done.
+func (es *EventStore) rebuildBatch(tr fdb.Transaction, cursor fdb.Key, which IndexSet, report *RebuildReport) (bool, error) {
+	t, err := tuple.Unpack(tr.Get(cursor).GetOrPanic())
+	if err != nil {
+		return false, err
+	}
+	begin := es.global.FDBKey()
+	if last := t[1].([]byte); len(last) > 0 {
+		begin = fdb.Key(concat(es.global.Bytes(), last, []byte{0x00}))
+	}
+	_, end := es.global.FDBRangeKeys()
+
+	kvs := tr.GetRange(fdb.KeyRange{Begin: begin, End: end}, fdb.RangeOptions{Limit: rebuildBatch}).GetSliceOrPanic()
+	for _, kv := range kvs {
+		pos := Position(kv.Key[len(es.global.Bytes()):])
+		if err := es.reindex(tr, pos, kv.Value, which, report); err != nil {
+			return false, err
+		}
+		report.EventsScanned++
+	}
+
+	if len(kvs) < rebuildBatch {
+		tr.Clear(cursor)
+		return true, nil
+	}
+	last := kvs[len(kvs)-1].Key[len(es.global.Bytes()):]
+	tr.Set(cursor, tuple.Tuple{int64(which), []byte(last)}.Pack())
+	return false, nil
+}
+
+// reindex writes the selected index entries of the event stored at the
+// position. Payloads are left sealed, the indexed fields are plain.
+func (es *EventStore) reindex(tr fdb.Transaction, pos Position, val []byte, which IndexSet, report *RebuildReport) error {
+	t, err := tuple.Unpack(pos[stampLen:])
+	if err != nil || len(t) != 2 {
+		return errBadGlobalKey
+	}
+	stream, ok1 := t[0].(string)
+	version, ok2 := t[1].(int64)
+	if !ok1 || !ok2 {
+		return errBadGlobalKey
+	}
+	// events of metadata streams are not indexed
+	if isMetadataStream(stream) {
+		return nil
+	}
+
+	if valueFormat(val) == pointerFormat {
+		var err error
+		if val, err = es.unarchive(tr, val); err != nil {
+			return err
+		}
+	}
+	env, err := decodeEnvelope(val)
+	if err != nil {
+		return err
+	}
+	// entries hold (stream, version), the part of the position after the
+	// versionstamp, or its interned form
+	target, err := es.indexRef(tr, stream, version)
+	if err != nil {
+		return err
+	}
+
+	if which&IndexTime != 0 {
+		tr.Set(fdb.Key(concat(es.timeBucket(timeBucket(env.created)), pos[:stampLen], target)), tuple.Tuple{env.created}.Pack())
+		report.Written[IndexTime]++
+	}
+
+	if which&IndexEventID != 0 && env.id != "" {
+		key := es.eventIDKey(env.id)
+		if current := tr.Get(key).GetOrPanic(); current != nil && !bytes.Equal(current, target) {
+			if newer := es.eventIDPosition(tr, current); newer != nil && bytes.Compare(newer, pos) > 0 {
+				return nil
+			}
+		}
+		tr.Set(key, target)
+		report.Written[IndexEventID]++
+	}
+	return nil
+}
+
+// eventIDPosition returns the position of the event an id entry points at,
+// nil if it is gone
+func (es *EventStore) eventIDPosition(tr fdb.Transaction, entry []byte) Position {
+	stream, version, err := es.resolveRef(tr, entry)
+	if err != nil {
+		return nil
+	}
+	ref := tuple.Tuple{stream, version}
+	val := tr.Get(es.events.Pack(ref)).GetOrPanic()
+	if len(val) < headerLen {
+		return nil
+	}
+	return Position(concat(val[stampOffset:stampOffset+stampLen], ref.Pack()))
+}
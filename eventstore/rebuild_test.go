@@ -0,0 +1,91 @@
+package eventstore
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"github.com/FoundationDB/fdb-go/fdb"
+	"github.com/FoundationDB/fdb-go/fdb/tuple"
+	"github.com/abdullin/go-layers/internal/fdbtest"
+	"testing"
+	"time"
+)
+
+func TestRebuildIndexes(t *testing.T) {
+	db, sub := fdbtest.Open(t)
+	es := New(sub)
+	ctx := context.Background()
+
+	// more events than a rebuild batch, so the run resumes from its cursor
+	const total = rebuildBatch + 20
+	for _, stream := range []string{"a", "b"} {
+		records := make([]EventRecord, total/2)
+		for i := range records {
+			records[i] = EventRecord{Contract: "C", Data: []byte{byte(i)}, EventID: fmt.Sprintf("%s-%d", stream, i)}
+		}
+		if err := es.Append(db, stream, ExpectedNoStream, records); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// lose the time index and an id, and point two entries at no event
+	now := time.Now().Unix()
+	ghost := tuple.Tuple{"a", int64(total)}.Pack()
+	ghostTime := fdb.Key(concat(es.timeBucket(timeBucket(now)), bytes.Repeat([]byte{0xff}, stampLen), ghost))
+	_, err := db.Transact(func(tr fdb.Transaction) (interface{}, error) {
+		tr.ClearRange(es.byTime)
+		tr.Clear(es.eventIDKey("b-7"))
+		tr.Set(es.eventIDKey("ghost"), ghost)
+		tr.Set(ghostTime, tuple.Tuple{now}.Pack())
+		return nil, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	report, err := es.CheckIntegrity(ctx, db, IntegrityOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	dangling := map[string]bool{}
+	for _, a := range report.Anomalies {
+		if a.Kind != AnomalyDanglingIndex {
+			t.Fatalf("unexpected anomaly %+v", a)
+		}
+		dangling[string(a.Key)] = true
+	}
+	if len(dangling) != 2 || !dangling[string(es.eventIDKey("ghost"))] || !dangling[string(ghostTime)] {
+		t.Fatalf("found dangling entries %+v", report.Anomalies)
+	}
+	if _, ok, err := es.ReadEventByID(db, "b-7"); err != nil || ok {
+		t.Fatalf("read a cleared id: %v, %v", ok, err)
+	}
+
+	rebuilt, err := es.RebuildIndexes(ctx, db, AllIndexes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rebuilt.EventsScanned != total || rebuilt.Written[IndexTime] != total || rebuilt.Written[IndexEventID] != total {
+		t.Fatalf("rebuild report %+v, want %d events", rebuilt, total)
+	}
+
+	evt, ok, err := es.ReadEventByID(db, "b-7")
+	if err != nil || !ok || evt.StreamName != "b" || evt.StreamVersion != 7 {
+		t.Fatalf("read b-7 after the rebuild: %+v, %v, %v", evt, ok, err)
+	}
+	if _, ok, err := es.ReadEventByID(db, "ghost"); err != nil || ok {
+		t.Fatalf("read the dangling id after the rebuild: %v, %v", ok, err)
+	}
+	events, _, err := es.ReadByTime(db, time.Now().Add(-time.Hour), time.Now().Add(time.Hour), nil, 0)
+	if err != nil || len(events) != total {
+		t.Fatalf("read %d events by time after the rebuild, %v", len(events), err)
+	}
+
+	report, err = es.CheckIntegrity(ctx, db, IntegrityOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Anomalies) != 0 || report.IndexChecked != 2*total {
+		t.Fatalf("after the rebuild checked %d index entries, found %+v", report.IndexChecked, report.Anomalies)
+	}
+}
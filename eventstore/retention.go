@@ -0,0 +1,73 @@
+package eventstore
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/FoundationDB/fdb-go/fdb"
+	"github.com/FoundationDB/fdb-go/fdb/tuple"
+	"time"
+)
+
+// ErrTruncated is returned when reading after a position that is older
+// than the store retention horizon: events after it have been removed by
+// Scavenge, so continuing would silently skip history.
+type ErrTruncated struct {
+	From Position // position the read started after
+	// TruncatedTo is the newest position removed for its age. Reading
+	// after it or from the beginning succeeds.
+	TruncatedTo Position
+}
+
+func (e *ErrTruncated) Error() string {
+	return fmt.Sprintf("position %x is older than the truncated history up to %x", []byte(e.From), []byte(e.TruncatedTo))
+}
+
+func (es *EventStore) retentionKey() fdb.Key {
+	return es.config.Pack(tuple.Tuple{"retention"})
+}
+
+func (es *EventStore) truncatedKey() fdb.Key {
+	return es.config.Pack(tuple.Tuple{"truncated"})
+}
+
+// SetRetention sets the age past which Scavenge removes events of every
+// stream, on top of their own MaxAge. Zero keeps events forever.
+func (es *EventStore) SetRetention(db fdb.Database, d time.Duration) error {
+	_, err := db.Transact(func(tr fdb.Transaction) (interface{}, error) {
+		if d <= 0 {
+			tr.Clear(es.retentionKey())
+		} else {
+			tr.Set(es.retentionKey(), tuple.Tuple{int64(d)}.Pack())
+		}
+		return nil, nil
+	})
+	return err
+}
+
+func (es *EventStore) getRetention(tr fdb.Transaction) time.Duration {
+	if val := tr.Get(es.retentionKey()).GetOrPanic(); val != nil {
+		return time.Duration(decodeInt(val))
+	}
+	return 0
+}
+
+// truncate records that the event at the position was removed for its
+// age, moving the truncation mark forward
+func (es *EventStore) truncate(tr fdb.Transaction, pos Position) {
+	if mark := tr.Get(es.truncatedKey()).GetOrPanic(); bytes.Compare(pos, mark) > 0 {
+		tr.Set(es.truncatedKey(), pos)
+	}
+}
+
+// checkTruncated fails reads after a position, or from it if inclusive,
+// when the events read may have been removed for their age
+func (es *EventStore) checkTruncated(tr fdb.Transaction, from Position, inclusive bool) error {
+	if len(from) == 0 {
+		return nil
+	}
+	mark := tr.Get(es.truncatedKey()).GetOrPanic()
+	if c := bytes.Compare(from, mark); c < 0 || (c == 0 && inclusive) {
+		return &ErrTruncated{from, Position(mark)}
+	}
+	return nil
+}
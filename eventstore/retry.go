@@ -0,0 +1,102 @@
+package eventstore
+
+import (
+	"fmt"
+	"github.com/FoundationDB/fdb-go/fdb"
+	"time"
+)
+
+// RetryPolicy bounds how long appends keep retrying transactions that
+// conflict with other writers. Zero fields have no limit.
+type RetryPolicy struct {
+	MaxRetries int
+	MaxTime    time.Duration // measured from the first attempt
+	// Backoff is the delay before the first retry, doubled up to one
+	// second on each next one. It adds to the backoff of the client.
+	Backoff time.Duration
+	// OnRetry is called before every retry with the retry number,
+	// starting at 1, and the error that caused it
+	OnRetry func(retry int, err error)
+}
+
+// ErrTooMuchContention is returned by appends when the RetryPolicy of the
+// store is exhausted. Err is the error of the last attempt.
+type ErrTooMuchContention struct {
+	Retries int
+	Err     error
+}
+
+func (e *ErrTooMuchContention) Error() string {
+	return fmt.Sprintf("append gave up after %d retries: %v", e.Retries, e.Err)
+}
+
+func (e *ErrTooMuchContention) Unwrap() error {
+	return e.Err
+}
+
+// transact runs f like db.Transact, following the RetryPolicy of the
+// store if there is one, and returns the number of retries
+func (es *EventStore) transact(db fdb.Database, f func(fdb.Transaction) (interface{}, error)) (interface{}, int, error) {
+	p := es.RetryPolicy
+	if p == nil {
+		v, err := db.Transact(f)
+		return v, 0, err
+	}
+
+	tr, err := db.CreateTransaction()
+	if err != nil {
+		return nil, 0, err
+	}
+
+	start := time.Now()
+	backoff := p.Backoff
+
+	for retries := 0; ; retries++ {
+		v, err := attempt(tr, f)
+		if err == nil {
+			return v, retries, nil
+		}
+		fe, ok := err.(fdb.Error)
+		if !ok {
+			return nil, retries, err
+		}
+
+		// fails for errors that can't be retried
+		if err := tr.OnError(fe).GetWithError(); err != nil {
+			return nil, retries, err
+		}
+		if (p.MaxRetries > 0 && retries >= p.MaxRetries) || (p.MaxTime > 0 && time.Since(start) >= p.MaxTime) {
+			return nil, retries, &ErrTooMuchContention{retries, fe}
+		}
+
+		if p.OnRetry != nil {
+			p.OnRetry(retries+1, fe)
+		}
+		if backoff > 0 {
+			time.Sleep(backoff)
+			backoff = backoff * 2
+			if backoff > time.Second {
+				backoff = time.Second
+			}
+		}
+	}
+}
+
+// attempt runs f once and commits, turning panics of the OrPanic calls
+// into errors as db.Transact does
+func attempt(tr fdb.Transaction, f func(fdb.Transaction) (interface{}, error)) (v interface{}, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			e, ok := r.(fdb.Error)
+			if !ok {
+				panic(r)
+			}
+			err = e
+		}
+	}()
+
+	if v, err = f(tr); err == nil {
+		err = tr.Commit().GetWithError()
+	}
+	return
+}
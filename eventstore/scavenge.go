@@ -0,0 +1,209 @@
+package eventstore
+
+import (
+	"context"
+	"github.com/FoundationDB/fdb-go/fdb"
+	"github.com/FoundationDB/fdb-go/fdb/tuple"
+	"time"
+)
+
+type ScavengeOptions struct {
+	// BatchSize is the number of events inspected per transaction,
+	// 1000 by default
+	BatchSize int
+	// Restart ignores the persisted cursor and starts from the first stream
+	Restart bool
+}
+
+type ScavengeReport struct {
+	StreamsScanned int64
+	EventsRemoved  int64
+	KeysRemoved    int64
+	BytesRemoved   int64
+}
+
+func (r *ScavengeReport) add(o ScavengeReport) {
+	r.StreamsScanned += o.StreamsScanned
+	r.EventsRemoved += o.EventsRemoved
+	r.KeysRemoved += o.KeysRemoved
+	r.BytesRemoved += o.BytesRemoved
+}
+
+// Scavenge physically removes events outside stream retention, events
+// older than the store retention set with SetRetention and events of
+// hard-deleted streams. Work is split into small transactions and the
+// position is persisted after each one, so an interrupted run resumes
+// where it stopped. It is safe to run concurrently with appends and reads:
+// only events that reads already hide are removed.
+func (es *EventStore) Scavenge(ctx context.Context, db fdb.Database, opts ScavengeOptions) (ScavengeReport, error) {
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = 1000
+	}
+
+	cursor := es.cursors.Pack(tuple.Tuple{"scavenge"})
+	var report ScavengeReport
+
+	if opts.Restart {
+		if _, err := db.Transact(func(tr fdb.Transaction) (interface{}, error) {
+			tr.Clear(cursor)
+			return nil, nil
+		}); err != nil {
+			return report, err
+		}
+	}
+
+	for {
+		if err := ctx.Err(); err != nil {
+			return report, err
+		}
+
+		var batch ScavengeReport
+		v, err := db.Transact(func(tr fdb.Transaction) (interface{}, error) {
+			batch = ScavengeReport{}
+			return es.scavengeBatch(tr, cursor, opts.BatchSize, &batch)
+		})
+		if err != nil {
+			return report, err
+		}
+
+		report.add(batch)
+		if done := v.(bool); done {
+			return report, nil
+		}
+	}
+}
+
+// scavengeBatch processes up to limit events of the stream under the
+// cursor and moves the cursor forward. Returns true once all streams are
+// done.
+func (es *EventStore) scavengeBatch(tr fdb.Transaction, cursor fdb.Key, limit int, report *ScavengeReport) (bool, error) {
+	from, end := es.streams.FDBRangeKeySelectors()
+	var cursorStream interface{}
+	version := int64(0)
+
+	if val := tr.Get(cursor).GetOrPanic(); val != nil {
+		t, err := tuple.Unpack(val)
+		if err != nil {
+			return false, err
+		}
+		cursorStream, version = t[0], t[1].(int64)
+		from = fdb.FirstGreaterOrEqual(es.streams.Pack(tuple.Tuple{cursorStream}))
+	}
+
+	r := fdb.SelectorRange{Begin: from, End: end}
+	kvs := tr.GetRange(r, fdb.RangeOptions{Limit: 2}).GetSliceOrPanic()
+
+	if len(kvs) == 0 {
+		tr.Clear(cursor)
+		return true, nil
+	}
+
+	t, err := es.streams.Unpack(kvs[0].Key)
+	if err != nil {
+		return false, err
+	}
+	stream := t[0].(string)
+	last := decodeInt(kvs[0].Value)
+
+	if stream != cursorStream {
+		// the stream under the cursor is gone, start the next one
+		version = 0
+	}
+
+	meta, err := es.getMetadata(tr, stream)
+	if err != nil {
+		return false, err
+	}
+	retention := es.getRetention(tr)
+	if retention > 0 && (meta.MaxAge == 0 || meta.MaxAge > retention) {
+		meta.MaxAge = retention
+	}
+
+	// skip the gap left by earlier runs
+	streamSpace := es.events.Sub(stream)
+	key := tr.GetKey(fdb.FirstGreaterOrEqual(streamSpace.Pack(tuple.Tuple{version}))).GetOrPanic()
+	if streamSpace.Contains(key) {
+		if t, err := streamSpace.Unpack(key); err == nil {
+			version = t[0].(int64)
+		}
+	}
+
+	now := time.Now().Unix()
+	events, err := es.scanStream(tr, stream, version, limit)
+	if err != nil {
+		return false, err
+	}
+	finished := version+int64(limit) > last
+
+	// events of deleted streams were uncounted by DeleteStream
+	removed := int64(0)
+	for _, evt := range events {
+		// the latest metadata event is the metadata of its stream
+		if meta.retains(evt.StreamVersion, evt.CreatedAt.Unix(), last, now) || (isMetadataStream(stream) && evt.StreamVersion == last) {
+			finished = true
+			break
+		}
+		es.removeEvent(tr, stream, evt, report)
+		if retention > 0 && time.Duration(now-evt.CreatedAt.Unix())*time.Second > retention {
+			es.truncate(tr, evt.GlobalPosition)
+		}
+		version = evt.StreamVersion + 1
+		if evt.StreamVersion >= meta.DeletedBefore {
+			removed++
+		}
+	}
+
+	if !meta.Deleted {
+		es.count(tr, stream, -removed)
+	}
+
+	switch {
+	case !finished:
+		tr.Set(cursor, tuple.Tuple{stream, version}.Pack())
+	case len(kvs) > 1:
+		report.StreamsScanned++
+		next, err := es.streams.Unpack(kvs[1].Key)
+		if err != nil {
+			return false, err
+		}
+		tr.Set(cursor, tuple.Tuple{next[0], int64(0)}.Pack())
+	default:
+		report.StreamsScanned++
+		tr.Clear(cursor)
+		return true, nil
+	}
+	return false, nil
+}
+
+// removeEvent clears an event from the stream, the global space and the
+// indexes
+func (es *EventStore) removeEvent(tr fdb.Transaction, stream string, evt storedEvent, report *ScavengeReport) {
+	key := es.events.Pack(tuple.Tuple{stream, evt.StreamVersion})
+	pointer := tr.Get(key).GetOrPanic()
+	tr.Clear(key)
+	report.EventsRemoved++
+	report.KeysRemoved += int64(evt.keys)
+	report.BytesRemoved += int64(evt.bytes)
+
+	global := fdb.Key(concat(es.global.Bytes(), evt.GlobalPosition))
+	if val := tr.Get(global).GetOrPanic(); val != nil {
+		tr.Clear(global)
+		report.KeysRemoved++
+		report.BytesRemoved += int64(len(global) + len(val))
+	}
+
+	// both copies of an archived event point at the same envelope
+	if valueFormat(pointer) == pointerFormat {
+		keys, bytes := es.unarchiveRemove(tr, pointer)
+		report.KeysRemoved += int64(keys)
+		report.BytesRemoved += int64(bytes)
+	}
+
+	keys, bytes := es.unindexTime(tr, evt.RecordedEvent)
+	report.KeysRemoved += int64(keys)
+	report.BytesRemoved += int64(bytes)
+
+	keys, bytes = es.unindexEventID(tr, evt.RecordedEvent)
+	report.KeysRemoved += int64(keys)
+	report.BytesRemoved += int64(bytes)
+}
@@ -0,0 +1,126 @@
+package eventstore
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/FoundationDB/fdb-go/fdb"
+	"reflect"
+	"sync"
+)
+
+// Serializer turns event values into payloads and back
+type Serializer interface {
+	Marshal(contract string, v interface{}) ([]byte, error)
+	Unmarshal(contract string, data []byte, v interface{}) error
+}
+
+// JSONSerializer is the default serializer
+type JSONSerializer struct{}
+
+func (JSONSerializer) Marshal(contract string, v interface{}) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+func (JSONSerializer) Unmarshal(contract string, data []byte, v interface{}) error {
+	return json.Unmarshal(data, v)
+}
+
+// Registry maps contracts to Go types. Unregistered types use the name
+// of their type as the contract.
+type Registry struct {
+	mu        sync.RWMutex
+	types     map[string]reflect.Type
+	contracts map[reflect.Type]string
+}
+
+func NewRegistry() *Registry {
+	return &Registry{
+		types:     make(map[string]reflect.Type),
+		contracts: make(map[reflect.Type]string),
+	}
+}
+
+func typeOf(v interface{}) reflect.Type {
+	t := reflect.TypeOf(v)
+	for t != nil && t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	return t
+}
+
+// Register the type of v under the contract
+func (r *Registry) Register(contract string, v interface{}) {
+	t := typeOf(v)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.types[contract] = t
+	r.contracts[t] = contract
+}
+
+// Contract returns the contract of a value, empty for nil and for values
+// of unregistered types without a name
+func (r *Registry) Contract(v interface{}) string {
+	t := typeOf(v)
+	if t == nil {
+		return ""
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if c, ok := r.contracts[t]; ok {
+		return c
+	}
+	return t.Name()
+}
+
+// New returns a pointer to a new value of the type registered for the
+// contract
+func (r *Registry) New(contract string) (interface{}, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if t, ok := r.types[contract]; ok {
+		return reflect.New(t).Interface(), true
+	}
+	return nil, false
+}
+
+// AppendValues serializes values and appends them to the stream like
+// Append with ExpectedAny. Nil values and values without a contract fail
+// with *ErrInvalidEvent.
+func (es *EventStore) AppendValues(db fdb.Database, stream string, values ...interface{}) error {
+	records := make([]EventRecord, len(values))
+	for i, v := range values {
+		if v == nil {
+			return &ErrInvalidEvent{i, "nil value"}
+		}
+		contract := es.Types.Contract(v)
+		if contract == "" {
+			return &ErrInvalidEvent{i, fmt.Sprintf("no contract for %T", v)}
+		}
+		data, err := es.Serializer.Marshal(contract, v)
+		if err != nil {
+			return err
+		}
+		records[i] = EventRecord{Contract: contract, Data: data}
+	}
+	return es.Append(db, stream, ExpectedAny, records)
+}
+
+// Decode returns the value stored in an event as the type registered for
+// its contract
+func (es *EventStore) Decode(event RecordedEvent) (interface{}, error) {
+	v, ok := es.Types.New(event.Contract)
+	if !ok {
+		return nil, fmt.Errorf("no type registered for contract %q", event.Contract)
+	}
+	if err := es.DecodeInto(event, v); err != nil {
+		return nil, err
+	}
+	return reflect.ValueOf(v).Elem().Interface(), nil
+}
+
+// DecodeInto deserializes the event data into v
+func (es *EventStore) DecodeInto(event RecordedEvent, v interface{}) error {
+	return es.Serializer.Unmarshal(event.Contract, event.Data, v)
+}
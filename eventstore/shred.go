@@ -0,0 +1,157 @@
+package eventstore
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"errors"
+	"github.com/FoundationDB/fdb-go/fdb"
+	"github.com/FoundationDB/fdb-go/fdb/tuple"
+)
+
+// MasterKey protects the data keys of streams. Data keys are unwrapped on
+// every read and write of an encrypted event, so implementations calling
+// a remote service should cache.
+type MasterKey interface {
+	Wrap(key []byte) ([]byte, error)
+	Unwrap(wrapped []byte) ([]byte, error)
+}
+
+var (
+	ErrNoMasterKey    = errors.New("event is encrypted but the store has no master key")
+	ErrStreamShredded = errors.New("stream was shredded")
+	ErrNoEncryptor    = errors.New("event is encrypted but the store has no encryptor")
+	errBadCiphertext  = errors.New("ciphertext too short")
+)
+
+// dataKey holds the wrapped data key of the stream, or an empty value
+// once the stream is shredded
+func (es *EventStore) dataKey(stream string) fdb.Key {
+	return es.keys.Pack(tuple.Tuple{stream})
+}
+
+// streamKey returns the data key of the stream, creating one if create is
+// set. Nil means the stream has none. A shredded stream never gets a new
+// key, so creating one fails with ErrStreamShredded.
+func (es *EventStore) streamKey(tr fdb.Transaction, stream string, create bool) ([]byte, error) {
+	switch wrapped := tr.Get(es.dataKey(stream)).GetOrPanic(); {
+	case wrapped != nil && len(wrapped) == 0 && create:
+		return nil, ErrStreamShredded
+	case wrapped != nil && len(wrapped) == 0:
+		return nil, nil
+	case wrapped != nil:
+		return es.Keys.Unwrap(wrapped)
+	case !create:
+		return nil, nil
+	}
+
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return nil, err
+	}
+	wrapped, err := es.Keys.Wrap(key)
+	if err != nil {
+		return nil, err
+	}
+	tr.Set(es.dataKey(stream), wrapped)
+	return key, nil
+}
+
+// sealStreamKey encrypts Data and Meta of the envelope with the data key
+// of the stream when the store has a MasterKey. Metadata streams stay
+// readable, since the store itself needs them.
+func (es *EventStore) sealStreamKey(tr fdb.Transaction, stream string, env *envelope) error {
+	if es.Keys == nil || isMetadataStream(stream) {
+		return nil
+	}
+	key, err := es.streamKey(tr, stream, true)
+	if err != nil {
+		return err
+	}
+	if env.data, err = encrypt(key, env.data); err != nil {
+		return err
+	}
+	if env.meta, err = encrypt(key, env.meta); err != nil {
+		return err
+	}
+	env.codec |= codecStreamKey
+	return nil
+}
+
+// openStreamKey decrypts an envelope sealed with a data key. Events of a
+// shredded stream keep their contract and position but lose Data and Meta.
+func (es *EventStore) openStreamKey(tr fdb.Transaction, stream string, env *envelope) error {
+	if env.codec&codecStreamKey == 0 {
+		return nil
+	}
+	if es.Keys == nil {
+		return ErrNoMasterKey
+	}
+	key, err := es.streamKey(tr, stream, false)
+	if err != nil {
+		return err
+	}
+	if key == nil {
+		env.data, env.meta = nil, nil
+		return nil
+	}
+	if env.data, err = decrypt(key, env.data); err != nil {
+		return err
+	}
+	env.meta, err = decrypt(key, env.meta)
+	return err
+}
+
+// ShredStream deletes the data key of the stream, so its encrypted events
+// can never be read again. Versions and positions stay in place and reads
+// return the events with nil Data and Meta. Later appends to the stream
+// fail with ErrStreamShredded.
+func (es *EventStore) ShredStream(db fdb.Database, stream string) error {
+	if err := validateStreamName(stream, true); err != nil {
+		return err
+	}
+	_, err := db.Transact(func(tr fdb.Transaction) (interface{}, error) {
+		tr.Set(es.dataKey(stream), []byte{})
+		return nil, nil
+	})
+	return err
+}
+
+// encrypt seals b with AES-GCM, prepending the nonce. Empty payloads stay
+// empty.
+func encrypt(key, b []byte) ([]byte, error) {
+	if len(b) == 0 {
+		return b, nil
+	}
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return gcm.Seal(nonce, nonce, b, nil), nil
+}
+
+func decrypt(key, b []byte) ([]byte, error) {
+	if len(b) == 0 {
+		return b, nil
+	}
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(b) < gcm.NonceSize() {
+		return nil, errBadCiphertext
+	}
+	return gcm.Open(nil, b[:gcm.NonceSize()], b[gcm.NonceSize():], nil)
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
@@ -0,0 +1,98 @@
+package eventstore
+
+import (
+	"bytes"
+	"errors"
+	"github.com/FoundationDB/fdb-go/fdb"
+	"github.com/abdullin/go-layers/internal/fdbtest"
+	"testing"
+)
+
+// testMasterKey wraps data keys with AES-GCM under a fixed key
+type testMasterKey []byte
+
+func (k testMasterKey) Wrap(key []byte) ([]byte, error)       { return encrypt(k, key) }
+func (k testMasterKey) Unwrap(wrapped []byte) ([]byte, error) { return decrypt(k, wrapped) }
+
+func TestShredStream(t *testing.T) {
+	db, sub := fdbtest.Open(t)
+	es := New(sub)
+	es.Keys = testMasterKey(bytes.Repeat([]byte{7}, 32))
+
+	secret := []byte("personal data")
+	for _, stream := range []string{"user-1", "user-2"} {
+		err := es.Append(db, stream, ExpectedNoStream, []EventRecord{
+			{Contract: "Registered", Data: secret, Meta: []byte("meta")},
+			{Contract: "Renamed", Data: secret},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// payloads are stored encrypted
+	raw := func(stream string) []fdb.KeyValue {
+		v, err := db.Transact(func(tr fdb.Transaction) (interface{}, error) {
+			return tr.GetRange(es.events.Sub(stream), fdb.RangeOptions{}).GetSliceWithError()
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return v.([]fdb.KeyValue)
+	}
+	for _, kv := range raw("user-1") {
+		if bytes.Contains(kv.Value, secret) {
+			t.Fatalf("plaintext stored at %s", fdb.Printable(kv.Key))
+		}
+	}
+
+	if err := es.ShredStream(db, "user-1"); err != nil {
+		t.Fatal(err)
+	}
+
+	// the data key is gone, so nothing can decrypt the stored payloads
+	v, err := db.Transact(func(tr fdb.Transaction) (interface{}, error) {
+		return tr.Get(es.dataKey("user-1")).GetWithError()
+	})
+	if err != nil || v.([]byte) == nil || len(v.([]byte)) != 0 {
+		t.Fatalf("data key after shredding %x, %v", v, err)
+	}
+	for _, kv := range raw("user-1") {
+		env, err := decodeEnvelope(kv.Value)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(env.data) == 0 || bytes.Contains(env.data, secret) {
+			t.Fatalf("payload at %s was not kept encrypted", fdb.Printable(kv.Key))
+		}
+	}
+
+	// reads keep contracts and versions, without the payloads
+	events, err := es.ReadStream(db, "user-1", ReadOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 2 {
+		t.Fatalf("read %d events of a shredded stream", len(events))
+	}
+	for i, evt := range events {
+		if evt.StreamVersion != int64(i) || evt.Contract == "" || evt.Data != nil || evt.Meta != nil {
+			t.Fatalf("shredded event %+v", evt)
+		}
+	}
+	all, _, err := es.ReadAll(db, nil, 0, Filter{})
+	if err != nil || len(all) != 4 {
+		t.Fatalf("read %d events of the store, %v", len(all), err)
+	}
+	for _, evt := range all {
+		if readable := bytes.Equal(evt.Data, secret); readable != (evt.StreamName == "user-2") {
+			t.Fatalf("%s@%d read with data %q", evt.StreamName, evt.StreamVersion, evt.Data)
+		}
+	}
+
+	// the stream never gets a new key
+	err = es.Append(db, "user-1", ExpectedAny, []EventRecord{{Contract: "Again", Data: secret}})
+	if !errors.Is(err, ErrStreamShredded) {
+		t.Fatalf("append to a shredded stream: %v", err)
+	}
+}
@@ -0,0 +1,41 @@
+package eventstore
+
+import "fmt"
+
+// maxValueBytes is the size limit FoundationDB puts on a single value
+const maxValueBytes = 100000
+
+// envelopeOverhead is the room left in a value for the envelope around
+// Data and Meta: header, tags, created time and a contract of usual length
+const envelopeOverhead = 1000
+
+// DefaultMaxEventSize is the default limit on Data plus Meta of a record
+const DefaultMaxEventSize = maxValueBytes - envelopeOverhead
+
+// ErrEventTooLarge is returned by appends for a record that can't be
+// stored in a single value. Index is the position of the record in the
+// appended batch.
+type ErrEventTooLarge struct {
+	Stream string
+	Index  int
+	Size   int
+	Limit  int
+}
+
+func (e *ErrEventTooLarge) Error() string {
+	return fmt.Sprintf("event %d appended to %q is %d bytes, over the limit of %d", e.Index, e.Stream, e.Size, e.Limit)
+}
+
+// checkSizes fails on the first record whose payload exceeds MaxEventSize
+func (es *EventStore) checkSizes(stream string, records []EventRecord) error {
+	limit := es.MaxEventSize
+	if limit <= 0 || limit > DefaultMaxEventSize {
+		limit = DefaultMaxEventSize
+	}
+	for i, r := range records {
+		if size := len(r.Data) + len(r.Meta); size > limit {
+			return &ErrEventTooLarge{stream, i, size, limit}
+		}
+	}
+	return nil
+}
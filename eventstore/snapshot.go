@@ -0,0 +1,92 @@
+package eventstore
+
+import (
+	"github.com/FoundationDB/fdb-go/fdb"
+	"github.com/FoundationDB/fdb-go/fdb/tuple"
+)
+
+// SaveSnapshot stores the state of an aggregate built from the stream up
+// to and including version. Only the latest SnapshotsToKeep snapshots
+// are kept per stream.
+func (es *EventStore) SaveSnapshot(db fdb.Database, stream string, version int64, data []byte) error {
+	_, err := db.Transact(func(tr fdb.Transaction) (interface{}, error) {
+		space := es.snapshots.Sub(stream)
+		tr.Set(space.Pack(tuple.Tuple{version}), data)
+
+		keep := es.SnapshotsToKeep
+		if keep < 1 {
+			keep = 1
+		}
+
+		// the oldest snapshot to keep, counting back from the end
+		begin, end := space.FDBRangeKeys()
+		sel := fdb.KeySelector{Key: end, OrEqual: false, Offset: 1 - keep}
+		if oldest := tr.GetKey(sel).GetOrPanic(); space.Contains(oldest) {
+			tr.ClearRange(fdb.KeyRange{Begin: begin, End: oldest})
+		}
+		return nil, nil
+	})
+	return err
+}
+
+// LoadSnapshot returns the latest snapshot of a stream
+func (es *EventStore) LoadSnapshot(db fdb.Database, stream string) (data []byte, version int64, ok bool, err error) {
+	_, err = db.Transact(func(tr fdb.Transaction) (interface{}, error) {
+		data, version, ok = es.loadSnapshot(tr, stream)
+		return nil, nil
+	})
+	return
+}
+
+func (es *EventStore) loadSnapshot(tr fdb.Transaction, stream string) (data []byte, version int64, ok bool) {
+	space := es.snapshots.Sub(stream)
+	opt := fdb.RangeOptions{Limit: 1, Reverse: true}
+
+	kvs := tr.GetRange(space, opt).GetSliceOrPanic()
+	if len(kvs) != 1 {
+		return nil, 0, false
+	}
+
+	t, err := space.Unpack(kvs[0].Key)
+	if err != nil {
+		panic(err)
+	}
+	return kvs[0].Value, t[0].(int64), true
+}
+
+// LoadAggregate rehydrates an aggregate from its latest snapshot (if any)
+// followed by the events appended after it. Both are read in a single
+// transaction, callbacks are invoked after it completes.
+func (es *EventStore) LoadAggregate(db fdb.Database, stream string, applySnapshot func(data []byte, version int64) error, applyEvent func(RecordedEvent) error) error {
+	var snapshot []byte
+	var version int64
+	var found bool
+
+	v, err := db.Transact(func(tr fdb.Transaction) (interface{}, error) {
+		snapshot, version, found = es.loadSnapshot(tr, stream)
+
+		from := int64(0)
+		if found {
+			from = version + 1
+		}
+		return es.readStream(tr, stream, ReadOptions{From: from})
+	})
+	if err != nil {
+		return err
+	}
+
+	if found {
+		if err := applySnapshot(snapshot, version); err != nil {
+			return err
+		}
+	}
+	for _, evt := range v.([]RecordedEvent) {
+		if evt, err = es.interceptRead(evt); err != nil {
+			return err
+		}
+		if err := applyEvent(evt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
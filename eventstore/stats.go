@@ -0,0 +1,57 @@
+package eventstore
+
+import (
+	"github.com/FoundationDB/fdb-go/fdb"
+	"github.com/FoundationDB/fdb-go/fdb/tuple"
+	"github.com/abdullin/go-layers/subspaces"
+	"time"
+)
+
+// StoreStats is a cheap summary of the store, built from counters and a
+// few point reads
+type StoreStats struct {
+	Streams      int64
+	Events       int64
+	ApproxBytes  int64 // size of the store subspace: approximate, see subspaces.EstimateSize
+	LastPosition Position
+	LastAppend   time.Time // zero if the store is empty
+}
+
+func (es *EventStore) streamsCounter() fdb.Key {
+	return es.counters.Pack(tuple.Tuple{"streams"})
+}
+
+func (es *EventStore) Stats(db fdb.Database) (StoreStats, error) {
+	v, err := db.Transact(func(tr fdb.Transaction) (interface{}, error) {
+		streams := tr.Get(es.streamsCounter())
+		events := tr.Get(es.totalCounter())
+
+		_, end := es.global.FDBRangeKeys()
+		last := tr.GetKey(fdb.LastLessThan(end))
+
+		stats := StoreStats{
+			Streams: decodeCounter(streams.GetOrPanic()),
+			Events:  decodeCounter(events.GetOrPanic()),
+		}
+
+		var err error
+		if stats.ApproxBytes, err = subspaces.EstimateSize(tr, es.space); err != nil {
+			return nil, err
+		}
+
+		// the last key of the global space is the latest event
+		if key := last.GetOrPanic(); es.global.Contains(key) {
+			evt, err := es.decodeGlobal(tr, fdb.KeyValue{Key: key, Value: tr.Get(key).GetOrPanic()})
+			if err != nil {
+				return nil, err
+			}
+			stats.LastPosition = evt.GlobalPosition
+			stats.LastAppend = evt.CreatedAt
+		}
+		return stats, nil
+	})
+	if err != nil {
+		return StoreStats{}, err
+	}
+	return v.(StoreStats), nil
+}
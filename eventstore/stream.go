@@ -0,0 +1,219 @@
+package eventstore
+
+import (
+	"errors"
+	"github.com/FoundationDB/fdb-go/fdb"
+	"github.com/FoundationDB/fdb-go/fdb/tuple"
+	"github.com/abdullin/go-layers/subspaces"
+	"time"
+)
+
+// ReadOptions control how events are read from a stream
+type ReadOptions struct {
+	From  int64 // first version to read
+	Limit int   // maximum number of events, 0 reads to the end
+	// RawLinks returns link records as they are stored instead of
+	// resolving them to the events they point at
+	RawLinks bool
+	// IncludeDeleted returns events from before the last soft delete
+	IncludeDeleted bool
+}
+
+// storedEvent is an event together with the size of its storage
+type storedEvent struct {
+	RecordedEvent
+	keys  int // number of keys holding the event
+	bytes int // size of those keys and values
+}
+
+// ReadStream returns events of a stream in version order. Events outside
+// the stream retention are skipped.
+func (es *EventStore) ReadStream(db fdb.Database, stream string, opts ReadOptions) ([]RecordedEvent, error) {
+	if err := validateStreamName(stream, false); err != nil {
+		return nil, err
+	}
+	v, err := db.Transact(func(tr fdb.Transaction) (interface{}, error) {
+		return es.readStream(tr, stream, opts)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	events := v.([]RecordedEvent)
+	for i := range events {
+		if events[i], err = es.interceptRead(events[i]); err != nil {
+			return nil, err
+		}
+	}
+	return events, nil
+}
+
+// ReadStreamFrom returns up to limit events of a stream starting with the
+// version
+func (es *EventStore) ReadStreamFrom(db fdb.Database, stream string, from int64, limit int) ([]RecordedEvent, error) {
+	return es.ReadStream(db, stream, ReadOptions{From: from, Limit: limit})
+}
+
+// ReadStreamAfter returns up to limit events of a stream after the
+// version; -1 reads from the first event. Passing the version of the last
+// returned event to the next call neither repeats nor skips any event.
+func (es *EventStore) ReadStreamAfter(db fdb.Database, stream string, after int64, limit int) ([]RecordedEvent, error) {
+	return es.ReadStream(db, stream, ReadOptions{From: after + 1, Limit: limit})
+}
+
+func (es *EventStore) readStream(tr fdb.Transaction, stream string, opts ReadOptions) ([]RecordedEvent, error) {
+	meta, err := es.getMetadata(tr, stream)
+	if err != nil {
+		return nil, err
+	}
+	if meta.Deleted {
+		return nil, ErrStreamDeleted
+	}
+
+	last := es.lastVersion(tr, stream)
+	if meta.MaxCount > 0 && opts.From <= last-meta.MaxCount {
+		opts.From = last - meta.MaxCount + 1
+	}
+	if !opts.IncludeDeleted && opts.From < meta.TruncateBefore {
+		opts.From = meta.TruncateBefore
+	}
+
+	now := time.Now().Unix()
+	var events []RecordedEvent
+
+	stored, err := es.scanStream(tr, stream, opts.From, opts.Limit)
+	if err != nil {
+		return nil, err
+	}
+	for _, evt := range stored {
+		if !meta.retains(evt.StreamVersion, evt.CreatedAt.Unix(), last, now) {
+			continue
+		}
+		if evt.Contract == LinkContract && !opts.RawLinks {
+			events = append(events, es.resolveLink(tr, evt.RecordedEvent))
+		} else {
+			events = append(events, evt.RecordedEvent)
+		}
+	}
+
+	return events, nil
+}
+
+// scanStream reads stored events with versions in [from, from+limit)
+// ignoring retention. Zero limit reads to the end of the stream
+func (es *EventStore) scanStream(tr fdb.Transaction, stream string, from int64, limit int) ([]storedEvent, error) {
+	streamSpace := es.events.Sub(stream)
+
+	opts := subspaces.ReadOptions{From: tuple.Tuple{from}}
+	if limit > 0 {
+		opts.Before = tuple.Tuple{from + int64(limit)}
+	}
+
+	// long streams are decoded as they are read rather than buffered
+	ri := subspaces.ReadRange(tr, streamSpace, opts)
+	events := []storedEvent{}
+
+	for ri.Advance() {
+		kv := ri.GetNextOrPanic()
+		t, err := streamSpace.Unpack(kv.Key)
+		if err != nil {
+			return nil, err
+		}
+		env, err := es.openEnvelope(tr, kv.Value, stream)
+		if err != nil {
+			return nil, err
+		}
+
+		version := t[0].(int64)
+		evt := env.recorded(stream, version)
+		evt.GlobalPosition = Position(concat(env.stamp, tuple.Tuple{stream, version}.Pack()))
+		events = append(events, storedEvent{evt, 1, len(kv.Key) + len(kv.Value)})
+	}
+
+	return events, nil
+}
+
+// readEvent loads a single event by its position in a stream, respecting
+// the stream retention
+func (es *EventStore) readEvent(tr fdb.Transaction, pos StreamPosition) (evt RecordedEvent, ok bool) {
+	events, err := es.readStream(tr, pos.Stream, ReadOptions{From: pos.Version, Limit: 1, RawLinks: true})
+	if err == nil && len(events) == 1 {
+		return events[0], true
+	}
+	return
+}
+
+// ErrInvalidCount is returned by ReadLast for a count below one
+var ErrInvalidCount = errors.New("count must be positive")
+
+// ReadLast returns up to n latest events of a stream in version order
+func (es *EventStore) ReadLast(db fdb.Database, stream string, n int) ([]RecordedEvent, error) {
+	if err := checkReadLast(stream, n); err != nil {
+		return nil, err
+	}
+	v, err := db.Transact(func(tr fdb.Transaction) (interface{}, error) {
+		return es.ReadLastTr(tr, stream, n)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return v.([]RecordedEvent), nil
+}
+
+// ReadLastTr is ReadLast within the caller's transaction. It reads only
+// the tail of the stream, and fails like ReadStream on deleted streams.
+func (es *EventStore) ReadLastTr(tr fdb.Transaction, stream string, n int) ([]RecordedEvent, error) {
+	if err := checkReadLast(stream, n); err != nil {
+		return nil, err
+	}
+	meta, err := es.getMetadata(tr, stream)
+	if err != nil {
+		return nil, err
+	}
+	if meta.Deleted {
+		return nil, ErrStreamDeleted
+	}
+
+	streamSpace := es.events.Sub(stream)
+	kvs := tr.GetRange(streamSpace, fdb.RangeOptions{Limit: n, Reverse: true}).GetSliceOrPanic()
+
+	last := es.lastVersion(tr, stream)
+	now := time.Now().Unix()
+	events := make([]RecordedEvent, 0, len(kvs))
+
+	// the scan runs backwards, so walk it from its end
+	for i := len(kvs) - 1; i >= 0; i-- {
+		t, err := streamSpace.Unpack(kvs[i].Key)
+		if err != nil {
+			return nil, err
+		}
+		env, err := es.openEnvelope(tr, kvs[i].Value, stream)
+		if err != nil {
+			return nil, err
+		}
+
+		version := t[0].(int64)
+		if version < meta.TruncateBefore || !meta.retains(version, env.created, last, now) {
+			continue
+		}
+		evt := env.recorded(stream, version)
+		evt.GlobalPosition = Position(concat(env.stamp, tuple.Tuple{stream, version}.Pack()))
+		if evt.Contract == LinkContract {
+			evt = es.resolveLink(tr, evt)
+		}
+		if evt, err = es.interceptRead(evt); err != nil {
+			return nil, err
+		}
+		events = append(events, evt)
+	}
+	return events, nil
+}
+
+// checkReadLast validates the arguments of ReadLast. A limit of zero
+// would read the whole stream backwards.
+func checkReadLast(stream string, n int) error {
+	if n <= 0 {
+		return ErrInvalidCount
+	}
+	return validateStreamName(stream, false)
+}
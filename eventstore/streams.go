@@ -0,0 +1,86 @@
+package eventstore
+
+import (
+	"bytes"
+	"github.com/FoundationDB/fdb-go/fdb"
+	"github.com/FoundationDB/fdb-go/fdb/tuple"
+	"strings"
+	"time"
+)
+
+// StreamInfo describes a stream as recorded by its head
+type StreamInfo struct {
+	Name    string
+	Version int64 // of the last event
+	// Created and Updated are the times of the first and the latest
+	// append, zero for streams last written before they were recorded
+	Created time.Time
+	Updated time.Time
+}
+
+// StreamsByPrefix returns up to limit streams whose names start with the
+// prefix, ordered by name and starting after the name given as after.
+// Passing the name of the last returned stream fetches the next page;
+// streams deleted in between are skipped rather than shifting the pages.
+// Metadata streams are only listed for prefixes starting with "$$".
+func (es *EventStore) StreamsByPrefix(db fdb.Database, prefix string, after string, limit int) ([]StreamInfo, error) {
+	// a tuple string without its terminator is a prefix of the encoding of
+	// every string it is a prefix of
+	packed := tuple.Tuple{prefix}.Pack()
+	begin := fdb.Key(concat(es.streams.Bytes(), packed[:len(packed)-1]))
+	end := fdb.Key(concat(begin, []byte{0xff}))
+	if after != "" {
+		if key := fdb.Key(concat(es.streams.Pack(tuple.Tuple{after}), []byte{0x00})); bytes.Compare(key, begin) > 0 {
+			begin = key
+		}
+	}
+	metadata := strings.HasPrefix(prefix, "$$")
+
+	v, err := db.Transact(func(tr fdb.Transaction) (interface{}, error) {
+		var infos []StreamInfo
+		ri := tr.GetRange(fdb.KeyRange{Begin: begin, End: end}, fdb.RangeOptions{}).Iterator()
+		for (limit <= 0 || len(infos) < limit) && ri.Advance() {
+			kv := ri.GetNextOrPanic()
+			t, err := es.streams.Unpack(kv.Key)
+			if err != nil {
+				return nil, err
+			}
+			stream := t[0].(string)
+			if isMetadataStream(stream) && !metadata {
+				continue
+			}
+			meta, err := es.getMetadata(tr, stream)
+			if err != nil {
+				return nil, err
+			}
+			if meta.Deleted {
+				continue
+			}
+			info, err := decodeStreamInfo(stream, kv.Value)
+			if err != nil {
+				return nil, err
+			}
+			infos = append(infos, info)
+		}
+		return infos, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return v.([]StreamInfo), nil
+}
+
+func decodeStreamInfo(stream string, head []byte) (StreamInfo, error) {
+	t, err := tuple.Unpack(head)
+	if err != nil {
+		return StreamInfo{}, err
+	}
+	info := StreamInfo{Name: stream, Version: t[0].(int64)}
+	if len(t) > 2 {
+		if created := t[1].(int64); created > 0 {
+			info.Created = time.Unix(created, 0)
+		}
+		info.Updated = time.Unix(t[2].(int64), 0)
+	}
+	return info, nil
+}
@@ -0,0 +1,65 @@
+package eventstore
+
+import (
+	"github.com/FoundationDB/fdb-go/fdb"
+	"github.com/abdullin/go-layers/subspaces"
+)
+
+// ForTenant returns the store of a tenant, kept in its own subspace of
+// this store with separate streams, indexes, counters and notification
+// keys. It shares the configuration and interceptors of this store as
+// they are at the time of the call.
+func (es *EventStore) ForTenant(id string) *EventStore {
+	t := New(es.tenants.Sub(id))
+	t.Serializer = es.Serializer
+	t.Types = es.Types
+	t.SnapshotsToKeep = es.SnapshotsToKeep
+	t.RetryPolicy = es.RetryPolicy
+	t.MaxEventSize = es.MaxEventSize
+	t.IdempotencyWindow = es.IdempotencyWindow
+	t.Keys = es.Keys
+	t.Encryptor = es.Encryptor
+	t.Strings = es.Strings
+	t.ChannelBuffer = es.ChannelBuffer
+	t.interceptors = append([]Interceptor(nil), es.interceptors...)
+	t.readInterceptors = append([]ReadInterceptor(nil), es.readInterceptors...)
+	t.commitHooks = append([]CommitHook(nil), es.commitHooks...)
+	for contract, fns := range es.upcasters {
+		for _, fn := range fns {
+			t.RegisterUpcaster(contract, fn)
+		}
+	}
+	if es.versions != nil {
+		t.WithVersionCache(es.versions.size)
+	}
+	return t
+}
+
+// Tenants lists the tenants that have data, in key order. It reads a
+// single key per tenant.
+func (es *EventStore) Tenants(db fdb.Database) ([]string, error) {
+	v, err := db.Transact(func(tr fdb.Transaction) (interface{}, error) {
+		children, err := subspaces.Children(tr, es.tenants, 0)
+		if err != nil {
+			return nil, err
+		}
+		ids := make([]string, 0, len(children))
+		for _, c := range children {
+			ids = append(ids, c.(string))
+		}
+		return ids, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return v.([]string), nil
+}
+
+// DeleteTenant removes everything stored for a tenant
+func (es *EventStore) DeleteTenant(db fdb.Database, id string) error {
+	_, err := db.Transact(func(tr fdb.Transaction) (interface{}, error) {
+		tr.ClearRange(es.tenants.Sub(id))
+		return nil, nil
+	})
+	return err
+}
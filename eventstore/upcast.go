@@ -0,0 +1,61 @@
+package eventstore
+
+import "fmt"
+
+// Upcaster turns an event of an old schema into a newer one on read
+type Upcaster func(event RecordedEvent) (RecordedEvent, error)
+
+// maxUpcasts bounds a chain of upcasters, so a cycle of contracts fails
+// instead of looping
+const maxUpcasts = 32
+
+// UpcastError is returned by reads when an upcaster fails
+type UpcastError struct {
+	Stream   string
+	Version  int64
+	Contract string
+	Err      error
+}
+
+func (e *UpcastError) Error() string {
+	return fmt.Sprintf("upcasting %s of %q at version %d: %v", e.Contract, e.Stream, e.Version, e.Err)
+}
+
+func (e *UpcastError) Unwrap() error {
+	return e.Err
+}
+
+// RegisterUpcaster adds an upcaster for events of the contract. Upcasters
+// of a contract run in registration order; when the result has another
+// contract, the upcasters of that one run next. Stored events are never
+// changed. Like Use, it is not safe for concurrent calls.
+func (es *EventStore) RegisterUpcaster(contract string, fn Upcaster) {
+	if es.upcasters == nil {
+		es.upcasters = make(map[string][]Upcaster)
+	}
+	es.upcasters[contract] = append(es.upcasters[contract], fn)
+}
+
+func (es *EventStore) upcast(event RecordedEvent) (RecordedEvent, error) {
+	for steps := 0; ; steps++ {
+		fns := es.upcasters[event.Contract]
+		if len(fns) == 0 {
+			return event, nil
+		}
+		if steps == maxUpcasts {
+			return RecordedEvent{}, &UpcastError{event.StreamName, event.StreamVersion, event.Contract, fmt.Errorf("more than %d upcasts", maxUpcasts)}
+		}
+
+		contract := event.Contract
+		for _, fn := range fns {
+			next, err := fn(event)
+			if err != nil {
+				return RecordedEvent{}, &UpcastError{event.StreamName, event.StreamVersion, event.Contract, err}
+			}
+			event = next
+		}
+		if event.Contract == contract {
+			return event, nil
+		}
+	}
+}
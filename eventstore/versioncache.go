@@ -0,0 +1,137 @@
+package eventstore
+
+import (
+	"container/list"
+	"github.com/FoundationDB/fdb-go/fdb"
+	"github.com/FoundationDB/fdb-go/fdb/tuple"
+	"sync"
+	"time"
+)
+
+// versionCache is an LRU of the last versions this process wrote to
+// streams. A nil cache holds nothing.
+type versionCache struct {
+	mu    sync.Mutex
+	size  int
+	order *list.List // most recently used first
+	items map[string]*list.Element
+}
+
+type cachedVersion struct {
+	stream string
+	state  streamState
+}
+
+// streamState is what appends need to know about a stream: its last
+// version and its metadata, with the last version of the metadata stream
+// to tell when the metadata changed
+type streamState struct {
+	version     int64
+	meta        StreamMetadata
+	metaVersion int64
+}
+
+// WithVersionCache makes appends to the size most recently written streams
+// skip reading the stream head and metadata before writing, for stores
+// whose hot streams are written mostly by this process. The heads of the
+// stream and of its metadata stream are still read alongside the writes
+// to validate the cached state, and a stale entry costs a retry.
+func (es *EventStore) WithVersionCache(size int) *EventStore {
+	es.versions = &versionCache{
+		size:  size,
+		order: list.New(),
+		items: make(map[string]*list.Element),
+	}
+	return es
+}
+
+func (c *versionCache) get(stream string) (streamState, bool) {
+	if c == nil {
+		return streamState{}, false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if e, ok := c.items[stream]; ok {
+		c.order.MoveToFront(e)
+		return e.Value.(*cachedVersion).state, true
+	}
+	return streamState{}, false
+}
+
+func (c *versionCache) put(stream string, state streamState) {
+	if c == nil || c.size <= 0 {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if e, ok := c.items[stream]; ok {
+		e.Value.(*cachedVersion).state = state
+		c.order.MoveToFront(e)
+		return
+	}
+	c.items[stream] = c.order.PushFront(&cachedVersion{stream, state})
+	if c.order.Len() > c.size {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.items, oldest.Value.(*cachedVersion).stream)
+	}
+}
+
+func (c *versionCache) remove(stream string) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if e, ok := c.items[stream]; ok {
+		c.order.Remove(e)
+		delete(c.items, stream)
+	}
+}
+
+// appendCached appends after the cached last version of the stream,
+// using the cached metadata. A stale entry is dropped and the attempt
+// fails as a conflict, so the transaction is retried without it.
+func (es *EventStore) appendCached(tr fdb.Transaction, stream string, cached streamState, records []EventRecord) ([]EventRecord, []int64, error) {
+	if err := validateStreamName(stream, true); err != nil {
+		return nil, nil, err
+	}
+	// issued before the writes, so they return the stored heads. Waiting
+	// for them is left until the writes are buffered, and like any read
+	// they conflict the transaction with appends and metadata changes
+	// committed after it started.
+	head := tr.Get(es.streams.Pack(tuple.Tuple{stream}))
+	metaHead := tr.Get(es.streams.Pack(tuple.Tuple{MetadataStream(stream)}))
+
+	if cached.meta.softDeleted(cached.version) {
+		// expected versions of soft-deleted streams need the metadata
+		es.versions.remove(stream)
+		return nil, nil, fdb.Error{Code: 1020} // not_committed
+	}
+
+	records, err := es.prepareRecords(stream, records)
+	if err != nil {
+		return nil, nil, err
+	}
+	versions, err := es.writeEventsMeta(tr, stream, cached.meta, cached.version, records, time.Now())
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if headVersion(head) != cached.version || headVersion(metaHead) != cached.metaVersion {
+		es.versions.remove(stream)
+		return nil, nil, fdb.Error{Code: 1020} // not_committed
+	}
+	return records, versions, nil
+}
+
+// headVersion returns the version held by a stream head, -1 for none
+func headVersion(head fdb.FutureByteSlice) int64 {
+	if val := head.GetOrPanic(); val != nil {
+		return decodeInt(val)
+	}
+	return -1
+}
@@ -0,0 +1,85 @@
+package eventstore
+
+import (
+	"github.com/abdullin/go-layers/internal/fdbtest"
+	"strconv"
+	"testing"
+)
+
+var benchRecord = EventRecord{Contract: "Benchmarked", Data: []byte(`{}`)}
+
+func TestVersionCacheStale(t *testing.T) {
+	db, sub := fdbtest.Open(t)
+	cached := New(sub).WithVersionCache(16)
+	other := New(sub)
+
+	if err := cached.Append(db, "s", ExpectedNoStream, []EventRecord{benchRecord}); err != nil {
+		t.Fatal(err)
+	}
+	// moves the head past the cached version
+	if err := other.Append(db, "s", 0, []EventRecord{benchRecord}); err != nil {
+		t.Fatal(err)
+	}
+	if err := cached.Append(db, "s", ExpectedAny, []EventRecord{benchRecord}); err != nil {
+		t.Fatal(err)
+	}
+
+	events, err := other.ReadStreamFrom(db, "s", 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, evt := range events {
+		if evt.StreamVersion != int64(i) {
+			t.Fatalf("event %d has version %d", i, evt.StreamVersion)
+		}
+	}
+	if len(events) != 3 {
+		t.Fatalf("read %d events, want 3", len(events))
+	}
+}
+
+func TestVersionCacheMetadata(t *testing.T) {
+	db, sub := fdbtest.Open(t)
+	cached := New(sub).WithVersionCache(16)
+	other := New(sub)
+
+	if err := cached.Append(db, "s", ExpectedNoStream, []EventRecord{benchRecord}); err != nil {
+		t.Fatal(err)
+	}
+	// the cached metadata has no limit
+	if err := other.SetStreamMetadata(db, "s", StreamMetadata{MaxLength: 1}); err != nil {
+		t.Fatal(err)
+	}
+	err := cached.Append(db, "s", 0, []EventRecord{benchRecord})
+	if _, ok := err.(*ErrStreamTooLong); !ok {
+		t.Fatalf("append past MaxLength returned %v", err)
+	}
+}
+
+func BenchmarkAppend(b *testing.B) {
+	for _, n := range []int{1, 100, 5000} {
+		b.Run(strconv.Itoa(n), func(b *testing.B) { benchmarkAppend(b, 0, n) })
+	}
+}
+
+func BenchmarkAppendCached(b *testing.B) { benchmarkAppend(b, 16, 1) }
+
+func benchmarkAppend(b *testing.B, cache, batch int) {
+	db, sub := fdbtest.Open(b)
+	es := New(sub)
+	if cache > 0 {
+		es.WithVersionCache(cache)
+	}
+	records := make([]EventRecord, batch)
+	for i := range records {
+		records[i] = benchRecord
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := es.Append(db, "bench", int64(i*batch)-1, records); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,21 @@
+package eventstore
+
+import (
+	"github.com/FoundationDB/fdb-go/fdb"
+	"github.com/FoundationDB/fdb-go/fdb/subspace"
+	"github.com/abdullin/go-layers/subspaces"
+)
+
+// notifySpace is the subspace whose sentinel key every append to the
+// stream bumps, see subspaces.Bump
+func (es *EventStore) notifySpace(stream string) subspace.Subspace {
+	return es.notify.Sub(stream)
+}
+
+// WatchStream returns a watch that fires once the stream gets new events
+// after tr, or the store is cleared. The watch becomes active when tr
+// commits. Read the stream in the same transaction to avoid missing
+// events appended between the read and the watch.
+func (es *EventStore) WatchStream(tr fdb.Transaction, stream string) fdb.FutureNil {
+	return subspaces.Watch(tr, es.notifySpace(stream))
+}
@@ -0,0 +1,189 @@
+/*
+Package graph provides a directed graph class. It is a part of
+FoundationDb layer.
+
+Edges are stored twice, under the node they leave and under the node they
+enter, so both directions are range reads, and every node keeps degree
+counters updated with atomic ADD:
+
+	("out", from, to)            -> properties
+	("in", to, from)             -> properties
+	("degree", "out"|"in", node) -> count (8 bytes, little endian)
+
+Both copies and the counters change in the same transaction, so they never
+disagree.
+*/
+
+package graph
+
+import (
+	"encoding/binary"
+	"github.com/FoundationDB/fdb-go/fdb"
+	"github.com/FoundationDB/fdb-go/fdb/subspace"
+	"github.com/FoundationDB/fdb-go/fdb/tuple"
+)
+
+// neighborhoodPage is the number of edges read per transaction while
+// walking the graph
+const neighborhoodPage = 500
+
+type Graph struct {
+	Subspace subspace.Subspace
+	out      subspace.Subspace
+	in       subspace.Subspace
+	degree   subspace.Subspace
+}
+
+// New graph is created within a given subspace
+func New(sub subspace.Subspace) Graph {
+	return Graph{sub, sub.Sub("out"), sub.Sub("in"), sub.Sub("degree")}
+}
+
+type Edge struct {
+	From  []byte
+	To    []byte
+	Props []byte
+}
+
+func encodeCount(n int64) []byte {
+	b := make([]byte, 8)
+	binary.LittleEndian.PutUint64(b, uint64(n))
+	return b
+}
+
+func decodeCount(b []byte) int64 {
+	if len(b) != 8 {
+		return 0
+	}
+	return int64(binary.LittleEndian.Uint64(b))
+}
+
+func (g *Graph) outKey(from, to []byte) fdb.Key {
+	return g.out.Pack(tuple.Tuple{from, to})
+}
+
+func (g *Graph) inKey(from, to []byte) fdb.Key {
+	return g.in.Pack(tuple.Tuple{to, from})
+}
+
+func (g *Graph) addDegrees(tr fdb.Transaction, from, to []byte, delta int64) {
+	tr.Add(g.degree.Pack(tuple.Tuple{"out", from}), encodeCount(delta))
+	tr.Add(g.degree.Pack(tuple.Tuple{"in", to}), encodeCount(delta))
+}
+
+// AddEdge adds an edge, or replaces the properties of an existing one
+func (g *Graph) AddEdge(tr fdb.Transaction, from, to []byte, props []byte) {
+	if props == nil {
+		props = []byte{}
+	}
+	if !g.HasEdge(tr, from, to) {
+		g.addDegrees(tr, from, to, 1)
+	}
+	tr.Set(g.outKey(from, to), props)
+	tr.Set(g.inKey(from, to), props)
+}
+
+// RemoveEdge removes an edge, returning false if there is none
+func (g *Graph) RemoveEdge(tr fdb.Transaction, from, to []byte) bool {
+	if !g.HasEdge(tr, from, to) {
+		return false
+	}
+	g.addDegrees(tr, from, to, -1)
+	tr.Clear(g.outKey(from, to))
+	tr.Clear(g.inKey(from, to))
+	return true
+}
+
+// HasEdge returns whether there is an edge between the nodes
+func (g *Graph) HasEdge(tr fdb.Transaction, from, to []byte) bool {
+	return tr.Get(g.outKey(from, to)).GetOrPanic() != nil
+}
+
+// OutEdges returns up to limit edges leaving the node, zero for all
+func (g *Graph) OutEdges(tr fdb.Transaction, node []byte, limit int) []Edge {
+	return g.edges(tr, g.out, node, nil, limit, false)
+}
+
+// InEdges returns up to limit edges entering the node, zero for all
+func (g *Graph) InEdges(tr fdb.Transaction, node []byte, limit int) []Edge {
+	return g.edges(tr, g.in, node, nil, limit, true)
+}
+
+// edges reads the edges of the node in one direction, after the other
+// node of the edge if it is given
+func (g *Graph) edges(tr fdb.Transaction, sub subspace.Subspace, node, after []byte, limit int, reverse bool) []Edge {
+	nodeSub := sub.Sub(node)
+	begin, end := nodeSub.FDBRangeKeys()
+	if after != nil {
+		begin = fdb.Key(append(nodeSub.Pack(tuple.Tuple{after}), 0x00))
+	}
+
+	var edges []Edge
+	for _, kv := range tr.GetRange(fdb.KeyRange{Begin: begin, End: end}, fdb.RangeOptions{Limit: limit}).GetSliceOrPanic() {
+		t, err := nodeSub.Unpack(kv.Key)
+		if err != nil {
+			panic(err)
+		}
+		other := t[0].([]byte)
+		if reverse {
+			edges = append(edges, Edge{other, node, kv.Value})
+		} else {
+			edges = append(edges, Edge{node, other, kv.Value})
+		}
+	}
+	return edges
+}
+
+// OutDegree returns the number of edges leaving the node
+func (g *Graph) OutDegree(tr fdb.Transaction, node []byte) int64 {
+	return decodeCount(tr.Get(g.degree.Pack(tuple.Tuple{"out", node})).GetOrPanic())
+}
+
+// InDegree returns the number of edges entering the node
+func (g *Graph) InDegree(tr fdb.Transaction, node []byte) int64 {
+	return decodeCount(tr.Get(g.degree.Pack(tuple.Tuple{"in", node})).GetOrPanic())
+}
+
+// Neighborhood returns the nodes reachable from the node over up to depth
+// edges, nearest first. The walk reads a page of edges per transaction,
+// so it sees no single snapshot of a graph changing meanwhile.
+func (g *Graph) Neighborhood(db fdb.Database, node []byte, depth int) ([][]byte, error) {
+	seen := map[string]bool{string(node): true}
+	var found [][]byte
+
+	frontier := [][]byte{node}
+	for d := 0; d < depth && len(frontier) > 0; d++ {
+		var next [][]byte
+		for _, n := range frontier {
+			var after []byte
+			for {
+				v, err := db.Transact(func(tr fdb.Transaction) (interface{}, error) {
+					return g.edges(tr, g.out, n, after, neighborhoodPage, false), nil
+				})
+				if err != nil {
+					return nil, err
+				}
+
+				edges := v.([]Edge)
+				for _, e := range edges {
+					if !seen[string(e.To)] {
+						seen[string(e.To)] = true
+						next = append(next, e.To)
+					}
+				}
+				if len(edges) < neighborhoodPage {
+					break
+				}
+				after = edges[len(edges)-1].To
+			}
+		}
+		found = append(found, next...)
+		frontier = next
+	}
+	return found, nil
+}
+
+// Clear removes all nodes and edges
+func (g *Graph) Clear(tr fdb.Transaction) {
+	tr.ClearRange(g.Subspace)
+}
@@ -0,0 +1,183 @@
+package graph
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/FoundationDB/fdb-go/fdb"
+	"github.com/abdullin/go-layers/internal/fdbtest"
+	"sort"
+	"testing"
+)
+
+func transact(t *testing.T, db fdb.Database, fn func(tr fdb.Transaction)) {
+	t.Helper()
+	_, err := db.Transact(func(tr fdb.Transaction) (interface{}, error) {
+		fn(tr)
+		return nil, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestEdges(t *testing.T) {
+	db, sub := fdbtest.Open(t)
+	g := New(sub)
+	a, b, c := []byte("a"), []byte("b"), []byte("c")
+
+	transact(t, db, func(tr fdb.Transaction) {
+		g.AddEdge(tr, a, b, []byte("ab"))
+		g.AddEdge(tr, a, c, nil)
+		g.AddEdge(tr, c, b, []byte("cb"))
+	})
+	// re-adding an edge replaces its properties without counting it again
+	transact(t, db, func(tr fdb.Transaction) {
+		g.AddEdge(tr, a, b, []byte("ab2"))
+	})
+
+	transact(t, db, func(tr fdb.Transaction) {
+		if d := g.OutDegree(tr, a); d != 2 {
+			t.Errorf("out degree of a %d", d)
+		}
+		if d := g.InDegree(tr, b); d != 2 {
+			t.Errorf("in degree of b %d", d)
+		}
+		if d := g.InDegree(tr, a); d != 0 {
+			t.Errorf("in degree of a %d", d)
+		}
+
+		out := g.OutEdges(tr, a, 0)
+		if len(out) != 2 || !bytes.Equal(out[0].To, b) || string(out[0].Props) != "ab2" || !bytes.Equal(out[1].To, c) || out[1].Props == nil {
+			t.Errorf("out edges of a %+v", out)
+		}
+		in := g.InEdges(tr, b, 0)
+		if len(in) != 2 || !bytes.Equal(in[0].From, a) || !bytes.Equal(in[1].From, c) || string(in[1].Props) != "cb" {
+			t.Errorf("in edges of b %+v", in)
+		}
+		for _, e := range in {
+			if !bytes.Equal(e.To, b) {
+				t.Errorf("in edge %+v does not enter b", e)
+			}
+		}
+		if limited := g.OutEdges(tr, a, 1); len(limited) != 1 {
+			t.Errorf("%d out edges read with a limit of 1", len(limited))
+		}
+	})
+
+	transact(t, db, func(tr fdb.Transaction) {
+		if !g.RemoveEdge(tr, a, b) {
+			t.Error("edge a->b not removed")
+		}
+		if g.RemoveEdge(tr, a, b) {
+			t.Error("edge a->b removed twice")
+		}
+	})
+	transact(t, db, func(tr fdb.Transaction) {
+		if g.HasEdge(tr, a, b) {
+			t.Error("removed edge a->b found")
+		}
+		if d := g.OutDegree(tr, a); d != 1 {
+			t.Errorf("out degree of a after removing %d", d)
+		}
+		if d := g.InDegree(tr, b); d != 1 {
+			t.Errorf("in degree of b after removing %d", d)
+		}
+		if in := g.InEdges(tr, b, 0); len(in) != 1 || !bytes.Equal(in[0].From, c) {
+			t.Errorf("in edges of b after removing %+v", in)
+		}
+	})
+}
+
+// TestIndexes checks that both copies of every edge and the counters agree
+func TestIndexes(t *testing.T) {
+	db, sub := fdbtest.Open(t)
+	g := New(sub)
+
+	node := func(i int) []byte { return []byte(fmt.Sprintf("n%d", i)) }
+	transact(t, db, func(tr fdb.Transaction) {
+		for i := 0; i < 20; i++ {
+			for j := 0; j < 20; j += i%3 + 1 {
+				g.AddEdge(tr, node(i), node(j), nil)
+			}
+		}
+	})
+	transact(t, db, func(tr fdb.Transaction) {
+		for i := 0; i < 20; i += 2 {
+			g.RemoveEdge(tr, node(i), node(i))
+		}
+	})
+
+	transact(t, db, func(tr fdb.Transaction) {
+		forward := map[string]bool{}
+		for i := 0; i < 20; i++ {
+			out := g.OutEdges(tr, node(i), 0)
+			if d := g.OutDegree(tr, node(i)); d != int64(len(out)) {
+				t.Errorf("out degree of %s is %d, with %d edges", node(i), d, len(out))
+			}
+			for _, e := range out {
+				forward[string(e.From)+">"+string(e.To)] = true
+			}
+		}
+		reverse := map[string]bool{}
+		for i := 0; i < 20; i++ {
+			in := g.InEdges(tr, node(i), 0)
+			if d := g.InDegree(tr, node(i)); d != int64(len(in)) {
+				t.Errorf("in degree of %s is %d, with %d edges", node(i), d, len(in))
+			}
+			for _, e := range in {
+				reverse[string(e.From)+">"+string(e.To)] = true
+			}
+		}
+		if len(forward) != len(reverse) {
+			t.Fatalf("%d edges out, %d in", len(forward), len(reverse))
+		}
+		for e := range forward {
+			if !reverse[e] {
+				t.Errorf("edge %s only stored forward", e)
+			}
+		}
+	})
+}
+
+func TestNeighborhood(t *testing.T) {
+	db, sub := fdbtest.Open(t)
+	g := New(sub)
+
+	// a root with more edges than a page, one of them leading further
+	const fanout = neighborhoodPage*2 + 3
+	leaf := func(i int) []byte { return []byte(fmt.Sprintf("leaf-%04d", i)) }
+	for i := 0; i < fanout; i += 500 {
+		transact(t, db, func(tr fdb.Transaction) {
+			for j := i; j < i+500 && j < fanout; j++ {
+				g.AddEdge(tr, []byte("root"), leaf(j), nil)
+			}
+		})
+	}
+	transact(t, db, func(tr fdb.Transaction) {
+		g.AddEdge(tr, leaf(7), []byte("far"), nil)
+		g.AddEdge(tr, []byte("far"), []byte("root"), nil)
+	})
+
+	nodes, err := g.Neighborhood(db, []byte("root"), 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(nodes) != fanout {
+		t.Fatalf("%d nodes at depth 1, want %d", len(nodes), fanout)
+	}
+	names := make([]string, len(nodes))
+	for i, n := range nodes {
+		names[i] = string(n)
+	}
+	if !sort.StringsAreSorted(names) || names[0] != string(leaf(0)) || names[fanout-1] != string(leaf(fanout-1)) {
+		t.Fatalf("nodes at depth 1 from %s to %s", names[0], names[len(names)-1])
+	}
+
+	// the walk goes on past the leaves, and doesn't return to the root
+	if nodes, err = g.Neighborhood(db, []byte("root"), 3); err != nil {
+		t.Fatal(err)
+	}
+	if len(nodes) != fanout+1 || string(nodes[fanout]) != "far" {
+		t.Fatalf("%d nodes at depth 3, last %s", len(nodes), nodes[len(nodes)-1])
+	}
+}
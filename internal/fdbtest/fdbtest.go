@@ -0,0 +1,76 @@
+/*
+Package fdbtest opens the database the layer tests run against. It is a
+part of FoundationDb layer.
+
+Tests use the cluster of the default cluster file, each in a subspace of
+its own that is cleared when the test ends. They are skipped with -short
+and when no cluster answers. They select the API version the layers
+assume by default, or the one in FDB_API_VERSION.
+*/
+package fdbtest
+
+import (
+	"github.com/FoundationDB/fdb-go/fdb"
+	"github.com/FoundationDB/fdb-go/fdb/subspace"
+	"github.com/abdullin/go-layers/versionstamp"
+	"os"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+// probeTimeout bounds the first transaction, which waits forever when
+// the cluster file points at no cluster
+const probeTimeout = 5000 // ms
+
+var (
+	once       sync.Once
+	db         fdb.Database
+	apiVersion = versionstamp.DefaultAPIVersion
+	openErr    error
+)
+
+// APIVersion returns the API version the tests selected, valid once Open
+// returned
+func APIVersion() int {
+	return apiVersion
+}
+
+// Open returns the test database and an empty subspace for the test
+func Open(tb testing.TB) (fdb.Database, subspace.Subspace) {
+	tb.Helper()
+	if testing.Short() {
+		tb.Skip("needs a FoundationDB cluster")
+	}
+
+	once.Do(func() {
+		if v := os.Getenv("FDB_API_VERSION"); v != "" {
+			if apiVersion, openErr = strconv.Atoi(v); openErr != nil {
+				return
+			}
+		}
+		if openErr = versionstamp.Select(apiVersion); openErr != nil {
+			return
+		}
+		if db, openErr = fdb.OpenDefault(); openErr != nil {
+			return
+		}
+		_, openErr = db.Transact(func(tr fdb.Transaction) (interface{}, error) {
+			tr.Options().SetTimeout(probeTimeout)
+			return tr.Get(fdb.Key("fdbtest")).GetWithError()
+		})
+	})
+	if openErr != nil {
+		tb.Skipf("no FoundationDB cluster: %v", openErr)
+	}
+
+	sub := subspace.Sub("fdbtest", tb.Name(), time.Now().UnixNano())
+	tb.Cleanup(func() {
+		db.Transact(func(tr fdb.Transaction) (interface{}, error) {
+			tr.ClearRange(sub)
+			return nil, nil
+		})
+	})
+	return db, sub
+}
@@ -0,0 +1,195 @@
+/*
+Package pops provides the high contention pop shared by the queue layers.
+It is a part of FoundationDb layer.
+
+Poppers first try to take the first item directly. One that conflicts, or
+finds others already waiting, registers in a semi-ordered list of waiting
+pops instead. Every waiting popper then fulfils outstanding pops in
+batches, handing items to waiters in order, and polls for its own result.
+
+This code is a port from official python layer
+*/
+
+package pops
+
+import (
+	"bytes"
+	"crypto/rand"
+	"github.com/FoundationDB/fdb-go/fdb"
+	"github.com/FoundationDB/fdb-go/fdb/subspace"
+	"github.com/FoundationDB/fdb-go/fdb/tuple"
+	"time"
+)
+
+// fulfilBatch is the number of waiting pops fulfilled per transaction
+const fulfilBatch = 100
+
+// Items returns the first items of a queue in pop order, up to the limit
+type Items func(tr fdb.Transaction, limit int) []fdb.KeyValue
+
+type Pops struct {
+	waiting subspace.Subspace // stores int64 index, randId []byte
+	results subspace.Subspace // stores randId []byte -> popped value
+}
+
+// New pops keep the waiting pops and their results in given subspaces
+func New(waiting, results subspace.Subspace) Pops {
+	return Pops{waiting, results}
+}
+
+// PopSimple takes the first item without trying to avoid conflicts. If
+// many clients are trying to pop simultaneously, only one will be able to
+// succeed at a time.
+func PopSimple(tr fdb.Transaction, items Items) (value []byte, ok bool) {
+	if kvs := items(tr, 1); len(kvs) == 1 {
+		tr.Clear(kvs[0].Key)
+		return kvs[0].Value, true
+	}
+	return
+}
+
+// Pop takes the first item, registering as a waiting pop when others
+// contend for it. Cannot be composed with other functions in a single
+// transaction.
+func (p *Pops) Pop(db fdb.Database, items Items) (value []byte, ok bool) {
+	tr, err := db.CreateTransaction()
+	if err != nil {
+		panic(err)
+	}
+
+	// Check if there are other people waiting to be popped. If so, we
+	// cannot pop before them.
+	waitKey := p.addWaiting(tr, false)
+	if waitKey == nil {
+		value, ok := PopSimple(tr, items)
+		if err := tr.Commit().GetWithError(); err == nil {
+			return value, ok
+		}
+	} else if err := tr.Commit().GetWithError(); err != nil {
+		waitKey = nil
+	}
+
+	// If we didn't succeed, then register our pop request
+	if waitKey == nil {
+		v, err := db.Transact(func(tr fdb.Transaction) (interface{}, error) {
+			return p.addWaiting(tr, true), nil
+		})
+		if err != nil {
+			panic(err)
+		}
+		waitKey = v.(fdb.Key)
+	}
+
+	t, err := p.waiting.Unpack(waitKey)
+	if err != nil {
+		panic(err)
+	}
+	// The result of the pop will be stored at this key once it has been
+	// fulfilled
+	resultKey := p.resultKey(t[1].([]byte))
+
+	backoff := 10 * time.Millisecond
+	for {
+		for !p.fulfil(db, items) {
+		}
+
+		v, err := db.Transact(func(tr fdb.Transaction) (interface{}, error) {
+			// If waitKey is present, then we have not been fulfilled
+			if tr.Get(waitKey).GetOrPanic() != nil {
+				return nil, nil
+			}
+			result := tr.Get(resultKey).GetOrPanic()
+			tr.Clear(resultKey)
+			return polled{result}, nil
+		})
+		if err != nil {
+			panic(err)
+		}
+
+		if v == nil {
+			time.Sleep(backoff)
+			if backoff *= 2; backoff > time.Second {
+				backoff = time.Second
+			}
+			continue
+		}
+		result := v.(polled).result
+		return result, result != nil
+	}
+}
+
+// polled is the result of a fulfilled pop, nil if the queue was empty
+type polled struct {
+	result []byte
+}
+
+// addWaiting registers a waiting pop, unless nobody waits yet and it is
+// not forced
+func (p *Pops) addWaiting(tr fdb.Transaction, forced bool) fdb.Key {
+	index := nextIndex(tr.Snapshot(), p.waiting)
+	if index == 0 && !forced {
+		return nil
+	}
+	key := p.waiting.Pack(tuple.Tuple{index, nextRandom()})
+	tr.Get(key)
+	tr.Set(key, []byte(""))
+	return key
+}
+
+func (p *Pops) resultKey(randId []byte) fdb.Key {
+	return p.results.Pack(tuple.Tuple{randId})
+}
+
+// fulfil hands the first items to the first waiting pops, or nothing if
+// the queue is empty. Returns true once no pops are left waiting.
+func (p *Pops) fulfil(db fdb.Database, items Items) bool {
+	v, err := db.Transact(func(tr fdb.Transaction) (interface{}, error) {
+		pops := tr.GetRange(p.waiting, fdb.RangeOptions{Limit: fulfilBatch}).GetSliceOrPanic()
+		kvs := items(tr, fulfilBatch)
+
+		for i, pop := range pops {
+			t, err := p.waiting.Unpack(pop.Key)
+			if err != nil {
+				panic(err)
+			}
+			if i < len(kvs) {
+				tr.Set(p.resultKey(t[1].([]byte)), kvs[i].Value)
+				tr.Get(kvs[i].Key)
+				tr.Clear(kvs[i].Key)
+			}
+			tr.Get(pop.Key)
+			tr.Clear(pop.Key)
+		}
+		return len(pops) < fulfilBatch, nil
+	})
+	if err != nil {
+		panic(err)
+	}
+	return v.(bool)
+}
+
+type keyReader interface {
+	GetKey(key fdb.Selectable) fdb.FutureKey
+}
+
+// nextIndex returns the index after the last one used in the subspace
+func nextIndex(tr keyReader, sub subspace.Subspace) int64 {
+	start, end := sub.FDBRangeKeys()
+	key := tr.GetKey(fdb.LastLessThan(end)).GetOrPanic()
+	if bytes.Compare(key, start.FDBKey()) < 0 {
+		return 0
+	}
+	if t, err := sub.Unpack(key); err != nil {
+		panic("Failed to unpack key")
+	} else {
+		return t[0].(int64) + 1
+	}
+}
+
+func nextRandom() []byte {
+	b := make([]byte, 20)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return b
+}
@@ -0,0 +1,139 @@
+/*
+Package lock provides a lease based lock class. It is a part of
+FoundationDb layer.
+
+A lock is held by one owner at a time until its lease expires or it is
+released. Every acquisition increments the fencing token of the lock, so
+systems downstream can reject writes from a holder that lost the lock:
+
+	(name) -> (owner, token, expires)
+
+Expiry comes from the clock of the holder. Other clients take an expired
+lock only after a grace period on top of it, which covers clock skew
+between them.
+*/
+
+package lock
+
+import (
+	"bytes"
+	"errors"
+	"github.com/FoundationDB/fdb-go/fdb"
+	"github.com/FoundationDB/fdb-go/fdb/subspace"
+	"github.com/FoundationDB/fdb-go/fdb/tuple"
+	"time"
+)
+
+const DefaultGrace = time.Second
+
+// ErrLost is returned when renewing or releasing a lease that expired and
+// was taken by another owner
+var ErrLost = errors.New("lock lease lost")
+
+type Locks struct {
+	Subspace subspace.Subspace
+	Grace    time.Duration
+}
+
+// New locks are created within a given subspace
+func New(sub subspace.Subspace) Locks {
+	return Locks{sub, DefaultGrace}
+}
+
+// Lease is a held lock
+type Lease struct {
+	Name    string
+	Owner   []byte
+	Token   int64 // fencing token, increasing with every acquisition
+	Expires time.Time
+	TTL     time.Duration
+	locks   *Locks
+}
+
+type state struct {
+	owner   []byte
+	token   int64
+	expires int64
+}
+
+func (l *Locks) key(name string) fdb.Key {
+	return l.Subspace.Pack(tuple.Tuple{name})
+}
+
+func (l *Locks) read(tr fdb.Transaction, name string) state {
+	val := tr.Get(l.key(name)).GetOrPanic()
+	if val == nil {
+		return state{}
+	}
+	if t, err := tuple.Unpack(val); err != nil {
+		panic(err)
+	} else {
+		owner, _ := t[0].([]byte)
+		return state{owner, t[1].(int64), t[2].(int64)}
+	}
+}
+
+func (l *Locks) write(tr fdb.Transaction, name string, s state) {
+	tr.Set(l.key(name), tuple.Tuple{s.owner, s.token, s.expires}.Pack())
+}
+
+// Acquire takes the lock for the owner if it is free, or held by the same
+// owner, which starts a new lease with a new token. Returns false if
+// another owner holds it.
+func (l *Locks) Acquire(db fdb.Database, name string, owner []byte, ttl time.Duration) (Lease, bool, error) {
+	v, err := db.Transact(func(tr fdb.Transaction) (interface{}, error) {
+		s := l.read(tr, name)
+		now := time.Now()
+		free := s.owner == nil || now.After(time.Unix(0, s.expires).Add(l.Grace))
+		if !free && !bytes.Equal(s.owner, owner) {
+			return nil, nil
+		}
+
+		expires := now.Add(ttl)
+		s = state{owner, s.token + 1, expires.UnixNano()}
+		l.write(tr, name, s)
+		return Lease{name, owner, s.token, expires, ttl, l}, nil
+	})
+	if err != nil || v == nil {
+		return Lease{}, false, err
+	}
+	return v.(Lease), true, nil
+}
+
+// holds returns whether the lock is still held under the lease
+func (lease *Lease) holds(s state) bool {
+	return s.token == lease.Token && bytes.Equal(s.owner, lease.Owner)
+}
+
+// Renew extends the lease by its TTL from now
+func (lease *Lease) Renew(db fdb.Database) error {
+	v, err := db.Transact(func(tr fdb.Transaction) (interface{}, error) {
+		s := lease.locks.read(tr, lease.Name)
+		if !lease.holds(s) {
+			return nil, ErrLost
+		}
+		expires := time.Now().Add(lease.TTL)
+		s.expires = expires.UnixNano()
+		lease.locks.write(tr, lease.Name, s)
+		return expires, nil
+	})
+	if err != nil {
+		return err
+	}
+	lease.Expires = v.(time.Time)
+	return nil
+}
+
+// Release frees the lock if it is still held under the lease. The token
+// stays, so the next owner gets a higher one.
+func (lease *Lease) Release(db fdb.Database) error {
+	_, err := db.Transact(func(tr fdb.Transaction) (interface{}, error) {
+		s := lease.locks.read(tr, lease.Name)
+		if !lease.holds(s) {
+			return nil, ErrLost
+		}
+		lease.locks.write(tr, lease.Name, state{nil, s.token, 0})
+		return nil, nil
+	})
+	return err
+}
@@ -0,0 +1,85 @@
+package lock
+
+import (
+	"fmt"
+	"github.com/abdullin/go-layers/internal/fdbtest"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestAcquireContended(t *testing.T) {
+	db, sub := fdbtest.Open(t)
+	l := New(sub)
+
+	const owners = 10
+	leases := make([]Lease, owners)
+	oks := make([]bool, owners)
+	errs := make([]error, owners)
+	var wg sync.WaitGroup
+	for i := 0; i < owners; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			leases[i], oks[i], errs[i] = l.Acquire(db, "job", []byte(fmt.Sprint(i)), time.Minute)
+		}(i)
+	}
+	wg.Wait()
+
+	var held []Lease
+	for i := range leases {
+		if errs[i] != nil {
+			t.Fatal(errs[i])
+		}
+		if oks[i] {
+			held = append(held, leases[i])
+		}
+	}
+	if len(held) != 1 {
+		t.Fatalf("%d owners hold the lock", len(held))
+	}
+
+	lease := held[0]
+	if err := lease.Release(db); err != nil {
+		t.Fatal(err)
+	}
+	next, ok, err := l.Acquire(db, "job", []byte("next"), time.Minute)
+	if err != nil || !ok {
+		t.Fatalf("acquired a released lock: %v, %v", ok, err)
+	}
+	if next.Token <= lease.Token {
+		t.Fatalf("token %d after %d", next.Token, lease.Token)
+	}
+}
+
+func TestLeaseExpired(t *testing.T) {
+	db, sub := fdbtest.Open(t)
+	l := New(sub)
+	l.Grace = 0
+
+	old, ok, err := l.Acquire(db, "job", []byte("old"), 50*time.Millisecond)
+	if err != nil || !ok {
+		t.Fatalf("acquired: %v, %v", ok, err)
+	}
+	if _, ok, err := l.Acquire(db, "job", []byte("new"), time.Minute); err != nil || ok {
+		t.Fatalf("acquired a held lock: %v, %v", ok, err)
+	}
+	time.Sleep(100 * time.Millisecond)
+
+	lease, ok, err := l.Acquire(db, "job", []byte("new"), time.Minute)
+	if err != nil || !ok {
+		t.Fatalf("acquired an expired lock: %v, %v", ok, err)
+	}
+	if lease.Token <= old.Token {
+		t.Fatalf("token %d after %d", lease.Token, old.Token)
+	}
+	if err := old.Renew(db); err != ErrLost {
+		t.Fatalf("renewed a lost lease with %v", err)
+	}
+	if err := old.Release(db); err != ErrLost {
+		t.Fatalf("released a lost lease with %v", err)
+	}
+	if err := lease.Renew(db); err != nil {
+		t.Fatal(err)
+	}
+}
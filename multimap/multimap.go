@@ -0,0 +1,121 @@
+/*
+Package multimap provides a multimap class. It is a part of FoundationDb
+layer.
+
+A multimap maps every key to a set of values, each with a count of how
+many times it was added. Keys and values are tuple elements stored as
+(key, value) -> count, with counts updated by atomic ADD, so adding never
+conflicts. Removing reads the count, so it conflicts with anything else
+changing the same value at the same time, and a count can't be driven
+below zero by concurrent removes.
+
+This code is a port from official python layer
+*/
+
+package multimap
+
+import (
+	"encoding/binary"
+	"github.com/FoundationDB/fdb-go/fdb"
+	"github.com/FoundationDB/fdb-go/fdb/subspace"
+	"github.com/FoundationDB/fdb-go/fdb/tuple"
+)
+
+type MultiMap struct {
+	Subspace subspace.Subspace
+}
+
+// New multimap is created within a given subspace
+func New(sub subspace.Subspace) MultiMap {
+	return MultiMap{sub}
+}
+
+func encodeCount(n int64) []byte {
+	b := make([]byte, 8)
+	binary.LittleEndian.PutUint64(b, uint64(n))
+	return b
+}
+
+func decodeCount(b []byte) int64 {
+	if len(b) != 8 {
+		return 0
+	}
+	return int64(binary.LittleEndian.Uint64(b))
+}
+
+// Add adds a copy of the value to the key
+func (mm *MultiMap) Add(tr fdb.Transaction, key, value tuple.TupleElement) {
+	tr.Add(mm.Subspace.Pack(tuple.Tuple{key, value}), encodeCount(1))
+}
+
+// Remove removes a copy of the value from the key, and the value once no
+// copy is left
+func (mm *MultiMap) Remove(tr fdb.Transaction, key, value tuple.TupleElement) {
+	k := mm.Subspace.Pack(tuple.Tuple{key, value})
+	if decodeCount(tr.Get(k).GetOrPanic()) > 1 {
+		tr.Add(k, encodeCount(-1))
+	} else {
+		tr.Clear(k)
+	}
+}
+
+// RemoveAll removes all copies of the value from the key
+func (mm *MultiMap) RemoveAll(tr fdb.Transaction, key, value tuple.TupleElement) {
+	tr.Clear(mm.Subspace.Pack(tuple.Tuple{key, value}))
+}
+
+// ClearKey removes the key with all its values
+func (mm *MultiMap) ClearKey(tr fdb.Transaction, key tuple.TupleElement) {
+	tr.ClearRange(mm.Subspace.Sub(key))
+}
+
+// Count returns the number of copies of the value under the key
+func (mm *MultiMap) Count(tr fdb.Transaction, key, value tuple.TupleElement) int64 {
+	return decodeCount(tr.Get(mm.Subspace.Pack(tuple.Tuple{key, value})).GetOrPanic())
+}
+
+// ContainsValue tells whether the key holds the value
+func (mm *MultiMap) ContainsValue(tr fdb.Transaction, key, value tuple.TupleElement) bool {
+	return mm.Count(tr, key, value) > 0
+}
+
+// Get returns an iterator over the values of the key in tuple order
+func (mm *MultiMap) Get(tr fdb.Transaction, key tuple.TupleElement) *Iterator {
+	sub := mm.Subspace.Sub(key)
+	return &Iterator{sub: sub, ri: tr.GetRange(sub, fdb.RangeOptions{}).Iterator()}
+}
+
+// Iterator reads the values of a key as they are advanced over
+type Iterator struct {
+	sub   subspace.Subspace
+	ri    *fdb.RangeIterator
+	value tuple.TupleElement
+	count int64
+}
+
+// Advance moves to the next value, returning false at the end
+func (it *Iterator) Advance() bool {
+	for it.ri.Advance() {
+		kv := it.ri.GetNextOrPanic()
+		t, err := it.sub.Unpack(kv.Key)
+		if err != nil {
+			panic(err)
+		}
+		// counts brought to zero by atomic adds are skipped
+		if n := decodeCount(kv.Value); n > 0 {
+			it.value, it.count = t[0], n
+			return true
+		}
+	}
+	return false
+}
+
+// Value returns the current value
+func (it *Iterator) Value() tuple.TupleElement {
+	return it.value
+}
+
+// Count returns the number of copies of the current value
+func (it *Iterator) Count() int64 {
+	return it.count
+}
@@ -0,0 +1,134 @@
+package multimap
+
+import (
+	"github.com/FoundationDB/fdb-go/fdb"
+	"github.com/abdullin/go-layers/internal/fdbtest"
+	"sync"
+	"testing"
+)
+
+func TestAddRemove(t *testing.T) {
+	db, sub := fdbtest.Open(t)
+	mm := New(sub)
+
+	_, err := db.Transact(func(tr fdb.Transaction) (interface{}, error) {
+		mm.Add(tr, "k", "a")
+		mm.Add(tr, "k", "a")
+		mm.Add(tr, "k", "b")
+		mm.Add(tr, "other", "a")
+		return nil, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	values := func() map[string]int64 {
+		v, err := db.Transact(func(tr fdb.Transaction) (interface{}, error) {
+			values := map[string]int64{}
+			for it := mm.Get(tr, "k"); it.Advance(); {
+				values[it.Value().(string)] = it.Count()
+			}
+			return values, nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return v.(map[string]int64)
+	}
+	if got := values(); len(got) != 2 || got["a"] != 2 || got["b"] != 1 {
+		t.Fatalf("values %v", got)
+	}
+
+	_, err = db.Transact(func(tr fdb.Transaction) (interface{}, error) {
+		mm.Remove(tr, "k", "a")
+		mm.Remove(tr, "k", "b")
+		// removing a missing value is a no-op
+		mm.Remove(tr, "k", "c")
+		return nil, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := values(); len(got) != 1 || got["a"] != 1 {
+		t.Fatalf("values after removing %v", got)
+	}
+
+	_, err = db.Transact(func(tr fdb.Transaction) (interface{}, error) {
+		mm.ClearKey(tr, "k")
+		return nil, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := values(); len(got) != 0 {
+		t.Fatalf("values after clearing %v", got)
+	}
+	v, err := db.Transact(func(tr fdb.Transaction) (interface{}, error) {
+		return mm.ContainsValue(tr, "other", "a"), nil
+	})
+	if err != nil || !v.(bool) {
+		t.Fatalf("other key lost its value: %v, %v", v, err)
+	}
+}
+
+func TestRemoveConcurrent(t *testing.T) {
+	db, sub := fdbtest.Open(t)
+	mm := New(sub)
+
+	const copies, removers = 5, 20
+	_, err := db.Transact(func(tr fdb.Transaction) (interface{}, error) {
+		for i := 0; i < copies; i++ {
+			mm.Add(tr, "k", "v")
+		}
+		return nil, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// more removers than copies: the extra ones find nothing to remove
+	var wg sync.WaitGroup
+	errs := make([]error, removers)
+	for i := 0; i < removers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			_, errs[i] = db.Transact(func(tr fdb.Transaction) (interface{}, error) {
+				mm.Remove(tr, "k", "v")
+				return nil, nil
+			})
+		}(i)
+	}
+	wg.Wait()
+	for _, err := range errs {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	v, err := db.Transact(func(tr fdb.Transaction) (interface{}, error) {
+		kvs, err := tr.GetRange(sub, fdb.RangeOptions{}).GetSliceWithError()
+		return len(kvs), err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := v.(int); n != 0 {
+		t.Fatalf("%d entries left after removing every copy", n)
+	}
+
+	// a value added after is counted from one
+	_, err = db.Transact(func(tr fdb.Transaction) (interface{}, error) {
+		mm.Add(tr, "k", "v")
+		return nil, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	v, err = db.Transact(func(tr fdb.Transaction) (interface{}, error) {
+		return mm.Count(tr, "k", "v"), nil
+	})
+	if err != nil || v.(int64) != 1 {
+		t.Fatalf("count after adding again %v, %v", v, err)
+	}
+}
@@ -0,0 +1,134 @@
+/*
+Package pq provides a high-contention priority queue class. It is a part
+of FoundationDb layer.
+
+Items are popped by priority, highest first unless the queue is created
+lowest first. Items of the same priority are popped in the order of the
+transactions that pushed them, and in random order within a transaction:
+
+	(priority, versionstamp, randId) -> value
+
+Pushes don't read anything, so they never conflict. Pops work like the
+ones of the queue layer, including its high contention mode.
+
+This code is a port from official python layer
+*/
+
+package pq
+
+import (
+	"crypto/rand"
+	"github.com/FoundationDB/fdb-go/fdb"
+	"github.com/FoundationDB/fdb-go/fdb/subspace"
+	"github.com/FoundationDB/fdb-go/fdb/tuple"
+	"github.com/abdullin/go-layers/internal/pops"
+	"github.com/abdullin/go-layers/versionstamp"
+)
+
+const stampLen = 10
+
+type PriorityQueue struct {
+	Subspace       subspace.Subspace
+	HighContention bool
+	LowestFirst    bool
+	pops           pops.Pops
+	item           subspace.Subspace
+}
+
+// New priority queue is created within a given subspace
+func New(sub subspace.Subspace, highContention, lowestFirst bool) PriorityQueue {
+	return PriorityQueue{sub, highContention, lowestFirst, pops.New(sub.Sub("pop"), sub.Sub("conflict")), sub.Sub("item")}
+}
+
+// Clear all items from the queue
+func (pq *PriorityQueue) Clear(tr fdb.Transaction) {
+	tr.ClearRange(pq.Subspace)
+}
+
+// Push an item with a priority onto the queue
+func (pq *PriorityQueue) Push(tr fdb.Transaction, value []byte, priority int64) {
+	// inverting the bits reverses the order without overflowing
+	if !pq.LowestFirst {
+		priority = ^priority
+	}
+	prefix := pq.item.Pack(tuple.Tuple{priority})
+
+	key := make([]byte, 0, len(prefix)+stampLen+32)
+	key = append(key, prefix...)
+	key = append(key, make([]byte, stampLen)...)
+	key = append(key, tuple.Tuple{nextRandom()}.Pack()...)
+
+	tr.SetVersionstampedKey(fdb.Key(versionstamp.Key(key, len(prefix))), encodeValue(value))
+}
+
+// Peek at value of the next item without popping it
+func (pq *PriorityQueue) Peek(tr fdb.Transaction) (value []byte, ok bool) {
+	if kvs := pq.getItems(tr, 1); len(kvs) == 1 {
+		return decodeValue(kvs[0].Value), true
+	}
+	return
+}
+
+// Empty returns true is queue does not have any messages
+func (pq *PriorityQueue) Empty(tr fdb.Transaction) bool {
+	_, ok := pq.Peek(tr)
+	return !ok
+}
+
+// Pop the next item from the queue. Cannot be composed with other functions
+// in a single transaction.
+func (pq *PriorityQueue) Pop(db fdb.Database) (value []byte, ok bool) {
+	if pq.HighContention {
+		if result, ok := pq.pops.Pop(db, pq.getItems); ok {
+			return decodeValue(result), true
+		}
+		return
+	}
+
+	val, err := db.Transact(func(tr fdb.Transaction) (interface{}, error) {
+		if result, ok := pops.PopSimple(tr, pq.getItems); ok {
+			return decodeValue(result), nil
+		}
+		return nil, nil
+	})
+	if err != nil {
+		panic(err)
+	}
+	if val != nil {
+		return val.([]byte), true
+	}
+	return
+}
+
+// PopTr pops the next item as part of the caller's transaction, without
+// trying to avoid conflicts with other poppers
+func (pq *PriorityQueue) PopTr(tr fdb.Transaction) (value []byte, ok bool) {
+	if result, ok := pops.PopSimple(tr, pq.getItems); ok {
+		return decodeValue(result), true
+	}
+	return
+}
+
+func (pq *PriorityQueue) getItems(tr fdb.Transaction, limit int) []fdb.KeyValue {
+	return tr.GetRange(pq.item, fdb.RangeOptions{Limit: limit}).GetSliceOrPanic()
+}
+
+func decodeValue(val []byte) []byte {
+	if t, err := tuple.Unpack(val); err != nil {
+		panic(err)
+	} else {
+		return t[0].([]byte)
+	}
+}
+
+func encodeValue(value []byte) []byte {
+	return tuple.Tuple{value}.Pack()
+}
+
+func nextRandom() []byte {
+	b := make([]byte, 20)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return b
+}
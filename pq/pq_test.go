@@ -0,0 +1,125 @@
+package pq
+
+import (
+	"github.com/FoundationDB/fdb-go/fdb"
+	"github.com/abdullin/go-layers/internal/fdbtest"
+	"math"
+	"strconv"
+	"sync"
+	"testing"
+)
+
+var modes = map[string]bool{"simple": false, "high contention": true}
+
+func push(t *testing.T, db fdb.Database, q *PriorityQueue, value string, priority int64) {
+	t.Helper()
+	_, err := db.Transact(func(tr fdb.Transaction) (interface{}, error) {
+		q.Push(tr, []byte(value), priority)
+		return nil, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestOrder(t *testing.T) {
+	priorities := []int64{0, math.MinInt64, 5, -1, math.MaxInt64, 5, 1, -1, 0}
+	for _, lowestFirst := range []bool{false, true} {
+		for name, hc := range modes {
+			t.Run(name+" lowest first "+strconv.FormatBool(lowestFirst), func(t *testing.T) {
+				db, sub := fdbtest.Open(t)
+				q := New(sub, hc, lowestFirst)
+
+				// one transaction per push, so items of a priority are
+				// popped in push order
+				for i, p := range priorities {
+					push(t, db, &q, strconv.Itoa(i), p)
+				}
+				var want []string
+				order := []int64{math.MaxInt64, 5, 1, 0, -1, math.MinInt64}
+				if lowestFirst {
+					for i, j := 0, len(order)-1; i < j; i, j = i+1, j-1 {
+						order[i], order[j] = order[j], order[i]
+					}
+				}
+				for _, p := range order {
+					for i, pr := range priorities {
+						if pr == p {
+							want = append(want, strconv.Itoa(i))
+						}
+					}
+				}
+
+				for i, w := range want {
+					value, ok := q.Pop(db)
+					if !ok || string(value) != w {
+						t.Fatalf("pop %d returned %q, %v, want %q", i, value, ok, w)
+					}
+				}
+				if value, ok := q.Pop(db); ok {
+					t.Fatalf("popped %q from an empty queue", value)
+				}
+			})
+		}
+	}
+}
+
+func TestPopConcurrent(t *testing.T) {
+	for name, hc := range modes {
+		t.Run(name, func(t *testing.T) {
+			db, sub := fdbtest.Open(t)
+			q := New(sub, hc, false)
+
+			const items, poppers = 200, 10
+			for batch := 0; batch < 4; batch++ {
+				_, err := db.Transact(func(tr fdb.Transaction) (interface{}, error) {
+					for i := batch; i < items; i += 4 {
+						q.Push(tr, []byte(strconv.Itoa(i)), int64(i%3))
+					}
+					return nil, nil
+				})
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			popped := make([][]string, poppers)
+			var wg sync.WaitGroup
+			for p := 0; p < poppers; p++ {
+				wg.Add(1)
+				go func(p int) {
+					defer wg.Done()
+					for {
+						value, ok := q.Pop(db)
+						if !ok {
+							return
+						}
+						popped[p] = append(popped[p], string(value))
+					}
+				}(p)
+			}
+			wg.Wait()
+
+			seen := map[string]bool{}
+			for _, values := range popped {
+				// every popper sees priorities in order
+				last := int64(math.MaxInt64)
+				for _, v := range values {
+					if seen[v] {
+						t.Fatalf("%s popped twice", v)
+					}
+					seen[v] = true
+					i, _ := strconv.Atoi(v)
+					if p := int64(i % 3); p > last {
+						t.Fatalf("%s of priority %d popped after priority %d", v, p, last)
+					} else {
+						last = p
+					}
+				}
+			}
+			if len(seen) != items {
+				t.Fatalf("popped %d of %d items", len(seen), items)
+			}
+		})
+	}
+}
@@ -0,0 +1,226 @@
+/*
+Package pubsub provides a publish-subscribe class with durable
+subscribers. It is a part of FoundationDb layer.
+
+Messages are written once to the log of their topic, ordered by the
+versionstamp of the publishing transaction. Every subscriber keeps its own
+cursor into the log, so a slow subscriber doesn't hold up the others:
+
+	("log", topic, versionstamp, randId) -> message
+	("sub", topic, name)                 -> (position of the last message consumed)
+	("notify", topic)                    -> bumped on every publish
+
+Messages published in the same transaction share a versionstamp and are
+consumed in random order. Trim removes messages every subscriber has
+consumed.
+*/
+
+package pubsub
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"errors"
+	"github.com/FoundationDB/fdb-go/fdb"
+	"github.com/FoundationDB/fdb-go/fdb/subspace"
+	"github.com/FoundationDB/fdb-go/fdb/tuple"
+	"github.com/abdullin/go-layers/subspaces"
+	"github.com/abdullin/go-layers/versionstamp"
+)
+
+const stampLen = 10
+
+// consumeBatch is the number of messages handled per transaction
+const consumeBatch = 100
+
+var ErrNotSubscribed = errors.New("subscriber not found")
+
+type PubSub struct {
+	Subspace    subspace.Subspace
+	log         subspace.Subspace
+	subscribers subspace.Subspace
+	notify      subspace.Subspace
+}
+
+// New pubsub is created within a given subspace
+func New(sub subspace.Subspace) PubSub {
+	return PubSub{sub, sub.Sub("log"), sub.Sub("sub"), sub.Sub("notify")}
+}
+
+// Message is a published message and its position in the topic log
+type Message struct {
+	Position []byte
+	Value    []byte
+}
+
+func (ps *PubSub) subscriberKey(topic, name string) fdb.Key {
+	return ps.subscribers.Pack(tuple.Tuple{topic, name})
+}
+
+// notifySpace is the subspace whose sentinel key publishes to the topic
+// bump, see subspaces.Bump
+func (ps *PubSub) notifySpace(topic string) subspace.Subspace {
+	return ps.notify.Sub(topic)
+}
+
+// Publish writes the message to the topic. Publishing reads nothing, so
+// publishers never conflict.
+func (ps *PubSub) Publish(tr fdb.Transaction, topic string, msg []byte) {
+	prefix := ps.log.Sub(topic).Bytes()
+
+	key := make([]byte, 0, len(prefix)+stampLen+32)
+	key = append(key, prefix...)
+	key = append(key, make([]byte, stampLen)...)
+	key = append(key, tuple.Tuple{nextRandom()}.Pack()...)
+
+	tr.SetVersionstampedKey(fdb.Key(versionstamp.Key(key, len(prefix))), msg)
+	subspaces.Bump(tr, ps.notifySpace(topic))
+}
+
+// Subscribe registers a subscriber of the topic, which receives messages
+// published from now on. Subscribing again keeps the cursor.
+func (ps *PubSub) Subscribe(db fdb.Database, topic, name string) error {
+	_, err := db.Transact(func(tr fdb.Transaction) (interface{}, error) {
+		key := ps.subscriberKey(topic, name)
+		if tr.Get(key).GetOrPanic() != nil {
+			return nil, nil
+		}
+		tr.Set(key, encodeCursor(ps.tail(tr, topic)))
+		return nil, nil
+	})
+	return err
+}
+
+// Unsubscribe removes a subscriber, so it no longer holds back Trim
+func (ps *PubSub) Unsubscribe(db fdb.Database, topic, name string) error {
+	_, err := db.Transact(func(tr fdb.Transaction) (interface{}, error) {
+		tr.Clear(ps.subscriberKey(topic, name))
+		return nil, nil
+	})
+	return err
+}
+
+// tail returns the position of the last message of the topic, empty if
+// there is none
+func (ps *PubSub) tail(tr fdb.Transaction, topic string) []byte {
+	log := ps.log.Sub(topic)
+	_, end := log.FDBRangeKeys()
+	if key := tr.GetKey(fdb.LastLessThan(end)).GetOrPanic(); log.Contains(key) {
+		return key[len(log.Bytes()):]
+	}
+	return []byte{}
+}
+
+// Consume passes the messages of the topic to the handler in order,
+// starting after the cursor of the subscriber, until the context is done
+// or the handler fails. The cursor moves in the transaction of the
+// handler, so messages are handled once with the writes they cause. When
+// there are no new messages it waits for the next publish.
+func (ps *PubSub) Consume(ctx context.Context, db fdb.Database, topic, name string, handler func(fdb.Transaction, Message) error) error {
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		v, err := db.Transact(func(tr fdb.Transaction) (interface{}, error) {
+			return ps.consumeBatch(tr, topic, name, handler)
+		})
+		if err != nil {
+			return err
+		}
+		watch, ok := v.(fdb.FutureNil)
+		if !ok {
+			continue
+		}
+
+		fired := make(chan struct{})
+		go func() {
+			watch.BlockUntilReady()
+			close(fired)
+		}()
+		select {
+		case <-ctx.Done():
+			watch.Cancel()
+			return ctx.Err()
+		case <-fired:
+		}
+	}
+}
+
+// consumeBatch hands the next messages to the handler, or returns a
+// watch on the topic if there are none
+func (ps *PubSub) consumeBatch(tr fdb.Transaction, topic, name string, handler func(fdb.Transaction, Message) error) (interface{}, error) {
+	key := ps.subscriberKey(topic, name)
+	val := tr.Get(key).GetOrPanic()
+	if val == nil {
+		return nil, ErrNotSubscribed
+	}
+	cursor := decodeCursor(val)
+
+	log := ps.log.Sub(topic)
+	begin, end := log.FDBRangeKeys()
+	if len(cursor) > 0 {
+		begin = fdb.Key(append(append(append([]byte{}, log.Bytes()...), cursor...), 0x00))
+	}
+	r := fdb.KeyRange{Begin: begin, End: end}
+	kvs := tr.GetRange(r, fdb.RangeOptions{Limit: consumeBatch}).GetSliceOrPanic()
+	if len(kvs) == 0 {
+		return subspaces.Watch(tr, ps.notifySpace(topic)), nil
+	}
+
+	for _, kv := range kvs {
+		msg := Message{kv.Key[len(log.Bytes()):], kv.Value}
+		if err := handler(tr, msg); err != nil {
+			return nil, err
+		}
+	}
+	tr.Set(key, encodeCursor(kvs[len(kvs)-1].Key[len(log.Bytes()):]))
+	return nil, nil
+}
+
+// Trim removes the messages of the topic consumed by all its subscribers,
+// or all of them if there are none
+func (ps *PubSub) Trim(db fdb.Database, topic string) error {
+	_, err := db.Transact(func(tr fdb.Transaction) (interface{}, error) {
+		subscribers := tr.GetRange(ps.subscribers.Sub(topic), fdb.RangeOptions{}).GetSliceOrPanic()
+		oldest := ps.tail(tr, topic)
+		for i, kv := range subscribers {
+			if cursor := decodeCursor(kv.Value); i == 0 || bytes.Compare(cursor, oldest) < 0 {
+				oldest = cursor
+			}
+		}
+		if len(oldest) == 0 {
+			return nil, nil
+		}
+
+		log := ps.log.Sub(topic)
+		begin, _ := log.FDBRangeKeys()
+		end := fdb.Key(append(append(append([]byte{}, log.Bytes()...), oldest...), 0x00))
+		tr.ClearRange(fdb.KeyRange{Begin: begin, End: end})
+		return nil, nil
+	})
+	return err
+}
+
+// cursors are stored as tuples, which keeps empty ones apart from missing
+// subscribers
+func encodeCursor(pos []byte) []byte {
+	return tuple.Tuple{pos}.Pack()
+}
+
+func decodeCursor(val []byte) []byte {
+	if t, err := tuple.Unpack(val); err != nil {
+		panic(err)
+	} else {
+		return t[0].([]byte)
+	}
+}
+
+func nextRandom() []byte {
+	b := make([]byte, 20)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return b
+}
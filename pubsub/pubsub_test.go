@@ -0,0 +1,257 @@
+package pubsub
+
+import (
+	"context"
+	"errors"
+	"github.com/FoundationDB/fdb-go/fdb"
+	"github.com/FoundationDB/fdb-go/fdb/tuple"
+	"github.com/abdullin/go-layers/internal/fdbtest"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+)
+
+func publish(t *testing.T, db fdb.Database, ps *PubSub, topic string, msgs ...string) {
+	t.Helper()
+	for _, msg := range msgs {
+		_, err := db.Transact(func(tr fdb.Transaction) (interface{}, error) {
+			ps.Publish(tr, topic, []byte(msg))
+			return nil, nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// consume returns the next n messages of the subscriber in log order,
+// which has to be all it has, since a batch is consumed whole. Handlers
+// may run again when their transaction retries, so messages are collected
+// by position.
+func consume(t *testing.T, db fdb.Database, ps *PubSub, topic, name string, n int) []string {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var mu sync.Mutex
+	got := map[string]string{}
+	err := ps.Consume(ctx, db, topic, name, func(tr fdb.Transaction, msg Message) error {
+		mu.Lock()
+		defer mu.Unlock()
+		if got[string(msg.Position)] = string(msg.Value); len(got) == n {
+			cancel()
+		}
+		return nil
+	})
+	if err != context.Canceled {
+		t.Fatalf("consumed %d of %d messages: %v", len(got), n, err)
+	}
+
+	positions := make([]string, 0, len(got))
+	for pos := range got {
+		positions = append(positions, pos)
+	}
+	sort.Strings(positions)
+	msgs := make([]string, len(positions))
+	for i, pos := range positions {
+		msgs[i] = got[pos]
+	}
+	return msgs
+}
+
+func equal(a []string, b ...string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// logLen returns the number of messages in the log of the topic
+func logLen(t *testing.T, db fdb.Database, ps *PubSub, topic string) int {
+	t.Helper()
+	v, err := db.Transact(func(tr fdb.Transaction) (interface{}, error) {
+		kvs, err := tr.GetRange(ps.log.Sub(topic), fdb.RangeOptions{}).GetSliceWithError()
+		return len(kvs), err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return v.(int)
+}
+
+func TestCursors(t *testing.T) {
+	db, sub := fdbtest.Open(t)
+	ps := New(sub)
+
+	publish(t, db, &ps, "t", "before")
+	for _, name := range []string{"a", "b"} {
+		if err := ps.Subscribe(db, "t", name); err != nil {
+			t.Fatal(err)
+		}
+	}
+	publish(t, db, &ps, "t", "1", "2", "3")
+	publish(t, db, &ps, "other", "x")
+
+	// subscribers start at the tail and move on their own
+	if msgs := consume(t, db, &ps, "t", "a", 3); !equal(msgs, "1", "2", "3") {
+		t.Fatalf("a consumed %v", msgs)
+	}
+	publish(t, db, &ps, "t", "4")
+	if msgs := consume(t, db, &ps, "t", "a", 1); !equal(msgs, "4") {
+		t.Fatalf("a consumed %v", msgs)
+	}
+	if msgs := consume(t, db, &ps, "t", "b", 4); !equal(msgs, "1", "2", "3", "4") {
+		t.Fatalf("b consumed %v", msgs)
+	}
+	// subscribing again keeps the cursor
+	publish(t, db, &ps, "t", "5")
+	if err := ps.Subscribe(db, "t", "a"); err != nil {
+		t.Fatal(err)
+	}
+	if msgs := consume(t, db, &ps, "t", "a", 1); !equal(msgs, "5") {
+		t.Fatalf("a consumed %v after subscribing again", msgs)
+	}
+
+	err := ps.Consume(context.Background(), db, "t", "nobody", func(fdb.Transaction, Message) error { return nil })
+	if err != ErrNotSubscribed {
+		t.Fatalf("consumed without subscribing: %v", err)
+	}
+}
+
+func TestConsumeWakesUp(t *testing.T) {
+	db, sub := fdbtest.Open(t)
+	ps := New(sub)
+	if err := ps.Subscribe(db, "t", "a"); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	woken := make(chan string, 1)
+	done := make(chan error, 1)
+	go func() {
+		done <- ps.Consume(ctx, db, "t", "a", func(tr fdb.Transaction, msg Message) error {
+			select {
+			case woken <- string(msg.Value):
+			default:
+			}
+			return nil
+		})
+	}()
+
+	// the consumer is waiting on an empty topic by now
+	time.Sleep(200 * time.Millisecond)
+	publish(t, db, &ps, "t", "late")
+
+	select {
+	case msg := <-woken:
+		if msg != "late" {
+			t.Fatalf("consumed %q", msg)
+		}
+	case err := <-done:
+		t.Fatalf("consumer stopped: %v", err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("consumer not woken up by a publish")
+	}
+	cancel()
+	if err := <-done; err != context.Canceled {
+		t.Fatal(err)
+	}
+}
+
+func TestConsumeTransactional(t *testing.T) {
+	db, sub := fdbtest.Open(t)
+	ps := New(sub)
+	if err := ps.Subscribe(db, "t", "a"); err != nil {
+		t.Fatal(err)
+	}
+	publish(t, db, &ps, "t", "1", "2")
+
+	// the handler fails on the second message: its writes for the first
+	// are rolled back with the cursor
+	errHandler := errors.New("handler failed")
+	effects := sub.Sub("effects")
+	err := ps.Consume(context.Background(), db, "t", "a", func(tr fdb.Transaction, msg Message) error {
+		if string(msg.Value) == "2" {
+			return errHandler
+		}
+		tr.Set(effects.Pack(tuple.Tuple{msg.Position}), msg.Value)
+		return nil
+	})
+	if err != errHandler {
+		t.Fatalf("consume with a failing handler: %v", err)
+	}
+	v, err := db.Transact(func(tr fdb.Transaction) (interface{}, error) {
+		kvs, err := tr.GetRange(effects, fdb.RangeOptions{}).GetSliceWithError()
+		return len(kvs), err
+	})
+	if err != nil || v.(int) != 0 {
+		t.Fatalf("%v writes of a failed handler kept, %v", v, err)
+	}
+
+	if msgs := consume(t, db, &ps, "t", "a", 2); !equal(msgs, "1", "2") {
+		t.Fatalf("consumed %v after the failure", msgs)
+	}
+}
+
+func TestTrim(t *testing.T) {
+	db, sub := fdbtest.Open(t)
+	ps := New(sub)
+
+	// without subscribers everything goes
+	publish(t, db, &ps, "t", "0", "1")
+	if err := ps.Trim(db, "t"); err != nil {
+		t.Fatal(err)
+	}
+	if n := logLen(t, db, &ps, "t"); n != 0 {
+		t.Fatalf("%d messages left without subscribers", n)
+	}
+
+	// a subscriber of an empty topic holds back everything
+	if err := ps.Subscribe(db, "t", "a"); err != nil {
+		t.Fatal(err)
+	}
+	publish(t, db, &ps, "t", "0", "1")
+	if err := ps.Trim(db, "t"); err != nil {
+		t.Fatal(err)
+	}
+	if n := logLen(t, db, &ps, "t"); n != 2 {
+		t.Fatalf("%d messages left before anything was consumed", n)
+	}
+
+	// one subscriber: what it consumed goes
+	consume(t, db, &ps, "t", "a", 2)
+	publish(t, db, &ps, "t", "2")
+	if err := ps.Trim(db, "t"); err != nil {
+		t.Fatal(err)
+	}
+	if n := logLen(t, db, &ps, "t"); n != 1 {
+		t.Fatalf("%d messages left after a consumed 2 of 3", n)
+	}
+
+	// several: the slowest holds back the rest
+	if err := ps.Subscribe(db, "t", "b"); err != nil {
+		t.Fatal(err)
+	}
+	publish(t, db, &ps, "t", "3")
+	consume(t, db, &ps, "t", "a", 2)
+	if err := ps.Trim(db, "t"); err != nil {
+		t.Fatal(err)
+	}
+	if n := logLen(t, db, &ps, "t"); n != 1 {
+		t.Fatalf("%d messages left behind b", n)
+	}
+	consume(t, db, &ps, "t", "b", 1)
+	if err := ps.Trim(db, "t"); err != nil {
+		t.Fatal(err)
+	}
+	if n := logLen(t, db, &ps, "t"); n != 0 {
+		t.Fatalf("%d messages left after everyone consumed them", n)
+	}
+}
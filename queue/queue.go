@@ -18,20 +18,19 @@ This code is a port from official python layer
 package queue
 
 import (
-	"bytes"
 	"crypto/rand"
-	"fmt"
 	"github.com/FoundationDB/fdb-go/fdb"
 	"github.com/FoundationDB/fdb-go/fdb/subspace"
 	"github.com/FoundationDB/fdb-go/fdb/tuple"
-	"time"
+	"github.com/abdullin/go-layers/internal/pops"
+	"github.com/abdullin/go-layers/subspaces"
+	mathrand "math/rand"
 )
 
 type Queue struct {
 	Subspace       subspace.Subspace
 	HighContention bool
-	conflictedPop  subspace.Subspace // stores int64 index, randId []byte
-	conflictedItem subspace.Subspace
+	pops           pops.Pops
 	queueItem      subspace.Subspace
 }
 
@@ -42,12 +41,12 @@ func New(sub subspace.Subspace, highContention bool) Queue {
 	pop := sub.Sub("pop")
 	item := sub.Sub("item")
 
-	return Queue{sub, highContention, pop, conflict, item}
+	return Queue{sub, highContention, pops.New(pop, conflict), item}
 }
 
 // Clear all items from the queue
 func (queue *Queue) Clear(tr fdb.Transaction) {
-	tr.ClearRange(queue.Subspace)
+	subspaces.NewTx(tr, queue.Subspace).ClearRange(nil)
 }
 
 // Peek at value of the next item without popping it
@@ -78,11 +77,8 @@ type KeyReader interface {
 // to make private
 func (queue *Queue) GetNextIndex(tr KeyReader, sub subspace.Subspace) int64 {
 
-	start, end := sub.FDBRangeKeys()
-
-	key := tr.GetKey(fdb.LastLessThan(end)).GetOrPanic()
-
-	if i := bytes.Compare(key, []byte(start.FDBKey())); i < 0 {
+	key := tr.GetKey(subspaces.LastBefore(sub, nil)).GetOrPanic()
+	if !sub.Contains(key) {
 		return 0
 	}
 
@@ -109,7 +105,7 @@ func (queue *Queue) Push(tr fdb.Transaction, value []byte) {
 func (queue *Queue) Pop(db fdb.Database) (value []byte, ok bool) {
 
 	if queue.HighContention {
-		if result, ok := queue.popHighContention(db); ok {
+		if result, ok := queue.pops.Pop(db, queue.getItems); ok {
 			return decodeValue(result), true
 		}
 	} else {
@@ -129,207 +125,76 @@ func (queue *Queue) Pop(db fdb.Database) (value []byte, ok bool) {
 	return
 }
 
+// PopTr pops the next item as part of the caller's transaction, without
+// trying to avoid conflicts with other poppers
+func (queue *Queue) PopTr(tr fdb.Transaction) (value []byte, ok bool) {
+	if result, ok := queue.popSimple(tr); ok {
+		return decodeValue(result), true
+	}
+	return
+}
+
+// PopAnyTr pops one of the first window items, picked at random, as part
+// of the caller's transaction. Poppers picking different items don't
+// conflict, so many can pop at once at the cost of order.
+func (queue *Queue) PopAnyTr(tr fdb.Transaction, window int) (value []byte, ok bool) {
+	kvs := tr.Snapshot().GetRange(queue.queueItem, fdb.RangeOptions{Limit: window}).GetSliceOrPanic()
+	if len(kvs) == 0 {
+		return
+	}
+	kv := kvs[mathrand.Intn(len(kvs))]
+	// only the picked item is read for real
+	tr.Get(kv.Key)
+	tr.Clear(kv.Key)
+	return decodeValue(kv.Value), true
+}
+
 // pushAt inserts item in the queue at (index, randomId) position. Items
 // pushed at the same time will have the same index, and so their ordering
 // will be random
 // This makes pushes fast and usually conflict free (unless the queue becomes)
 // empty during the push
 func (queue *Queue) pushAt(tr fdb.Transaction, value []byte, index int64) {
-	key := queue.queueItem.Pack(tuple.Tuple{index, nextRandom()})
-	val := encodeValue(value)
-
-	tr.Set(fdb.Key(key), val)
+	subspaces.NewTx(tr, queue.queueItem).Set(tuple.Tuple{index, nextRandom()}, encodeValue(value))
 }
 
 // popSimple gets the message without trying to avoid conflicts
-// if many clients are trying to pop simultaneously, only one will be able to
-// succeed at a time.
 func (queue *Queue) popSimple(tr fdb.Transaction) (value []byte, ok bool) {
-	if kv, ok := queue.getFirstItem(tr); ok {
-		tr.Clear(kv.Key)
-		return kv.Value, true
-	}
-
-	return
+	return pops.PopSimple(tr, queue.getItems)
 }
 
-func (queue *Queue) addConflictedPop(tr fdb.Transaction, forced bool) (val []byte) {
-	index := queue.GetNextIndex(tr.Snapshot(), queue.conflictedPop)
-
-	if (index == 0) && (!forced) {
-		return nil
-	}
-	key := queue.conflictedPop.Pack(tuple.Tuple{index, nextRandom()})
-	// why do we read no
-	_ = tr.Get(fdb.Key(key))
-	tr.Set(fdb.Key(key), []byte(""))
-	return key
+func (queue *Queue) getItems(tr fdb.Transaction, limit int) []fdb.KeyValue {
+	return subspaces.NewTx(tr, queue.queueItem).GetRange(nil, fdb.RangeOptions{Limit: limit}).GetSliceOrPanic()
 }
 
-func errIsCommitFailure(e error) bool {
-	if nil != e {
-		if f, ok := e.(fdb.Error); ok {
-			if f.Code == 1020 {
-				return true
-			}
-		}
-	}
-	return false
-}
-
-// popHighContention attempts to avoid collisions by registering
-// itself in a semi-ordered set of poppers if it doesn't initially succeed.
-// It then enters a polling loop where it attempts to fulfill outstanding pops
-// and then checks to see if it has been fulfilled.
-func (queue *Queue) popHighContention(db fdb.Database) (value []byte, ok bool) {
-	//panic("Not implemented")
-	backoff := 0.01
-
-	tr, err := db.CreateTransaction()
-
-	if err != nil {
-		panic(err)
-	}
-
-	// Check if there are other people waiting to be popped. If so, we
-	// cannot pop before them.
-
-	waitKey := queue.addConflictedPop(tr, false)
-	if waitKey == nil {
-		value, ok := queue.popSimple(tr)
-
-		// if we managed to commit without collisions
-
-		if err := tr.Commit().GetWithError(); err == nil {
-			return value, ok
-		} else {
-			if !errIsCommitFailure(err) {
-				panic(err)
-			}
-		}
-
-	}
-
-	if err := tr.Commit().GetWithError(); err != nil {
-		fmt.Println("Panic in #", err)
-	}
-
-	if waitKey == nil {
-		waitKey = queue.addConflictedPop(tr, true)
-	}
+func nextRandom() []byte {
+	b := make([]byte, 20)
+	if _, err := rand.Read(b); err == nil {
+		return b
+	} else {
 
-	t, err := queue.conflictedPop.Unpack(fdb.Key(waitKey))
-	if err != nil {
 		panic(err)
 	}
-
-	randId := t[1].([]byte)
-	// The result of the pop will be stored at this key once it has been fulfilled
-	resultKey := queue.conflictedItemKey(randId)
-
-	tr.Reset()
-
-	for {
-		for done := queue.fulfilConflictedPops(db); !done; {
-
-		}
-
-		tr.Reset()
-		value := tr.Get(fdb.Key(waitKey))
-		result := tr.Get(fdb.Key(resultKey))
-
-		// If waitKey is present, then we have not been fulfilled
-		if value.IsReady() {
-			time.Sleep(time.Duration(backoff) * time.Second)
-			backoff = backoff * 2
-			if backoff > 1 {
-				backoff = 1
-			}
-			continue
-		}
-		if !result.IsReady() {
-			return nil, false
-		}
-		tr.Clear(fdb.Key(resultKey))
-		tr.Commit().BlockUntilReady()
-
-		return result.GetOrPanic(), true
-
-	}
-
-	return nil, false
 }
 
-func (queue *Queue) getWaitingPops(tr fdb.Transaction, numPops int) fdb.RangeResult {
-	return tr.GetRange(queue.conflictedPop, fdb.RangeOptions{Limit: numPops})
+// Stats is the size of a queue, see Queue.Stats
+type Stats struct {
+	Items       int64
+	ApproxBytes int64 // size of the items, extrapolated from samples
 }
 
-func (queue *Queue) getItems(tr fdb.Transaction, numPops int) fdb.RangeResult {
-	return tr.GetRange(queue.queueItem, fdb.RangeOptions{Limit: numPops})
-}
-
-func minLength(a, b []fdb.KeyValue) int {
-	if al, bl := len(a), len(b); al < bl {
-		return al
-	} else {
-		return bl
-	}
-
-}
-
-func (queue *Queue) conflictedItemKey(subkey []byte) []byte {
-	return queue.conflictedItem.Pack(tuple.Tuple{subkey})
-}
-
-func (queue *Queue) fulfilConflictedPops(db fdb.Database) bool {
-	numPops := 100
-
-	v, err := db.Transact(func(tr fdb.Transaction) (interface{}, error) {
-		pops := queue.getWaitingPops(tr, numPops).GetSliceOrPanic()
-		items := queue.getItems(tr, numPops).GetSliceOrPanic()
-
-		min := minLength(pops, items)
-
-		for i := 0; i < min; i++ {
-			pop, k, v := pops[i], items[i].Key, items[i].Value
-
-			tuple, err := queue.conflictedPop.Unpack(pop.Key)
-			if err != nil {
-				panic(err)
-			}
-
-			storageKey := queue.conflictedItemKey(tuple[1].([]byte))
-			tr.Set(fdb.Key(storageKey), v)
-			_ = tr.Get(k)
-			_ = tr.Get(pop.Key)
-			tr.Clear(pop.Key)
-			tr.Clear(k)
-		}
-
-		for _, pop := range pops[min:] {
-			_ = tr.Get(pop.Key)
-			tr.Clear(pop.Key)
-		}
-
-		return len(pops) < numPops, nil
-
-	})
-
+// Stats counts the items of the queue and estimates their size, at
+// snapshot isolation and without reading every item
+func (queue *Queue) Stats(tr fdb.ReadTransaction) (Stats, error) {
+	items, err := subspaces.EstimateCount(tr, queue.queueItem)
 	if err != nil {
-		panic(err)
+		return Stats{}, err
 	}
-
-	return v.(bool)
-}
-
-func nextRandom() []byte {
-	b := make([]byte, 20)
-	if _, err := rand.Read(b); err == nil {
-		return b
-	} else {
-
-		panic(err)
+	size, err := subspaces.EstimateSize(tr, queue.queueItem)
+	if err != nil {
+		return Stats{}, err
 	}
+	return Stats{Items: items, ApproxBytes: size}, nil
 }
 
 // Empty returns true is queue does not have any messages
@@ -0,0 +1,119 @@
+package queue
+
+import (
+	"github.com/FoundationDB/fdb-go/fdb"
+	"github.com/abdullin/go-layers/internal/fdbtest"
+	"strconv"
+	"sync"
+	"testing"
+)
+
+func TestStats(t *testing.T) {
+	db, sub := fdbtest.Open(t)
+	q := New(sub, false)
+
+	const n = 100
+	value := make([]byte, 50)
+	_, err := db.Transact(func(tr fdb.Transaction) (interface{}, error) {
+		for i := 0; i < n; i++ {
+			q.Push(tr, value)
+		}
+		return nil, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := q.Pop(db); !ok {
+		t.Fatal("nothing popped")
+	}
+
+	v, err := db.Transact(func(tr fdb.Transaction) (interface{}, error) {
+		return q.Stats(tr)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	stats := v.(Stats)
+	if stats.Items != n-1 || stats.ApproxBytes < (n-1)*int64(len(value)) {
+		t.Fatalf("stats %+v of %d items", stats, n-1)
+	}
+}
+
+var modes = map[string]bool{"simple": false, "high contention": true}
+
+func TestOrder(t *testing.T) {
+	for name, hc := range modes {
+		t.Run(name, func(t *testing.T) {
+			db, sub := fdbtest.Open(t)
+			q := New(sub, hc)
+
+			for i := 0; i < 20; i++ {
+				_, err := db.Transact(func(tr fdb.Transaction) (interface{}, error) {
+					q.Push(tr, []byte{byte(i)})
+					return nil, nil
+				})
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+			for i := 0; i < 20; i++ {
+				if value, ok := q.Pop(db); !ok || len(value) != 1 || value[0] != byte(i) {
+					t.Fatalf("pop %d returned %v, %v", i, value, ok)
+				}
+			}
+			if value, ok := q.Pop(db); ok {
+				t.Fatalf("popped %v from an empty queue", value)
+			}
+		})
+	}
+}
+
+func TestPopConcurrent(t *testing.T) {
+	for name, hc := range modes {
+		t.Run(name, func(t *testing.T) {
+			db, sub := fdbtest.Open(t)
+			q := New(sub, hc)
+
+			const items, poppers = 200, 10
+			_, err := db.Transact(func(tr fdb.Transaction) (interface{}, error) {
+				for i := 0; i < items; i++ {
+					q.Push(tr, []byte(strconv.Itoa(i)))
+				}
+				return nil, nil
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			popped := make([][]string, poppers)
+			var wg sync.WaitGroup
+			for p := 0; p < poppers; p++ {
+				wg.Add(1)
+				go func(p int) {
+					defer wg.Done()
+					for {
+						value, ok := q.Pop(db)
+						if !ok {
+							return
+						}
+						popped[p] = append(popped[p], string(value))
+					}
+				}(p)
+			}
+			wg.Wait()
+
+			seen := map[string]bool{}
+			for _, values := range popped {
+				for _, v := range values {
+					if seen[v] {
+						t.Fatalf("%s popped twice", v)
+					}
+					seen[v] = true
+				}
+			}
+			if len(seen) != items {
+				t.Fatalf("popped %d of %d items", len(seen), items)
+			}
+		})
+	}
+}
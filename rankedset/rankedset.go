@@ -0,0 +1,286 @@
+/*
+Package rankedset provides a ranked set class. It is a part of FoundationDb
+layer.
+
+A ranked set keeps byte string members in order and finds the rank of a
+member, or the member at a rank, in a few reads whatever the size of the
+set. Members are stored as a skip list over several levels of keys:
+
+	(level, member) -> count (8 bytes, little endian)
+
+Level 0 holds every member, and each higher level about one in 16 of the
+members of the level below. The count of an entry is the number of members
+from it up to the next entry of its level, so counting skips over whole
+runs of members. Every level starts with a head entry at the bare prefix
+of the level, counting the members before the first entry.
+
+This code is a port from official python layer
+*/
+
+package rankedset
+
+import (
+	"bytes"
+	"encoding/binary"
+	"github.com/FoundationDB/fdb-go/fdb"
+	"github.com/FoundationDB/fdb-go/fdb/subspace"
+	"github.com/FoundationDB/fdb-go/fdb/tuple"
+	"hash/fnv"
+)
+
+const maxLevels = 6
+
+// levelFanPow is the log2 of the fan out between levels
+const levelFanPow = 4
+
+type RankedSet struct {
+	Subspace subspace.Subspace
+}
+
+// New ranked set is created within a given subspace
+func New(sub subspace.Subspace) RankedSet {
+	return RankedSet{sub}
+}
+
+func encodeCount(n int64) []byte {
+	b := make([]byte, 8)
+	binary.LittleEndian.PutUint64(b, uint64(n))
+	return b
+}
+
+func decodeCount(b []byte) int64 {
+	if len(b) != 8 {
+		return 0
+	}
+	return int64(binary.LittleEndian.Uint64(b))
+}
+
+// height returns the highest level the member is stored in. It depends on
+// the member only, so every transaction agrees on it.
+func height(member []byte) int {
+	h := fnv.New32a()
+	h.Write(member)
+	sum := h.Sum32()
+
+	level := 0
+	for level+1 < maxLevels && sum&(1<<uint((level+1)*levelFanPow)-1) == 0 {
+		level++
+	}
+	return level
+}
+
+func (rs *RankedSet) level(level int) subspace.Subspace {
+	return rs.Subspace.Sub(level)
+}
+
+// nodeKey returns the key of an entry of the level, nil being the head
+func (rs *RankedSet) nodeKey(level int, node []byte) fdb.Key {
+	if node == nil {
+		return rs.level(level).FDBKey()
+	}
+	return rs.level(level).Pack(tuple.Tuple{node})
+}
+
+// node returns the member of an entry of the level, nil for the head
+func (rs *RankedSet) node(level int, key fdb.Key) []byte {
+	sub := rs.level(level)
+	if bytes.Equal(key, sub.FDBKey()) {
+		return nil
+	}
+	if t, err := sub.Unpack(key); err != nil {
+		panic(err)
+	} else if member, _ := t[0].([]byte); member != nil {
+		return member
+	}
+	return []byte{}
+}
+
+// member keeps nil, which stands for the head, away from members
+func member(key []byte) []byte {
+	if key == nil {
+		return []byte{}
+	}
+	return key
+}
+
+func (rs *RankedSet) setupLevels(tr fdb.Transaction) {
+	for level := 0; level < maxLevels; level++ {
+		head := rs.nodeKey(level, nil)
+		// the snapshot read keeps inserts from conflicting on the heads
+		if tr.Snapshot().Get(head).GetOrPanic() == nil && tr.Get(head).GetOrPanic() == nil {
+			tr.Set(head, encodeCount(0))
+		}
+	}
+}
+
+// previous returns the entry of the level right before the key. Nothing
+// may be inserted in between before the transaction commits, and the entry
+// itself may not be removed; the head never is, so concurrent updates of
+// its count don't conflict.
+func (rs *RankedSet) previous(tr fdb.Transaction, level int, key fdb.Key) fdb.Key {
+	prev := tr.Snapshot().GetKey(fdb.LastLessThan(key)).GetOrPanic()
+	begin := prev
+	if rs.node(level, prev) == nil {
+		begin = fdb.Key(append(append([]byte{}, prev...), 0x00))
+	}
+	tr.AddReadConflictRange(fdb.KeyRange{Begin: begin, End: key})
+	return prev
+}
+
+// countRange sums the counts of the entries of the level from the node up
+// to the member
+func (rs *RankedSet) countRange(tr fdb.Transaction, level int, node, member []byte) int64 {
+	r := fdb.KeyRange{Begin: rs.nodeKey(level, node), End: rs.nodeKey(level, member)}
+	count := int64(0)
+	for _, kv := range tr.GetRange(r, fdb.RangeOptions{}).GetSliceOrPanic() {
+		count += decodeCount(kv.Value)
+	}
+	return count
+}
+
+// Contains returns whether the key is a member of the set
+func (rs *RankedSet) Contains(tr fdb.Transaction, key []byte) bool {
+	return tr.Get(rs.nodeKey(0, member(key))).GetOrPanic() != nil
+}
+
+// Insert adds the key to the set, if it isn't a member yet
+func (rs *RankedSet) Insert(tr fdb.Transaction, key []byte) {
+	key = member(key)
+	if rs.Contains(tr, key) {
+		return
+	}
+	rs.setupLevels(tr)
+
+	top := height(key)
+	for level := 0; level < maxLevels; level++ {
+		k := rs.nodeKey(level, key)
+		prev := rs.previous(tr, level, k)
+		switch {
+		case level > top:
+			tr.Add(prev, encodeCount(1))
+		case level == 0:
+			tr.Set(k, encodeCount(1))
+		default:
+			// the key splits the run of the previous entry in two
+			count := decodeCount(tr.Get(prev).GetOrPanic())
+			before := rs.countRange(tr, level-1, rs.node(level, prev), key)
+			tr.Set(prev, encodeCount(before))
+			tr.Set(k, encodeCount(count-before+1))
+		}
+	}
+}
+
+// Remove removes the key from the set, if it is a member
+func (rs *RankedSet) Remove(tr fdb.Transaction, key []byte) {
+	key = member(key)
+	if !rs.Contains(tr, key) {
+		return
+	}
+
+	top := height(key)
+	for level := 0; level < maxLevels; level++ {
+		k := rs.nodeKey(level, key)
+		prev := rs.previous(tr, level, k)
+		if level > top {
+			tr.Add(prev, encodeCount(-1))
+			continue
+		}
+		// the previous entry takes over the run of the key
+		if count := decodeCount(tr.Get(k).GetOrPanic()); count != 1 {
+			tr.Add(prev, encodeCount(count-1))
+		}
+		tr.Clear(k)
+	}
+}
+
+// Size returns the number of members, the sum of the counts of the top
+// level with its head
+func (rs *RankedSet) Size(tr fdb.Transaction) int64 {
+	top := maxLevels - 1
+	_, end := rs.level(top).FDBRangeKeys()
+	r := fdb.KeyRange{Begin: rs.nodeKey(top, nil), End: end}
+	size := int64(0)
+	for _, kv := range tr.GetRange(r, fdb.RangeOptions{}).GetSliceOrPanic() {
+		size += decodeCount(kv.Value)
+	}
+	return size
+}
+
+// Rank returns the number of members before the key, and whether the key
+// is a member itself
+func (rs *RankedSet) Rank(tr fdb.Transaction, key []byte) (int64, bool) {
+	key = member(key)
+	rank := int64(0)
+	var node []byte
+	for level := maxLevels - 1; level >= 0; level-- {
+		r := fdb.KeyRange{Begin: rs.nodeKey(level, node), End: rs.nodeKey(level, key)}
+		kvs := tr.GetRange(r, fdb.RangeOptions{}).GetSliceOrPanic()
+		for i, kv := range kvs {
+			// the last entry before the key is counted on the level below
+			if level > 0 && i == len(kvs)-1 {
+				node = rs.node(level, kv.Key)
+				break
+			}
+			rank += decodeCount(kv.Value)
+		}
+	}
+	return rank, rs.Contains(tr, key)
+}
+
+// GetNth returns the member at the rank, counting from zero, and false if
+// the set is smaller
+func (rs *RankedSet) GetNth(tr fdb.Transaction, rank int64) ([]byte, bool) {
+	if rank < 0 {
+		return nil, false
+	}
+
+	// start is the rank of the node
+	start := int64(0)
+	var node []byte
+	for level := maxLevels - 1; level >= 0; level-- {
+		_, end := rs.level(level).FDBRangeKeys()
+		ri := tr.GetRange(fdb.KeyRange{Begin: rs.nodeKey(level, node), End: end}, fdb.RangeOptions{}).Iterator()
+		found := false
+		for ri.Advance() {
+			kv := ri.GetNextOrPanic()
+			count := decodeCount(kv.Value)
+			if rank < start+count {
+				node = rs.node(level, kv.Key)
+				found = true
+				break
+			}
+			start += count
+		}
+		if !found {
+			return nil, false
+		}
+	}
+	return node, true
+}
+
+// GetRange returns the members with ranks from begin up to end
+func (rs *RankedSet) GetRange(tr fdb.Transaction, begin, end int64) [][]byte {
+	if begin < 0 {
+		begin = 0
+	}
+	if end <= begin {
+		return nil
+	}
+	first, ok := rs.GetNth(tr, begin)
+	if !ok {
+		return nil
+	}
+
+	_, last := rs.level(0).FDBRangeKeys()
+	r := fdb.KeyRange{Begin: rs.nodeKey(0, first), End: last}
+	var members [][]byte
+	for _, kv := range tr.GetRange(r, fdb.RangeOptions{Limit: int(end - begin)}).GetSliceOrPanic() {
+		members = append(members, rs.node(0, kv.Key))
+	}
+	return members
+}
+
+// Clear removes all members
+func (rs *RankedSet) Clear(tr fdb.Transaction) {
+	tr.ClearRange(rs.Subspace)
+}
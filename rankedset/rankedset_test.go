@@ -0,0 +1,151 @@
+package rankedset
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/FoundationDB/fdb-go/fdb"
+	"github.com/abdullin/go-layers/internal/fdbtest"
+	"math/rand"
+	"sort"
+	"sync"
+	"testing"
+)
+
+// check compares the set with the sorted members it should hold
+func check(t *testing.T, db fdb.Database, rs RankedSet, members [][]byte) {
+	_, err := db.Transact(func(tr fdb.Transaction) (interface{}, error) {
+		if size := rs.Size(tr); size != int64(len(members)) {
+			t.Errorf("size %d, want %d", size, len(members))
+		}
+		// every level counts every member
+		for level := 0; level < maxLevels; level++ {
+			_, end := rs.level(level).FDBRangeKeys()
+			sum := int64(0)
+			for _, kv := range tr.GetRange(fdb.KeyRange{Begin: rs.nodeKey(level, nil), End: end}, fdb.RangeOptions{}).GetSliceOrPanic() {
+				sum += decodeCount(kv.Value)
+			}
+			if sum != int64(len(members)) {
+				t.Errorf("level %d counts %d members, want %d", level, sum, len(members))
+			}
+		}
+		for i, m := range members {
+			if rank, ok := rs.Rank(tr, m); !ok || rank != int64(i) {
+				t.Errorf("rank of %q is %d, %v, want %d", m, rank, ok, i)
+			}
+			if nth, ok := rs.GetNth(tr, int64(i)); !ok || !bytes.Equal(nth, m) {
+				t.Errorf("member %d is %q, %v, want %q", i, nth, ok, m)
+			}
+		}
+		if _, ok := rs.GetNth(tr, int64(len(members))); ok {
+			t.Errorf("found a member past the end")
+		}
+		if r := rs.GetRange(tr, 1, 4); len(members) > 4 && (len(r) != 3 || !bytes.Equal(r[0], members[1])) {
+			t.Errorf("range 1 to 4 is %q", r)
+		}
+		return nil, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func sorted(set map[string]bool) [][]byte {
+	var members [][]byte
+	for m := range set {
+		members = append(members, []byte(m))
+	}
+	sort.Slice(members, func(i, j int) bool { return bytes.Compare(members[i], members[j]) < 0 })
+	return members
+}
+
+func TestRankedSet(t *testing.T) {
+	db, sub := fdbtest.Open(t)
+	rs := New(sub)
+
+	set := map[string]bool{}
+	rnd := rand.New(rand.NewSource(1))
+	for i := 0; i < 20; i++ {
+		// decided outside of the transaction, which may run again
+		inserts, removes := map[string]bool{}, map[string]bool{}
+		for j := 0; j < 50; j++ {
+			m := fmt.Sprintf("m%04d", rnd.Intn(500))
+			if set[m] && !inserts[m] && rnd.Intn(3) == 0 {
+				removes[m] = true
+			} else if !removes[m] {
+				inserts[m] = true
+			}
+		}
+		_, err := db.Transact(func(tr fdb.Transaction) (interface{}, error) {
+			for m := range removes {
+				rs.Remove(tr, []byte(m))
+			}
+			for m := range inserts {
+				rs.Insert(tr, []byte(m))
+			}
+			return nil, nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		for m := range removes {
+			delete(set, m)
+		}
+		for m := range inserts {
+			set[m] = true
+		}
+	}
+	check(t, db, rs, sorted(set))
+}
+
+func TestRankedSetConcurrent(t *testing.T) {
+	db, sub := fdbtest.Open(t)
+	rs := New(sub)
+
+	// workers insert members of their own and remove some of them
+	// again, interleaved with one another
+	const workers, ops = 8, 100
+	sets := make([]map[string]bool, workers)
+	errs := make([]error, workers)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		sets[w] = map[string]bool{}
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			rnd := rand.New(rand.NewSource(int64(w)))
+			for i := 0; i < ops; i++ {
+				m := fmt.Sprintf("%03d-%d", rnd.Intn(200), w)
+				remove := sets[w][m] && rnd.Intn(2) == 0
+				_, err := db.Transact(func(tr fdb.Transaction) (interface{}, error) {
+					if remove {
+						rs.Remove(tr, []byte(m))
+					} else {
+						rs.Insert(tr, []byte(m))
+					}
+					return nil, nil
+				})
+				if err != nil {
+					errs[w] = err
+					return
+				}
+				if remove {
+					delete(sets[w], m)
+				} else {
+					sets[w][m] = true
+				}
+			}
+		}(w)
+	}
+	wg.Wait()
+
+	set := map[string]bool{}
+	for w := range sets {
+		if errs[w] != nil {
+			t.Fatal(errs[w])
+		}
+		for m := range sets[w] {
+			set[m] = true
+		}
+	}
+	check(t, db, rs, sorted(set))
+}
@@ -0,0 +1,128 @@
+/*
+Package ratelimit provides a token bucket rate limiter class. It is a part
+of FoundationDb layer.
+
+Tokens refill at a rate up to a burst, and every request takes tokens.
+The state of a bucket is one small key, updated in the transaction that
+takes the tokens:
+
+	("bucket", shard) -> (tokens, refilled at)
+
+A single bucket is exact, but every request conflicts on its key. With
+shards, the rate and burst are split evenly between buckets and every
+request goes to a random one, which spreads the conflicts. The total rate
+still holds, but a request may be refused by a drained shard while others
+have tokens, and no request can take more than the burst of one shard.
+Time comes from the clocks of the clients, so skew between them shifts
+refills by as much.
+*/
+
+package ratelimit
+
+import (
+	"errors"
+	"github.com/FoundationDB/fdb-go/fdb"
+	"github.com/FoundationDB/fdb-go/fdb/subspace"
+	"github.com/FoundationDB/fdb-go/fdb/tuple"
+	"math/rand"
+	"time"
+)
+
+// ErrExceedsBurst is returned for requests larger than the burst of a
+// bucket, which could never be allowed
+var ErrExceedsBurst = errors.New("request exceeds the burst of the limiter")
+
+type Limiter struct {
+	Subspace subspace.Subspace
+	Rate     float64 // tokens per second
+	Burst    float64
+	Shards   int
+	buckets  subspace.Subspace
+}
+
+// New limiter is created within a given subspace, with a single bucket
+func New(sub subspace.Subspace, rate float64, burst int) Limiter {
+	return Limiter{sub, rate, float64(burst), 1, sub.Sub("bucket")}
+}
+
+type bucket struct {
+	key    fdb.Key
+	rate   float64
+	burst  float64
+	tokens float64
+	now    int64
+}
+
+// bucket reads a random shard and refills it up to now
+func (l *Limiter) bucket(tr fdb.Transaction, now time.Time) bucket {
+	shards := l.Shards
+	if shards < 1 {
+		shards = 1
+	}
+	b := bucket{
+		key:   l.buckets.Pack(tuple.Tuple{int64(rand.Intn(shards))}),
+		rate:  l.Rate / float64(shards),
+		burst: l.Burst / float64(shards),
+		now:   now.UnixNano(),
+	}
+
+	b.tokens = b.burst
+	if val := tr.Get(b.key).GetOrPanic(); val != nil {
+		t, err := tuple.Unpack(val)
+		if err != nil {
+			panic(err)
+		}
+		elapsed := time.Duration(b.now - t[1].(int64)).Seconds()
+		if elapsed < 0 {
+			elapsed = 0
+		}
+		if b.tokens = t[0].(float64) + elapsed*b.rate; b.tokens > b.burst {
+			b.tokens = b.burst
+		}
+	}
+	return b
+}
+
+func (b *bucket) take(tr fdb.Transaction, n float64) {
+	b.tokens -= n
+	tr.Set(b.key, tuple.Tuple{b.tokens, b.now}.Pack())
+}
+
+// Allow takes n tokens if there are enough, returning false otherwise
+func (l *Limiter) Allow(db fdb.Database, n int) (bool, error) {
+	v, err := db.Transact(func(tr fdb.Transaction) (interface{}, error) {
+		b := l.bucket(tr, time.Now())
+		if float64(n) > b.burst {
+			return nil, ErrExceedsBurst
+		}
+		if b.tokens < float64(n) {
+			return false, nil
+		}
+		b.take(tr, float64(n))
+		return true, nil
+	})
+	if err != nil {
+		return false, err
+	}
+	return v.(bool), nil
+}
+
+// Reserve takes n tokens whether or not there are enough, returning how
+// long to wait before acting as if they had been there
+func (l *Limiter) Reserve(db fdb.Database, n int) (time.Duration, error) {
+	v, err := db.Transact(func(tr fdb.Transaction) (interface{}, error) {
+		b := l.bucket(tr, time.Now())
+		if float64(n) > b.burst {
+			return nil, ErrExceedsBurst
+		}
+		b.take(tr, float64(n))
+		if b.tokens >= 0 {
+			return time.Duration(0), nil
+		}
+		return time.Duration(-b.tokens / b.rate * float64(time.Second)), nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return v.(time.Duration), nil
+}
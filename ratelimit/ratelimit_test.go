@@ -0,0 +1,72 @@
+package ratelimit
+
+import (
+	"github.com/FoundationDB/fdb-go/fdb"
+	"github.com/abdullin/go-layers/internal/fdbtest"
+	"sync"
+	"testing"
+	"time"
+)
+
+// allowed runs requests of one token concurrently and counts the allowed
+func allowed(t *testing.T, db fdb.Database, l *Limiter, requests int) int {
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	count := 0
+	for i := 0; i < requests; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ok, err := l.Allow(db, 1)
+			if err != nil {
+				t.Error(err)
+			}
+			if ok {
+				mu.Lock()
+				count++
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	return count
+}
+
+func TestAllow(t *testing.T) {
+	// slow enough not to refill during the test
+	const rate, burst = 0.001, 20
+
+	db, sub := fdbtest.Open(t)
+	for _, shards := range []int{1, 4} {
+		l := New(sub.Sub(shards), rate, burst)
+		l.Shards = shards
+
+		// with enough requests every shard is drained
+		if n := allowed(t, db, &l, 100); n != burst {
+			t.Fatalf("%d shards allowed %d requests, want %d", shards, n, burst)
+		}
+		if _, err := l.Allow(db, burst/shards+1); err != ErrExceedsBurst {
+			t.Fatalf("%d shards allowed more than a burst with %v", shards, err)
+		}
+	}
+}
+
+func TestReserve(t *testing.T) {
+	db, sub := fdbtest.Open(t)
+	l := New(sub, 10, 10)
+
+	if wait, err := l.Reserve(db, 10); err != nil || wait != 0 {
+		t.Fatalf("reserved the burst with a wait of %v, %v", wait, err)
+	}
+	// five more tokens take half a second to refill
+	wait, err := l.Reserve(db, 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if wait < 400*time.Millisecond || wait > 500*time.Millisecond {
+		t.Fatalf("reserved with a wait of %v", wait)
+	}
+	if ok, err := l.Allow(db, 1); err != nil || ok {
+		t.Fatalf("allowed while in debt: %v, %v", ok, err)
+	}
+}
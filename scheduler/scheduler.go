@@ -0,0 +1,244 @@
+/*
+Package scheduler provides a delayed task class. It is a part of
+FoundationDb layer.
+
+Tasks are kept by due time until a runner claims them, which moves them to
+the in-flight tasks with a lease. A task is done once its handler
+succeeds; if the handler fails it is scheduled again with a backoff, and
+if the lease expires first, e.g. because the runner died, any runner
+claims it again:
+
+	("due", due, id)      -> (payload, attempts)
+	("flight", lease, id) -> (payload, attempts)
+	("task", id)          -> ("due" or "flight", due or lease)
+
+Claims read and clear the due tasks they take, so concurrent runners never
+claim a task twice. A runner claims a few tasks at once and renews the
+lease of each right before its handler runs. A task runs again only after
+its lease expires, so the lease should be well above the time the handler
+takes.
+*/
+
+package scheduler
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"github.com/FoundationDB/fdb-go/fdb"
+	"github.com/FoundationDB/fdb-go/fdb/subspace"
+	"github.com/FoundationDB/fdb-go/fdb/tuple"
+	"time"
+)
+
+const (
+	DefaultLease        = time.Minute
+	DefaultPollInterval = time.Second
+	DefaultMaxBackoff   = 10 * time.Minute
+)
+
+// claimBatch is the number of tasks claimed per transaction. They run one
+// after another, each under a lease renewed when its turn comes.
+const claimBatch = 10
+
+// TaskID identifies a scheduled task
+type TaskID string
+
+// Task is a claimed task handed to the handler
+type Task struct {
+	ID       TaskID
+	Payload  []byte
+	Attempts int64 // number of failed runs before this one
+}
+
+type Scheduler struct {
+	Subspace     subspace.Subspace
+	Lease        time.Duration
+	PollInterval time.Duration
+	MaxBackoff   time.Duration
+	due          subspace.Subspace
+	flight       subspace.Subspace
+	tasks        subspace.Subspace
+}
+
+// New scheduler is created within a given subspace
+func New(sub subspace.Subspace) Scheduler {
+	return Scheduler{sub, DefaultLease, DefaultPollInterval, DefaultMaxBackoff, sub.Sub("due"), sub.Sub("flight"), sub.Sub("task")}
+}
+
+func (s *Scheduler) taskKey(id TaskID) fdb.Key {
+	return s.tasks.Pack(tuple.Tuple{string(id)})
+}
+
+// Schedule stores a task due at the time
+func (s *Scheduler) Schedule(tr fdb.Transaction, at time.Time, payload []byte) (TaskID, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	id := TaskID(hex.EncodeToString(b))
+	s.enqueue(tr, id, at.UnixNano(), payload, 0)
+	return id, nil
+}
+
+func (s *Scheduler) enqueue(tr fdb.Transaction, id TaskID, due int64, payload []byte, attempts int64) {
+	tr.Set(s.due.Pack(tuple.Tuple{due, string(id)}), tuple.Tuple{payload, attempts}.Pack())
+	tr.Set(s.taskKey(id), tuple.Tuple{"due", due}.Pack())
+}
+
+// Cancel removes a task, whether due or in flight, and returns false if
+// there is none. A handler already running for it is not stopped, but its
+// result is ignored.
+func (s *Scheduler) Cancel(tr fdb.Transaction, id TaskID) bool {
+	val := tr.Get(s.taskKey(id)).GetOrPanic()
+	if val == nil {
+		return false
+	}
+	t, err := tuple.Unpack(val)
+	if err != nil {
+		panic(err)
+	}
+	if t[0].(string) == "due" {
+		tr.Clear(s.due.Pack(tuple.Tuple{t[1], string(id)}))
+	} else {
+		tr.Clear(s.flight.Pack(tuple.Tuple{t[1], string(id)}))
+	}
+	tr.Clear(s.taskKey(id))
+	return true
+}
+
+// RunDue claims due tasks and passes them to the handler until the
+// context is done. A task the handler fails is scheduled again after a
+// backoff doubling with every attempt.
+func (s *Scheduler) RunDue(ctx context.Context, db fdb.Database, handler func(context.Context, Task) error) error {
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		v, err := db.Transact(func(tr fdb.Transaction) (interface{}, error) {
+			return s.claim(tr, time.Now())
+		})
+		if err != nil {
+			return err
+		}
+		claimed := v.([]claim)
+
+		if len(claimed) == 0 {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(s.PollInterval):
+			}
+			continue
+		}
+
+		for i, c := range claimed {
+			// the handlers before this one took some of its lease
+			if i > 0 {
+				v, err := db.Transact(func(tr fdb.Transaction) (interface{}, error) {
+					return s.renew(tr, c, time.Now()), nil
+				})
+				if err != nil {
+					return err
+				}
+				if c.lease = v.(int64); c.lease == 0 {
+					continue
+				}
+			}
+
+			failed := handler(ctx, c.task) != nil
+			if _, err := db.Transact(func(tr fdb.Transaction) (interface{}, error) {
+				s.complete(tr, c, failed)
+				return nil, nil
+			}); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// claim is a task taken under a lease
+type claim struct {
+	task  Task
+	lease int64
+}
+
+// claim takes due tasks, first putting back the ones with expired leases
+func (s *Scheduler) claim(tr fdb.Transaction, now time.Time) ([]claim, error) {
+	expired := fdb.KeyRange{Begin: s.flight.FDBKey(), End: s.flight.Pack(tuple.Tuple{now.UnixNano()})}
+	for _, kv := range tr.GetRange(expired, fdb.RangeOptions{Limit: claimBatch}).GetSliceOrPanic() {
+		key, val, err := s.unpackTask(s.flight, kv)
+		if err != nil {
+			return nil, err
+		}
+		tr.Clear(kv.Key)
+		s.enqueue(tr, TaskID(key[1].(string)), now.UnixNano(), val[0].([]byte), val[1].(int64))
+	}
+
+	lease := now.Add(s.Lease).UnixNano()
+	due := fdb.KeyRange{Begin: s.due.FDBKey(), End: s.due.Pack(tuple.Tuple{now.UnixNano() + 1})}
+	var claimed []claim
+	for _, kv := range tr.GetRange(due, fdb.RangeOptions{Limit: claimBatch}).GetSliceOrPanic() {
+		key, val, err := s.unpackTask(s.due, kv)
+		if err != nil {
+			return nil, err
+		}
+		id := TaskID(key[1].(string))
+		tr.Clear(kv.Key)
+		tr.Set(s.flight.Pack(tuple.Tuple{lease, string(id)}), kv.Value)
+		tr.Set(s.taskKey(id), tuple.Tuple{"flight", lease}.Pack())
+		claimed = append(claimed, claim{Task{id, val[0].([]byte), val[1].(int64)}, lease})
+	}
+	return claimed, nil
+}
+
+// renew takes a new lease on a claimed task, from now. Returns the lease,
+// or zero if the task was cancelled or claimed again since.
+func (s *Scheduler) renew(tr fdb.Transaction, c claim, now time.Time) int64 {
+	key := s.flight.Pack(tuple.Tuple{c.lease, string(c.task.ID)})
+	val := tr.Get(key).GetOrPanic()
+	if val == nil {
+		return 0
+	}
+	lease := now.Add(s.Lease).UnixNano()
+	tr.Clear(key)
+	tr.Set(s.flight.Pack(tuple.Tuple{lease, string(c.task.ID)}), val)
+	tr.Set(s.taskKey(c.task.ID), tuple.Tuple{"flight", lease}.Pack())
+	return lease
+}
+
+func (s *Scheduler) unpackTask(sub subspace.Subspace, kv fdb.KeyValue) (tuple.Tuple, tuple.Tuple, error) {
+	key, err := sub.Unpack(kv.Key)
+	if err != nil {
+		return nil, nil, err
+	}
+	val, err := tuple.Unpack(kv.Value)
+	if err != nil {
+		return nil, nil, err
+	}
+	return key, val, nil
+}
+
+// complete removes a task run under the lease, or schedules it again if
+// it failed. Nothing happens if the task was cancelled or its lease
+// expired in the meantime.
+func (s *Scheduler) complete(tr fdb.Transaction, c claim, failed bool) {
+	key := s.flight.Pack(tuple.Tuple{c.lease, string(c.task.ID)})
+	if tr.Get(key).GetOrPanic() == nil {
+		return
+	}
+	tr.Clear(key)
+	if !failed {
+		tr.Clear(s.taskKey(c.task.ID))
+		return
+	}
+
+	backoff := s.MaxBackoff
+	if c.task.Attempts < 30 {
+		if d := time.Second << uint(c.task.Attempts); d < backoff {
+			backoff = d
+		}
+	}
+	s.enqueue(tr, c.task.ID, time.Now().Add(backoff).UnixNano(), c.task.Payload, c.task.Attempts+1)
+}
@@ -0,0 +1,64 @@
+package scheduler
+
+import (
+	"context"
+	"github.com/FoundationDB/fdb-go/fdb"
+	"github.com/abdullin/go-layers/internal/fdbtest"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestRunDueOnce(t *testing.T) {
+	db, sub := fdbtest.Open(t)
+	s := New(sub)
+	// each handler fits in the lease, a batch of them doesn't
+	s.Lease = 250 * time.Millisecond
+	s.PollInterval = 10 * time.Millisecond
+	const tasks, work = 4, 150 * time.Millisecond
+
+	_, err := db.Transact(func(tr fdb.Transaction) (interface{}, error) {
+		for i := 0; i < tasks; i++ {
+			if _, err := s.Schedule(tr, time.Now(), []byte{byte(i)}); err != nil {
+				return nil, err
+			}
+		}
+		return nil, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var mu sync.Mutex
+	runs := map[TaskID]int{}
+	handler := func(ctx context.Context, task Task) error {
+		mu.Lock()
+		runs[task.ID]++
+		mu.Unlock()
+		time.Sleep(work)
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), tasks*work+time.Second)
+	defer cancel()
+	var wg sync.WaitGroup
+	for r := 0; r < 2; r++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := s.RunDue(ctx, db, handler); err != context.DeadlineExceeded {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if len(runs) != tasks {
+		t.Fatalf("ran %d tasks, want %d", len(runs), tasks)
+	}
+	for id, n := range runs {
+		if n != 1 {
+			t.Errorf("task %s ran %d times", id, n)
+		}
+	}
+}
@@ -0,0 +1,194 @@
+/*
+Package semaphore provides a counting semaphore class. It is a part of
+FoundationDb layer.
+
+A semaphore hands out up to a limit of permits, each held by a holder
+until it is released or its lease expires. Every permit takes a slot of
+its own below the limit, and acquirers probe slots from a random one on,
+so acquires by different holders rarely conflict until the limit is near:
+
+	("limit")      -> limit
+	("slot", slot) -> (holder, token, expires)
+
+Expired permits are reclaimed by the acquires that come across them.
+Shrinking the limit keeps outstanding permits above it; no new permits
+are handed out until the outstanding ones are below the new limit.
+*/
+
+package semaphore
+
+import (
+	"bytes"
+	"crypto/rand"
+	"errors"
+	"github.com/FoundationDB/fdb-go/fdb"
+	"github.com/FoundationDB/fdb-go/fdb/subspace"
+	"github.com/FoundationDB/fdb-go/fdb/tuple"
+	mrand "math/rand"
+	"time"
+)
+
+// ErrLost is returned when releasing a permit that expired and was taken
+// by another holder
+var ErrLost = errors.New("semaphore permit lost")
+
+type Semaphore struct {
+	Subspace subspace.Subspace
+	slots    subspace.Subspace
+}
+
+// New semaphore is created within a given subspace. Until Resize sets its
+// limit it hands out no permits.
+func New(sub subspace.Subspace) Semaphore {
+	return Semaphore{sub, sub.Sub("slot")}
+}
+
+// Permit is a held permit
+type Permit struct {
+	Slot    int64
+	Holder  []byte
+	Expires time.Time
+	token   []byte
+	sem     *Semaphore
+}
+
+func (s *Semaphore) limitKey() fdb.Key {
+	return s.Subspace.Pack(tuple.Tuple{"limit"})
+}
+
+func (s *Semaphore) slotKey(slot int64) fdb.Key {
+	return s.slots.Pack(tuple.Tuple{slot})
+}
+
+func (s *Semaphore) limit(tr fdb.Transaction) int64 {
+	val := tr.Get(s.limitKey()).GetOrPanic()
+	if val == nil {
+		return 0
+	}
+	if t, err := tuple.Unpack(val); err != nil {
+		panic(err)
+	} else {
+		return t[0].(int64)
+	}
+}
+
+// live returns whether a slot value holds a permit that hasn't expired
+func live(val []byte, now time.Time) bool {
+	if val == nil {
+		return false
+	}
+	if t, err := tuple.Unpack(val); err != nil {
+		panic(err)
+	} else {
+		return t[2].(int64) > now.UnixNano()
+	}
+}
+
+// Resize sets the limit of permits
+func (s *Semaphore) Resize(db fdb.Database, n int64) error {
+	_, err := db.Transact(func(tr fdb.Transaction) (interface{}, error) {
+		tr.Set(s.limitKey(), tuple.Tuple{n}.Pack())
+		return nil, nil
+	})
+	return err
+}
+
+// TryAcquire takes a permit for the holder, valid for the ttl. Returns
+// false if all permits are held.
+func (s *Semaphore) TryAcquire(db fdb.Database, holder []byte, ttl time.Duration) (Permit, bool, error) {
+	token := make([]byte, 16)
+	if _, err := rand.Read(token); err != nil {
+		return Permit{}, false, err
+	}
+
+	v, err := db.Transact(func(tr fdb.Transaction) (interface{}, error) {
+		now := time.Now()
+		slot, ok := s.freeSlot(tr, now)
+		if !ok {
+			return nil, nil
+		}
+		expires := now.Add(ttl)
+		tr.Set(s.slotKey(slot), tuple.Tuple{holder, token, expires.UnixNano()}.Pack())
+		return Permit{slot, holder, expires, token, s}, nil
+	})
+	if err != nil || v == nil {
+		return Permit{}, false, err
+	}
+	return v.(Permit), true, nil
+}
+
+// freeSlot finds a slot below the limit without a live permit. Permits
+// left above a shrunk limit count against it, which takes reading all
+// slots while there are any.
+func (s *Semaphore) freeSlot(tr fdb.Transaction, now time.Time) (int64, bool) {
+	limit := s.limit(tr)
+	if limit <= 0 {
+		return 0, false
+	}
+
+	_, end := s.slots.FDBRangeKeys()
+	above := fdb.KeyRange{Begin: s.slotKey(limit), End: end}
+	overflow := int64(0)
+	for _, kv := range tr.GetRange(above, fdb.RangeOptions{}).GetSliceOrPanic() {
+		if live(kv.Value, now) {
+			overflow++
+		} else {
+			tr.Clear(kv.Key)
+		}
+	}
+
+	if overflow == 0 {
+		start := mrand.Int63n(limit)
+		for i := int64(0); i < limit; i++ {
+			slot := (start + i) % limit
+			if !live(tr.Get(s.slotKey(slot)).GetOrPanic(), now) {
+				return slot, true
+			}
+		}
+		return 0, false
+	}
+
+	held := overflow
+	below := fdb.KeyRange{Begin: s.slots.FDBKey(), End: s.slotKey(limit)}
+	taken := make(map[int64]bool)
+	for _, kv := range tr.GetRange(below, fdb.RangeOptions{}).GetSliceOrPanic() {
+		if !live(kv.Value, now) {
+			continue
+		}
+		t, err := s.slots.Unpack(kv.Key)
+		if err != nil {
+			panic(err)
+		}
+		taken[t[0].(int64)] = true
+		held++
+	}
+	if held >= limit {
+		return 0, false
+	}
+	slot := int64(0)
+	for taken[slot] {
+		slot++
+	}
+	return slot, true
+}
+
+// Release returns the permit
+func (p *Permit) Release(db fdb.Database) error {
+	_, err := db.Transact(func(tr fdb.Transaction) (interface{}, error) {
+		key := p.sem.slotKey(p.Slot)
+		val := tr.Get(key).GetOrPanic()
+		if val == nil {
+			return nil, ErrLost
+		}
+		t, err := tuple.Unpack(val)
+		if err != nil {
+			return nil, err
+		}
+		if !bytes.Equal(t[1].([]byte), p.token) {
+			return nil, ErrLost
+		}
+		tr.Clear(key)
+		return nil, nil
+	})
+	return err
+}
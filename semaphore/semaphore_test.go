@@ -0,0 +1,94 @@
+package semaphore
+
+import (
+	"fmt"
+	"github.com/abdullin/go-layers/internal/fdbtest"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestAcquireLimit(t *testing.T) {
+	db, sub := fdbtest.Open(t)
+	s := New(sub)
+
+	const n = 5
+	if err := s.Resize(db, n); err != nil {
+		t.Fatal(err)
+	}
+
+	// n+1 acquirers at once, only n get a permit
+	permits := make([]Permit, n+1)
+	oks := make([]bool, n+1)
+	errs := make([]error, n+1)
+	var wg sync.WaitGroup
+	for i := range permits {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			permits[i], oks[i], errs[i] = s.TryAcquire(db, []byte(fmt.Sprint(i)), time.Minute)
+		}(i)
+	}
+	wg.Wait()
+
+	var held []Permit
+	slots := map[int64]bool{}
+	for i := range permits {
+		if errs[i] != nil {
+			t.Fatal(errs[i])
+		}
+		if oks[i] {
+			if slots[permits[i].Slot] {
+				t.Fatalf("slot %d handed out twice", permits[i].Slot)
+			}
+			slots[permits[i].Slot] = true
+			held = append(held, permits[i])
+		}
+	}
+	if len(held) != n {
+		t.Fatalf("%d permits acquired, want %d", len(held), n)
+	}
+
+	// a released permit can be taken again, once
+	if err := held[0].Release(db); err != nil {
+		t.Fatal(err)
+	}
+	if err := held[0].Release(db); err != ErrLost {
+		t.Fatalf("released twice with %v", err)
+	}
+	if _, ok, err := s.TryAcquire(db, []byte("again"), time.Minute); err != nil || !ok {
+		t.Fatalf("acquired after a release: %v, %v", ok, err)
+	}
+	if _, ok, err := s.TryAcquire(db, []byte("full"), time.Minute); err != nil || ok {
+		t.Fatalf("acquired past the limit: %v, %v", ok, err)
+	}
+
+	// permits left above a shrunk limit count against it
+	if err := s.Resize(db, 2); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok, err := s.TryAcquire(db, []byte("shrunk"), time.Minute); err != nil || ok {
+		t.Fatalf("acquired above a shrunk limit: %v, %v", ok, err)
+	}
+}
+
+func TestAcquireExpired(t *testing.T) {
+	db, sub := fdbtest.Open(t)
+	s := New(sub)
+	if err := s.Resize(db, 1); err != nil {
+		t.Fatal(err)
+	}
+
+	p, ok, err := s.TryAcquire(db, []byte("a"), 50*time.Millisecond)
+	if err != nil || !ok {
+		t.Fatalf("acquired: %v, %v", ok, err)
+	}
+	time.Sleep(100 * time.Millisecond)
+
+	if _, ok, err := s.TryAcquire(db, []byte("b"), time.Minute); err != nil || !ok {
+		t.Fatalf("acquired an expired permit: %v, %v", ok, err)
+	}
+	if err := p.Release(db); err != ErrLost {
+		t.Fatalf("released a reclaimed permit with %v", err)
+	}
+}
@@ -0,0 +1,180 @@
+/*
+Package stringintern provides a string interning class. It is a part of
+FoundationDb layer.
+
+Interning maps strings that repeat in many keys or values to short
+unique tokens, and tokens back to the strings. Tokens are random, checked
+for collisions in the transaction that allocates them, and never change
+or get reused once committed, so they can be cached in process forever.
+
+This code is a port from official python layer
+*/
+
+package stringintern
+
+import (
+	"crypto/rand"
+	"errors"
+	"github.com/FoundationDB/fdb-go/fdb"
+	"github.com/FoundationDB/fdb-go/fdb/subspace"
+	"github.com/FoundationDB/fdb-go/fdb/tuple"
+	"sync"
+)
+
+// cacheLimit is the number of strings kept in the process cache
+const cacheLimit = 10000
+
+// tokenLength is the length in bytes of newly allocated tokens, grown when
+// random tokens keep colliding
+const tokenLength = 4
+
+var ErrUnknownToken = errors.New("unknown intern token")
+
+type StringIntern struct {
+	Subspace subspace.Subspace
+	tokens   subspace.Subspace // token -> string
+	strings  subspace.Subspace // string -> token
+
+	mu       sync.Mutex
+	toToken  map[string][]byte
+	toString map[string]string
+	pending  map[string]string // token -> string, allocated but not known to be committed
+}
+
+// New string intern is created within a given subspace
+func New(sub subspace.Subspace) *StringIntern {
+	return &StringIntern{
+		Subspace: sub,
+		tokens:   sub.Sub("M"),
+		strings:  sub.Sub("S"),
+		toToken:  map[string][]byte{},
+		toString: map[string]string{},
+		pending:  map[string]string{},
+	}
+}
+
+// Intern returns the token of the string, allocating one if the string is
+// new. A new token is only known to others once the transaction commits,
+// and only cached once Committed is called with it.
+func (si *StringIntern) Intern(tr fdb.Transaction, s string) ([]byte, error) {
+	if token, ok := si.cachedToken(s); ok {
+		return token, nil
+	}
+
+	if token, ok := si.Find(tr, s); ok {
+		return token, nil
+	}
+
+	// reads of the transaction see the new token before it commits, so
+	// it stays out of the cache until Committed is called with it
+	token, err := si.newToken(tr)
+	if err != nil {
+		return nil, err
+	}
+	si.mu.Lock()
+	si.pending[string(token)] = s
+	si.mu.Unlock()
+	tr.Set(si.tokens.Pack(tuple.Tuple{token}), []byte(s))
+	tr.Set(si.strings.Pack(tuple.Tuple{s}), token)
+	return token, nil
+}
+
+// Lookup returns the string of a token, failing with ErrUnknownToken for
+// tokens that were never allocated
+func (si *StringIntern) Lookup(tr fdb.Transaction, token []byte) (string, error) {
+	if s, ok := si.cachedString(token); ok {
+		return s, nil
+	}
+
+	val := tr.Get(si.tokens.Pack(tuple.Tuple{token})).GetOrPanic()
+	if val == nil {
+		return "", ErrUnknownToken
+	}
+	s := string(val)
+	si.remember(s, token)
+	return s, nil
+}
+
+// Find returns the token of the string without allocating one, false if
+// the string was never interned
+func (si *StringIntern) Find(tr fdb.Transaction, s string) ([]byte, bool) {
+	if token, ok := si.cachedToken(s); ok {
+		return token, true
+	}
+
+	token := tr.Get(si.strings.Pack(tuple.Tuple{s})).GetOrPanic()
+	if token == nil {
+		return nil, false
+	}
+	si.remember(s, token)
+	return token, true
+}
+
+// Committed caches a token allocated by Intern once its transaction has
+// committed. Tokens of transactions that failed are never cached.
+func (si *StringIntern) Committed(s string, token []byte) {
+	si.mu.Lock()
+	defer si.mu.Unlock()
+	if si.pending[string(token)] != s {
+		return
+	}
+	delete(si.pending, string(token))
+	si.put(s, token)
+}
+
+// remember caches a mapping read from the database. Reads see the
+// writes of their own transaction, so a token still pending may come from
+// an allocation that never commits and is left to Committed; any other
+// mapping was committed before it was read.
+func (si *StringIntern) remember(s string, token []byte) {
+	si.mu.Lock()
+	defer si.mu.Unlock()
+	if _, ok := si.pending[string(token)]; ok {
+		return
+	}
+	si.put(s, token)
+}
+
+// newToken picks a random token that is not in use, reading it within the
+// transaction so concurrent allocations of the same token conflict
+func (si *StringIntern) newToken(tr fdb.Transaction) ([]byte, error) {
+	for length := tokenLength; ; length++ {
+		for attempt := 0; attempt < 10; attempt++ {
+			token := make([]byte, length)
+			if _, err := rand.Read(token); err != nil {
+				return nil, err
+			}
+			if tr.Get(si.tokens.Pack(tuple.Tuple{token})).GetOrPanic() == nil {
+				return token, nil
+			}
+		}
+	}
+}
+
+func (si *StringIntern) cachedToken(s string) ([]byte, bool) {
+	si.mu.Lock()
+	defer si.mu.Unlock()
+	token, ok := si.toToken[s]
+	return token, ok
+}
+
+func (si *StringIntern) cachedString(token []byte) (string, bool) {
+	si.mu.Lock()
+	defer si.mu.Unlock()
+	s, ok := si.toString[string(token)]
+	return s, ok
+}
+
+// put caches a committed mapping, dropping an arbitrary one when the
+// cache is full. The caller holds mu.
+func (si *StringIntern) put(s string, token []byte) {
+	if len(si.toToken) >= cacheLimit {
+		for old, t := range si.toToken {
+			delete(si.toToken, old)
+			delete(si.toString, string(t))
+			break
+		}
+	}
+	si.toToken[s] = token
+	si.toString[string(token)] = s
+}
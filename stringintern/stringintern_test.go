@@ -0,0 +1,152 @@
+package stringintern
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"github.com/FoundationDB/fdb-go/fdb"
+	"github.com/abdullin/go-layers/internal/fdbtest"
+	"sync"
+	"testing"
+)
+
+func intern(db fdb.Database, si *StringIntern, s string) ([]byte, error) {
+	v, err := db.Transact(func(tr fdb.Transaction) (interface{}, error) {
+		return si.Intern(tr, s)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return v.([]byte), nil
+}
+
+func TestInternLookup(t *testing.T) {
+	db, sub := fdbtest.Open(t)
+	si := New(sub)
+
+	tokens := map[string][]byte{}
+	for i := 0; i < 100; i++ {
+		s := fmt.Sprintf("string-%d", i)
+		token, err := intern(db, si, s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		tokens[s] = token
+	}
+
+	// a fresh instance reads everything from the database
+	other := New(sub)
+	for s, token := range tokens {
+		again, err := intern(db, other, s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(again, token) {
+			t.Fatalf("%q interned as %x, then as %x", s, token, again)
+		}
+		v, err := db.Transact(func(tr fdb.Transaction) (interface{}, error) {
+			return other.Lookup(tr, token)
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if v.(string) != s {
+			t.Fatalf("%x looked up as %q, want %q", token, v, s)
+		}
+	}
+
+	_, err := db.Transact(func(tr fdb.Transaction) (interface{}, error) {
+		return other.Lookup(tr, []byte("never"))
+	})
+	if err != ErrUnknownToken {
+		t.Fatalf("unknown token looked up with %v", err)
+	}
+}
+
+func TestInternUncommitted(t *testing.T) {
+	db, sub := fdbtest.Open(t)
+	si := New(sub)
+
+	errAbort := errors.New("abort")
+	var token []byte
+	_, err := db.Transact(func(tr fdb.Transaction) (interface{}, error) {
+		var err error
+		if token, err = si.Intern(tr, "s"); err != nil {
+			return nil, err
+		}
+		// read back through the writes of the transaction
+		if _, err := si.Intern(tr, "s"); err != nil {
+			return nil, err
+		}
+		if _, err := si.Lookup(tr, token); err != nil {
+			return nil, err
+		}
+		return nil, errAbort
+	})
+	if err != errAbort {
+		t.Fatal(err)
+	}
+
+	if _, ok := si.cachedToken("s"); ok {
+		t.Fatal("token of an aborted transaction was cached")
+	}
+	if _, ok := si.cachedString(token); ok {
+		t.Fatal("string of an aborted transaction was cached")
+	}
+}
+
+func TestInternConcurrent(t *testing.T) {
+	db, sub := fdbtest.Open(t)
+
+	const workers = 20
+	tokens := make([][]byte, workers)
+	errs := make([]error, workers)
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			// instances of their own, so no cache is shared
+			tokens[i], errs[i] = intern(db, New(sub), "contended")
+		}(i)
+	}
+	wg.Wait()
+
+	for i := range tokens {
+		if errs[i] != nil {
+			t.Fatal(errs[i])
+		}
+		if !bytes.Equal(tokens[i], tokens[0]) {
+			t.Fatalf("worker %d got %x, worker 0 got %x", i, tokens[i], tokens[0])
+		}
+	}
+}
+
+func TestInternCommitted(t *testing.T) {
+	db, sub := fdbtest.Open(t)
+	si := New(sub)
+
+	token, err := intern(db, si, "s")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// committed, but not confirmed yet
+	if _, ok := si.cachedToken("s"); ok {
+		t.Fatal("new token cached before Committed")
+	}
+	si.Committed("s", token)
+	if cached, ok := si.cachedToken("s"); !ok || !bytes.Equal(cached, token) {
+		t.Fatalf("token cached as %x, %v, want %x", cached, ok, token)
+	}
+
+	// tokens allocated elsewhere are cached as they are read
+	if _, err := intern(db, New(sub), "t"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := intern(db, si, "t"); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := si.cachedToken("t"); !ok {
+		t.Fatal("committed token not cached as it was read")
+	}
+}
@@ -0,0 +1,54 @@
+package subspaces
+
+import (
+	"bytes"
+	"errors"
+	"github.com/FoundationDB/fdb-go/fdb"
+	"github.com/FoundationDB/fdb-go/fdb/subspace"
+	"github.com/FoundationDB/fdb-go/fdb/tuple"
+)
+
+// ErrNotTuple is returned by Children for keys of the subspace that are
+// not tuples
+var ErrNotTuple = errors.New("key of the subspace is not a tuple")
+
+// Children returns up to limit distinct first elements of the tuples in
+// the subspace, zero for all, in key order. It reads one key per child
+// and seeks past the rest of it, so the cost follows the number of
+// children rather than the number of keys.
+func Children(tr fdb.ReadTransaction, sub subspace.Subspace, limit int) ([]tuple.TupleElement, error) {
+	var children []tuple.TupleElement
+	begin, end := sub.FDBRangeKeys()
+	for limit == 0 || len(children) < limit {
+		key := tr.GetKey(fdb.FirstGreaterOrEqual(begin)).GetOrPanic()
+		if bytes.Compare(key, end.FDBKey()) >= 0 {
+			break
+		}
+		t, err := sub.Unpack(key)
+		if err != nil || len(t) == 0 {
+			return nil, ErrNotTuple
+		}
+		children = append(children, t[0])
+
+		// skip the rest of the child
+		next, ok := strinc(sub.Pack(tuple.Tuple{t[0]}))
+		if !ok {
+			break
+		}
+		begin = fdb.Key(next)
+	}
+	return children, nil
+}
+
+// strinc returns the first key after all keys starting with the prefix,
+// false if there is none
+func strinc(prefix []byte) ([]byte, bool) {
+	for i := len(prefix) - 1; i >= 0; i-- {
+		if prefix[i] != 0xff {
+			next := append([]byte(nil), prefix[:i+1]...)
+			next[i]++
+			return next, true
+		}
+	}
+	return nil, false
+}
@@ -0,0 +1,45 @@
+package subspaces
+
+import (
+	"github.com/FoundationDB/fdb-go/fdb"
+	"github.com/FoundationDB/fdb-go/fdb/tuple"
+	"github.com/abdullin/go-layers/internal/fdbtest"
+	"reflect"
+	"testing"
+)
+
+func TestChildren(t *testing.T) {
+	db, sub := fdbtest.Open(t)
+
+	v, err := db.Transact(func(tr fdb.Transaction) (interface{}, error) {
+		for i := 0; i < 50; i++ {
+			tr.Set(sub.Pack(tuple.Tuple{"a", int64(i)}), nil)
+		}
+		tr.Set(sub.Pack(tuple.Tuple{"b"}), nil)
+		tr.Set(sub.Pack(tuple.Tuple{[]byte{0xff, 0xff}, "x"}), nil)
+		tr.Set(sub.Pack(tuple.Tuple{int64(7), "y", "z"}), nil)
+
+		all, err := Children(tr, sub, 0)
+		if err != nil {
+			return nil, err
+		}
+		first, err := Children(tr, sub, 2)
+		if err != nil {
+			return nil, err
+		}
+		return [][]tuple.TupleElement{all, first}, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got := v.([][]tuple.TupleElement)
+	// tuples order bytes before strings before integers
+	want := []tuple.TupleElement{[]byte{0xff, 0xff}, "a", "b", int64(7)}
+	if !reflect.DeepEqual(got[0], want) {
+		t.Fatalf("children %v, want %v", got[0], want)
+	}
+	if !reflect.DeepEqual(got[1], want[:2]) {
+		t.Fatalf("first children %v, want %v", got[1], want[:2])
+	}
+}
@@ -0,0 +1,28 @@
+package subspaces
+
+import (
+	"bytes"
+	"github.com/FoundationDB/fdb-go/fdb/subspace"
+)
+
+// Subspaces compare by the bytes of their prefixes, so they sort like
+// their keys and a subspace sorts before the subspaces nested in it.
+// Tuple elements are encoded so that no element is the prefix of another,
+// so for subspaces built with Sub a prefix is also a parent.
+
+// Equal tells whether the subspaces have the same prefix
+func Equal(a, b subspace.Subspace) bool {
+	return bytes.Equal(a.Bytes(), b.Bytes())
+}
+
+// Compare returns -1, 0 or 1 as the prefix of a sorts before, equal to or
+// after the prefix of b
+func Compare(a, b subspace.Subspace) int {
+	return bytes.Compare(a.Bytes(), b.Bytes())
+}
+
+// IsPrefixOf tells whether the prefix of sub starts the prefix of other,
+// so every key of other is in sub. A subspace is a prefix of itself.
+func IsPrefixOf(sub, other subspace.Subspace) bool {
+	return bytes.HasPrefix(other.Bytes(), sub.Bytes())
+}
@@ -0,0 +1,54 @@
+package subspaces
+
+import (
+	"github.com/FoundationDB/fdb-go/fdb/subspace"
+	"sort"
+	"testing"
+)
+
+func TestCompare(t *testing.T) {
+	root := subspace.AllKeys()
+	app := subspace.Sub("app")
+
+	cases := []struct {
+		name     string
+		a, b     subspace.Subspace
+		compare  int
+		isPrefix bool // a is a prefix of b
+	}{
+		{"empty", root, root, 0, true},
+		{"empty and nested", root, app, -1, true},
+		{"nested and empty", app, root, 1, false},
+		{"equal", app, subspace.Sub("app"), 0, true},
+		{"parent", app, app.Sub("users"), -1, true},
+		{"child", app.Sub("users"), app, 1, false},
+		{"grandchild", app, app.Sub("users", 1), -1, true},
+		{"equal lengths", subspace.Sub("aa"), subspace.Sub("ab"), -1, false},
+		// the string terminator keeps a shorter string from being a prefix
+		{"longer string", subspace.Sub("ab"), subspace.Sub("abc"), -1, false},
+		{"raw prefix", subspace.FromBytes([]byte("\x02ab")), subspace.Sub("abc"), -1, true},
+		{"types", subspace.Sub(1), subspace.Sub("1"), 1, false},
+	}
+	for _, c := range cases {
+		if got := Compare(c.a, c.b); got != c.compare {
+			t.Errorf("%s: Compare is %d, want %d", c.name, got, c.compare)
+		}
+		if got := Equal(c.a, c.b); got != (c.compare == 0) {
+			t.Errorf("%s: Equal is %v", c.name, got)
+		}
+		if got := IsPrefixOf(c.a, c.b); got != c.isPrefix {
+			t.Errorf("%s: IsPrefixOf is %v, want %v", c.name, got, c.isPrefix)
+		}
+	}
+
+	// sorted, parents come before their children and duplicates are
+	// adjacent
+	subs := []subspace.Subspace{app.Sub("users", 1), subspace.Sub("b"), app, root, app.Sub("users"), subspace.Sub("app")}
+	sort.Slice(subs, func(i, j int) bool { return Compare(subs[i], subs[j]) < 0 })
+	want := []subspace.Subspace{root, app, app, app.Sub("users"), app.Sub("users", 1), subspace.Sub("b")}
+	for i := range want {
+		if !Equal(subs[i], want[i]) {
+			t.Fatalf("sorted %d is %q, want %q", i, subs[i].Bytes(), want[i].Bytes())
+		}
+	}
+}
@@ -0,0 +1,220 @@
+package subspaces
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"github.com/FoundationDB/fdb-go/fdb"
+	"github.com/FoundationDB/fdb-go/fdb/subspace"
+)
+
+// ErrOverlap is returned by CopyTo and MoveTo for subspaces nested in one
+// another, or a progress key inside either of them
+var ErrOverlap = errors.New("subspaces of the copy overlap")
+
+// ErrChecksum is returned by CopyTo when the destination doesn't hold
+// what the source does
+var ErrChecksum = errors.New("destination doesn't match the source")
+
+const (
+	// defaultBatchBytes is the size of a batch for a zero BatchBytes,
+	// well below the transaction size limit
+	defaultBatchBytes = 1 << 20
+	// copyBatchKeys caps the keys read per batch, whatever their size
+	copyBatchKeys = 10000
+)
+
+type CopyOptions struct {
+	BatchBytes int // size of keys and values copied per transaction
+	// Progress holds the last key copied, if set, so a CopyTo that
+	// stopped resumes after it. It has to be outside both subspaces.
+	Progress fdb.Key
+	// Verify compares checksums of both subspaces once the copy is done
+	Verify bool
+}
+
+// CopyTo copies the keys of src to dst, swapping the prefix of each, a
+// batch per transaction. Returns the number of keys copied by this call.
+// Keys written to src behind the copy are missed, so src should not
+// change until it returns.
+func CopyTo(ctx context.Context, db fdb.Database, src, dst subspace.Subspace, opts CopyOptions) (int64, error) {
+	if err := checkCopy(src, dst, opts.Progress); err != nil {
+		return 0, err
+	}
+	all := prefixRange(src)
+	from := all.Begin.FDBKey()
+
+	var keys int64
+	for {
+		if err := ctx.Err(); err != nil {
+			return keys, err
+		}
+		v, err := db.Transact(func(tr fdb.Transaction) (interface{}, error) {
+			from := from
+			if opts.Progress != nil {
+				if val := tr.Get(opts.Progress).GetOrPanic(); val != nil {
+					from = after(val)
+				}
+			}
+			kvs, err := readBatch(tr, fdb.KeyRange{Begin: from, End: all.End}, opts.BatchBytes)
+			if err != nil {
+				return nil, err
+			}
+			for _, kv := range kvs {
+				tr.Set(rekey(src, dst, kv.Key), kv.Value)
+			}
+			if len(kvs) > 0 && opts.Progress != nil {
+				tr.Set(opts.Progress, kvs[len(kvs)-1].Key)
+			}
+			return kvs, nil
+		})
+		if err != nil {
+			return keys, err
+		}
+		kvs := v.([]fdb.KeyValue)
+		if len(kvs) == 0 {
+			break
+		}
+		keys += int64(len(kvs))
+		from = after(kvs[len(kvs)-1].Key)
+	}
+
+	if opts.Verify {
+		want, err := checksum(ctx, db, src, opts.BatchBytes)
+		if err != nil {
+			return keys, err
+		}
+		got, err := checksum(ctx, db, dst, opts.BatchBytes)
+		if err != nil {
+			return keys, err
+		}
+		if !bytes.Equal(got, want) {
+			return keys, ErrChecksum
+		}
+	}
+	return keys, nil
+}
+
+// MoveTo moves the keys of src to dst, swapping the prefix of each. Each
+// batch is copied and cleared from src in one transaction, so no key is
+// cleared before its copy commits, and a MoveTo that stopped carries on
+// with what is left. Returns the number of keys moved by this call.
+func MoveTo(ctx context.Context, db fdb.Database, src, dst subspace.Subspace, batchBytes int) (int64, error) {
+	if err := checkCopy(src, dst, nil); err != nil {
+		return 0, err
+	}
+
+	var keys int64
+	for {
+		if err := ctx.Err(); err != nil {
+			return keys, err
+		}
+		v, err := db.Transact(func(tr fdb.Transaction) (interface{}, error) {
+			kvs, err := readBatch(tr, prefixRange(src), batchBytes)
+			if err != nil || len(kvs) == 0 {
+				return 0, err
+			}
+			for _, kv := range kvs {
+				tr.Set(rekey(src, dst, kv.Key), kv.Value)
+			}
+			tr.ClearRange(fdb.KeyRange{Begin: kvs[0].Key, End: after(kvs[len(kvs)-1].Key)})
+			return len(kvs), nil
+		})
+		if err != nil {
+			return keys, err
+		}
+		n := v.(int)
+		if n == 0 {
+			return keys, nil
+		}
+		keys += int64(n)
+	}
+}
+
+func checkCopy(src, dst subspace.Subspace, progress fdb.Key) error {
+	s, d := src.Bytes(), dst.Bytes()
+	if bytes.HasPrefix(s, d) || bytes.HasPrefix(d, s) {
+		return ErrOverlap
+	}
+	if progress != nil && (src.Contains(progress) || dst.Contains(progress)) {
+		return ErrOverlap
+	}
+	return nil
+}
+
+// readBatch reads the keys of the range up to batchBytes of keys and
+// values, at least one
+func readBatch(tr fdb.ReadTransaction, r fdb.Range, batchBytes int) ([]fdb.KeyValue, error) {
+	if batchBytes <= 0 {
+		batchBytes = defaultBatchBytes
+	}
+	var kvs []fdb.KeyValue
+	size := 0
+	ri := tr.GetRange(r, fdb.RangeOptions{Limit: copyBatchKeys}).Iterator()
+	for size < batchBytes && ri.Advance() {
+		kv, err := ri.GetNextWithError()
+		if err != nil {
+			return nil, err
+		}
+		kvs = append(kvs, kv)
+		size += len(kv.Key) + len(kv.Value)
+	}
+	return kvs, nil
+}
+
+// checksum hashes the keys of the subspace, relative to it, with their
+// values, a batch per transaction
+func checksum(ctx context.Context, db fdb.Database, sub subspace.Subspace, batchBytes int) ([]byte, error) {
+	h := sha256.New()
+	prefix := len(sub.Bytes())
+	all := prefixRange(sub)
+	from := all.Begin.FDBKey()
+	for {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		v, err := db.Transact(func(tr fdb.Transaction) (interface{}, error) {
+			return readBatch(tr.Snapshot(), fdb.KeyRange{Begin: from, End: all.End}, batchBytes)
+		})
+		if err != nil {
+			return nil, err
+		}
+		kvs := v.([]fdb.KeyValue)
+		if len(kvs) == 0 {
+			return h.Sum(nil), nil
+		}
+		for _, kv := range kvs {
+			for _, b := range [][]byte{kv.Key[prefix:], kv.Value} {
+				var n [4]byte
+				binary.BigEndian.PutUint32(n[:], uint32(len(b)))
+				h.Write(n[:])
+				h.Write(b)
+			}
+		}
+		from = after(kvs[len(kvs)-1].Key)
+	}
+}
+
+// prefixRange returns the range of all keys starting with the prefix of
+// the subspace. Unlike the range of the subspace itself, it holds the
+// prefix as a key too.
+func prefixRange(sub subspace.Subspace) fdb.KeyRange {
+	prefix := sub.Bytes()
+	if end, ok := strinc(prefix); ok {
+		return fdb.KeyRange{Begin: fdb.Key(prefix), End: fdb.Key(end)}
+	}
+	_, end := sub.FDBRangeKeys()
+	return fdb.KeyRange{Begin: fdb.Key(prefix), End: end}
+}
+
+// rekey returns the key of src under the prefix of dst
+func rekey(src, dst subspace.Subspace, key fdb.Key) fdb.Key {
+	return fdb.Key(append(append([]byte(nil), dst.Bytes()...), key[len(src.Bytes()):]...))
+}
+
+// after returns the first key after the key
+func after(key []byte) fdb.Key {
+	return fdb.Key(append(append([]byte(nil), key...), 0x00))
+}
@@ -0,0 +1,96 @@
+package subspaces
+
+import (
+	"bytes"
+	"context"
+	"github.com/FoundationDB/fdb-go/fdb"
+	"github.com/FoundationDB/fdb-go/fdb/subspace"
+	"github.com/FoundationDB/fdb-go/fdb/tuple"
+	"github.com/abdullin/go-layers/internal/fdbtest"
+	"testing"
+)
+
+const copyKeys = 100
+
+func fill(t *testing.T, db fdb.Database, sub subspace.Subspace) {
+	_, err := db.Transact(func(tr fdb.Transaction) (interface{}, error) {
+		tr.Set(fdb.Key(sub.Bytes()), []byte("prefix"))
+		for i := 0; i < copyKeys-1; i++ {
+			tr.Set(sub.Pack(tuple.Tuple{int64(i)}), bytes.Repeat([]byte{byte(i)}, 100))
+		}
+		return nil, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func count(t *testing.T, db fdb.Database, sub subspace.Subspace) int {
+	v, err := db.Transact(func(tr fdb.Transaction) (interface{}, error) {
+		return tr.GetRange(prefixRange(sub), fdb.RangeOptions{}).GetSliceWithError()
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return len(v.([]fdb.KeyValue))
+}
+
+func TestCopyTo(t *testing.T) {
+	db, sub := fdbtest.Open(t)
+	src, dst := sub.Sub("src"), sub.Sub("dst")
+	fill(t, db, src)
+
+	ctx := context.Background()
+	opts := CopyOptions{BatchBytes: 1000, Progress: sub.Pack(tuple.Tuple{"progress"}), Verify: true}
+	if n, err := CopyTo(ctx, db, src, dst, opts); err != nil || n != copyKeys {
+		t.Fatalf("copied %d keys, %v", n, err)
+	}
+	if n := count(t, db, src); n != copyKeys {
+		t.Fatalf("%d keys left in the source", n)
+	}
+
+	// a second run resumes after the last key
+	if n, err := CopyTo(ctx, db, src, dst, opts); err != nil || n != 0 {
+		t.Fatalf("copied %d keys again, %v", n, err)
+	}
+
+	_, err := db.Transact(func(tr fdb.Transaction) (interface{}, error) {
+		tr.Set(dst.Pack(tuple.Tuple{"stray"}), nil)
+		return nil, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := CopyTo(ctx, db, src, dst, opts); err != ErrChecksum {
+		t.Fatalf("verified a stray key with %v", err)
+	}
+
+	if _, err := CopyTo(ctx, db, sub, src, CopyOptions{}); err != ErrOverlap {
+		t.Fatalf("copied into a nested subspace with %v", err)
+	}
+	if _, err := CopyTo(ctx, db, src, dst, CopyOptions{Progress: src.Pack(tuple.Tuple{"p"})}); err != ErrOverlap {
+		t.Fatalf("copied with the progress in the source with %v", err)
+	}
+}
+
+func TestMoveTo(t *testing.T) {
+	db, sub := fdbtest.Open(t)
+	src, dst := sub.Sub("src"), sub.Sub("dst")
+	fill(t, db, src)
+
+	if n, err := MoveTo(context.Background(), db, src, dst, 1000); err != nil || n != copyKeys {
+		t.Fatalf("moved %d keys, %v", n, err)
+	}
+	if n := count(t, db, src); n != 0 {
+		t.Fatalf("%d keys left in the source", n)
+	}
+	if n := count(t, db, dst); n != copyKeys {
+		t.Fatalf("%d keys in the destination", n)
+	}
+	v, err := db.Transact(func(tr fdb.Transaction) (interface{}, error) {
+		return tr.Get(dst.Pack(tuple.Tuple{int64(5)})).GetWithError()
+	})
+	if err != nil || !bytes.Equal(v.([]byte), bytes.Repeat([]byte{5}, 100)) {
+		t.Fatalf("moved value %x, %v", v, err)
+	}
+}
@@ -0,0 +1,51 @@
+package subspaces
+
+import (
+	"fmt"
+	"github.com/FoundationDB/fdb-go/fdb"
+	"github.com/FoundationDB/fdb-go/fdb/subspace"
+	"io"
+)
+
+// previewBytes is how much of a value Dump shows
+const previewBytes = 32
+
+// Dump writes up to limit keys of the subspace to w, zero for all, one
+// line per key:
+//
+//	escaped key <TAB> tuple <TAB> value length <TAB> value preview
+//
+// The tuple is decoded relative to the subspace. Keys that are not a
+// tuple are labelled instead, so malformed data doesn't stop the dump.
+func Dump(tr fdb.ReadTransaction, sub subspace.Subspace, w io.Writer, limit int) error {
+	ri := tr.GetRange(sub, fdb.RangeOptions{Limit: limit}).Iterator()
+	for ri.Advance() {
+		kv, err := ri.GetNextWithError()
+		if err != nil {
+			return err
+		}
+		if _, err := fmt.Fprintf(w, "%s\t%s\t%d\t%s\n", fdb.Printable(kv.Key), describe(sub, kv.Key), len(kv.Value), preview(kv.Value)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// describe decodes a key of the subspace as a tuple, best effort
+func describe(sub subspace.Subspace, key fdb.Key) string {
+	if !sub.Contains(key) {
+		return "(outside the subspace)"
+	}
+	t, err := sub.Unpack(key)
+	if err != nil {
+		return fmt.Sprintf("(not a tuple: %v)", err)
+	}
+	return fmt.Sprintf("%v", t)
+}
+
+func preview(value []byte) string {
+	if len(value) <= previewBytes {
+		return fdb.Printable(value)
+	}
+	return fdb.Printable(value[:previewBytes]) + "..."
+}
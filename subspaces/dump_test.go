@@ -0,0 +1,38 @@
+package subspaces
+
+import (
+	"bytes"
+	"github.com/FoundationDB/fdb-go/fdb"
+	"github.com/FoundationDB/fdb-go/fdb/tuple"
+	"github.com/abdullin/go-layers/internal/fdbtest"
+	"strings"
+	"testing"
+)
+
+func TestDump(t *testing.T) {
+	db, sub := fdbtest.Open(t)
+
+	var out bytes.Buffer
+	_, err := db.Transact(func(tr fdb.Transaction) (interface{}, error) {
+		tr.Set(sub.Pack(tuple.Tuple{"a", int64(1)}), []byte("short"))
+		tr.Set(sub.Pack(tuple.Tuple{"b"}), bytes.Repeat([]byte("x"), 100))
+		// not a tuple
+		tr.Set(fdb.Key(append(sub.Bytes(), 0xff, 0xfe)), nil)
+
+		out.Reset()
+		return nil, Dump(tr, sub, &out, 0)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("dumped %d lines, want 3:\n%s", len(lines), out.String())
+	}
+	for i, want := range []string{"\t5\tshort", "\t100\t" + strings.Repeat("x", previewBytes) + "...", "(not a tuple"} {
+		if !strings.Contains(lines[i], want) {
+			t.Errorf("line %d is %q, want it to contain %q", i, lines[i], want)
+		}
+	}
+}
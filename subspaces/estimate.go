@@ -0,0 +1,121 @@
+package subspaces
+
+import (
+	"bytes"
+	"github.com/FoundationDB/fdb-go/fdb"
+	"github.com/FoundationDB/fdb-go/fdb/subspace"
+)
+
+// The bindings of API versions before 630 have no range size estimate.
+// Instead keys are counted with key selectors: the database resolves an
+// offset from the start of the subspace without sending the keys it
+// skips, so the count is found by doubling the offset until it runs past
+// the end and bisecting the last step, a few dozen point reads for
+// millions of keys. The count is exact whatever the keys look like, which
+// matters for tuple keys that cluster behind a few shared prefixes.
+//
+// Sizes are extrapolated from the count: runs of keys are read at evenly
+// spaced offsets, the same spacing in key order Sample uses, and their
+// mean size is taken for every key. Subspaces of a few runs are read
+// whole and sized exactly.
+
+const (
+	estimateWindow = 16 // keys read per run
+	estimateProbes = 64 // runs read per size estimate
+)
+
+// EstimateSize returns the approximate size of the keys and values of the
+// subspace. It reads at most a few thousand keys, at snapshot isolation.
+func EstimateSize(tr fdb.ReadTransaction, sub subspace.Subspace) (int64, error) {
+	rt := tr.Snapshot()
+	all := prefixRange(sub)
+	keys, err := countKeys(rt, all)
+	if err != nil || keys == 0 {
+		return 0, err
+	}
+
+	if keys <= estimateWindow*estimateProbes {
+		kvs, err := rt.GetRange(all, fdb.RangeOptions{}).GetSliceWithError()
+		if err != nil {
+			return 0, err
+		}
+		return kvSize(kvs), nil
+	}
+
+	runs := make([]fdb.RangeResult, estimateProbes)
+	for i := range runs {
+		offset := int64(i) * keys / estimateProbes
+		begin := fdb.KeySelector{Key: all.Begin, OrEqual: false, Offset: int(offset) + 1}
+		runs[i] = rt.GetRange(fdb.SelectorRange{Begin: begin, End: fdb.FirstGreaterOrEqual(all.End)}, fdb.RangeOptions{Limit: estimateWindow})
+	}
+	var sampled, size int64
+	for _, r := range runs {
+		kvs, err := r.GetSliceWithError()
+		if err != nil {
+			return 0, err
+		}
+		sampled += int64(len(kvs))
+		size += kvSize(kvs)
+	}
+	if sampled == 0 {
+		return 0, nil
+	}
+	return size * keys / sampled, nil
+}
+
+// EstimateCount returns the number of keys in the subspace, counted with
+// key selectors at snapshot isolation. Only the keys at the offsets tried
+// are read.
+func EstimateCount(tr fdb.ReadTransaction, sub subspace.Subspace) (int64, error) {
+	return countKeys(tr.Snapshot(), prefixRange(sub))
+}
+
+// countKeys counts the keys of r by the offsets of key selectors
+func countKeys(rt fdb.Snapshot, r fdb.KeyRange) (int64, error) {
+	// within tells whether the key n keys past the start of r is in r
+	within := func(n int64) (bool, error) {
+		key, err := rt.GetKey(fdb.KeySelector{Key: r.Begin, OrEqual: false, Offset: int(n) + 1}).GetWithError()
+		if err != nil {
+			return false, err
+		}
+		return bytes.Compare(key, r.End.FDBKey()) < 0, nil
+	}
+
+	ok, err := within(0)
+	if err != nil || !ok {
+		return 0, err
+	}
+	// key lo is known to be in r and key hi past its end
+	lo, hi := int64(0), int64(1)
+	for {
+		ok, err := within(hi)
+		if err != nil {
+			return 0, err
+		}
+		if !ok {
+			break
+		}
+		lo, hi = hi, hi*2
+	}
+	for hi-lo > 1 {
+		mid := (lo + hi) / 2
+		ok, err := within(mid)
+		if err != nil {
+			return 0, err
+		}
+		if ok {
+			lo = mid
+		} else {
+			hi = mid
+		}
+	}
+	return lo + 1, nil
+}
+
+func kvSize(kvs []fdb.KeyValue) int64 {
+	size := 0
+	for _, kv := range kvs {
+		size += len(kv.Key) + len(kv.Value)
+	}
+	return int64(size)
+}
@@ -0,0 +1,116 @@
+package subspaces
+
+import (
+	"fmt"
+	"github.com/FoundationDB/fdb-go/fdb"
+	"github.com/FoundationDB/fdb-go/fdb/subspace"
+	"github.com/FoundationDB/fdb-go/fdb/tuple"
+	"github.com/abdullin/go-layers/internal/fdbtest"
+	"math/rand"
+	"testing"
+)
+
+func TestEstimate(t *testing.T) {
+	db, sub := fdbtest.Open(t)
+	small, large := sub.Sub("small"), sub.Sub("large")
+
+	const smallKeys, largeKeys = 10, 20000
+	value := make([]byte, 50)
+	_, err := db.Transact(func(tr fdb.Transaction) (interface{}, error) {
+		for i := 0; i < smallKeys; i++ {
+			tr.Set(small.Pack(tuple.Tuple{int64(i + 1)}), value)
+		}
+		return nil, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// random keys spread evenly over the key space
+	for written := 0; written < largeKeys; written += 1000 {
+		_, err := db.Transact(func(tr fdb.Transaction) (interface{}, error) {
+			for i := 0; i < 1000; i++ {
+				key := make([]byte, 8)
+				rand.Read(key)
+				tr.Set(fdb.Key(append(append([]byte(nil), large.Bytes()...), key...)), value)
+			}
+			return nil, nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	estimate := func(sub subspace.Subspace) (int64, int64) {
+		v, err := db.Transact(func(tr fdb.Transaction) (interface{}, error) {
+			keys, err := EstimateCount(tr, sub)
+			if err != nil {
+				return nil, err
+			}
+			size, err := EstimateSize(tr, sub)
+			return []int64{keys, size}, err
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return v.([]int64)[0], v.([]int64)[1]
+	}
+
+	// a small subspace is counted exactly
+	keySize := int64(len(small.Pack(tuple.Tuple{int64(1)})))
+	if keys, size := estimate(small); keys != smallKeys || size != smallKeys*(keySize+int64(len(value))) {
+		t.Fatalf("small subspace estimated at %d keys, %d bytes", keys, size)
+	}
+
+	keys, size := estimate(large)
+	if keys != largeKeys {
+		t.Fatalf("%d keys counted as %d", largeKeys, keys)
+	}
+	want := int64(largeKeys * (len(large.Bytes()) + 8 + len(value)))
+	if size < want/2 || size > want*2 {
+		t.Fatalf("%d bytes estimated at %d", want, size)
+	}
+}
+
+func TestEstimateClustered(t *testing.T) {
+	db, sub := fdbtest.Open(t)
+
+	// tuple keys behind a few shared prefixes, the way layers store
+	// streams of events: all of them sort into a sliver of the key space
+	const streams, events = 4, 3000
+	var want int64
+	for s := 0; s < streams; s++ {
+		for v := 0; v < events; v += 1000 {
+			_, err := db.Transact(func(tr fdb.Transaction) (interface{}, error) {
+				for i := v; i < v+1000; i++ {
+					key := sub.Pack(tuple.Tuple{"events", fmt.Sprintf("stream-%d", s), int64(i)})
+					tr.Set(key, make([]byte, 100*(s+1)))
+				}
+				return nil, nil
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+		key := sub.Pack(tuple.Tuple{"events", fmt.Sprintf("stream-%d", s), int64(0)})
+		want += events * int64(len(key)+100*(s+1))
+	}
+
+	v, err := db.Transact(func(tr fdb.Transaction) (interface{}, error) {
+		keys, err := EstimateCount(tr, sub)
+		if err != nil {
+			return nil, err
+		}
+		size, err := EstimateSize(tr, sub)
+		return []int64{keys, size}, err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	keys, size := v.([]int64)[0], v.([]int64)[1]
+	if keys != streams*events {
+		t.Fatalf("%d keys counted as %d", streams*events, keys)
+	}
+	if size < want*3/4 || size > want*4/3 {
+		t.Fatalf("%d bytes estimated at %d", want, size)
+	}
+}
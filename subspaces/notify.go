@@ -0,0 +1,33 @@
+package subspaces
+
+import (
+	"github.com/FoundationDB/fdb-go/fdb"
+	"github.com/FoundationDB/fdb-go/fdb/subspace"
+)
+
+// A subspace notifies watchers through a sentinel key that writers bump
+// with an atomic ADD: bumps read nothing, so writers never conflict on
+// it, and every bump changes the value, which is what fires a watch.
+
+// one is the little-endian int64 added by Bump
+var one = []byte{1, 0, 0, 0, 0, 0, 0, 0}
+
+// NotifyKey returns the sentinel key of the subspace: the key of its
+// prefix, which sorts before its tuples and is outside their range, so
+// range reads and clears of the subspace leave it alone
+func NotifyKey(sub subspace.Subspace) fdb.Key {
+	return fdb.Key(sub.Bytes())
+}
+
+// Bump changes the sentinel key of the subspace, firing its watches once
+// tr commits
+func Bump(tr fdb.Transaction, sub subspace.Subspace) {
+	tr.Add(NotifyKey(sub), one)
+}
+
+// Watch returns a watch on the sentinel key of the subspace. It becomes
+// active when tr commits and fires on the first bump after the value tr
+// read, never for earlier ones.
+func Watch(tr fdb.Transaction, sub subspace.Subspace) fdb.FutureNil {
+	return tr.Watch(NotifyKey(sub))
+}
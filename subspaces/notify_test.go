@@ -0,0 +1,83 @@
+package subspaces
+
+import (
+	"github.com/FoundationDB/fdb-go/fdb"
+	"github.com/abdullin/go-layers/internal/fdbtest"
+	"testing"
+	"time"
+)
+
+func TestWatch(t *testing.T) {
+	db, root := fdbtest.Open(t)
+	// nested, so the cleanup of the test clears the sentinel key too
+	sub := root.Sub("watched")
+
+	bump := func() {
+		t.Helper()
+		if _, err := db.Transact(func(tr fdb.Transaction) (interface{}, error) {
+			Bump(tr, sub)
+			return nil, nil
+		}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// watch commits a watch and reports on the channel when it fires
+	watch := func() <-chan error {
+		t.Helper()
+		v, err := db.Transact(func(tr fdb.Transaction) (interface{}, error) {
+			return Watch(tr, sub), nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		fired := make(chan error, 1)
+		go func() { fired <- v.(fdb.FutureNil).GetWithError() }()
+		return fired
+	}
+	fires := func(fired <-chan error, want bool) {
+		t.Helper()
+		wait := 5 * time.Second
+		if !want {
+			wait = 500 * time.Millisecond
+		}
+		select {
+		case err := <-fired:
+			if err != nil || !want {
+				t.Fatalf("watch fired: %v", err)
+			}
+		case <-time.After(wait):
+			if want {
+				t.Fatal("watch did not fire")
+			}
+		}
+	}
+
+	// a watch set before a bump fires
+	before := watch()
+	bump()
+	fires(before, true)
+
+	// one set after the bumps doesn't fire for them, only for the next
+	bump()
+	after := watch()
+	fires(after, false)
+	bump()
+	fires(after, true)
+
+	// the key is outside the range of the tuples, clearing them keeps it
+	if _, err := db.Transact(func(tr fdb.Transaction) (interface{}, error) {
+		tr.ClearRange(sub)
+		return nil, nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	v, err := db.Transact(func(tr fdb.Transaction) (interface{}, error) {
+		return tr.Get(NotifyKey(sub)).GetWithError()
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if val := v.([]byte); len(val) != 8 || val[0] != 3 {
+		t.Fatalf("sentinel after 3 bumps and a clear is %x", val)
+	}
+}
@@ -0,0 +1,55 @@
+package subspaces
+
+import (
+	"bytes"
+	"github.com/FoundationDB/fdb-go/fdb"
+	"github.com/FoundationDB/fdb-go/fdb/subspace"
+	"github.com/FoundationDB/fdb-go/fdb/tuple"
+)
+
+// ReadOptions select the tuples of a subspace read by ReadRange. Bounds
+// cover the keys starting with their tuple, so From (5) reads (5, "a")
+// and After (5) skips it. Empty bounds leave the range open.
+type ReadOptions struct {
+	From   tuple.Tuple // start at the keys starting with the tuple
+	After  tuple.Tuple // start past the keys starting with the tuple, over From
+	Before tuple.Tuple // end before the keys starting with the tuple
+	// Limit is the number of keys read, zero for all of the range
+	Limit    int
+	Reverse  bool // read from the end of the range
+	Snapshot bool // read at snapshot isolation
+}
+
+// Iterator pulls the pairs of a range read in batches that grow as the
+// read goes on. Advance and GetNext* are the ones of the bindings.
+type Iterator struct {
+	*fdb.RangeIterator
+}
+
+// ReadRange reads the tuples of the subspace within the bounds of the
+// options. Unlike reading a slice, the keys are not all buffered, so
+// large ranges can be walked in constant memory.
+func ReadRange(tr fdb.ReadTransaction, sub subspace.Subspace, opts ReadOptions) Iterator {
+	begin, end := sub.FDBRangeKeys()
+	r := fdb.KeyRange{Begin: begin, End: end}
+	switch {
+	case len(opts.After) > 0:
+		r.Begin = prefixRange(sub.Sub(opts.After...)).End
+	case len(opts.From) > 0:
+		r.Begin = sub.Pack(opts.From)
+	}
+	if len(opts.Before) > 0 {
+		r.End = sub.Pack(opts.Before)
+	}
+	// bounds that cross read nothing rather than fail as an inverted range
+	if bytes.Compare(r.Begin.FDBKey(), r.End.FDBKey()) > 0 {
+		r.End = r.Begin
+	}
+
+	rt := tr
+	if opts.Snapshot {
+		rt = tr.Snapshot()
+	}
+	options := fdb.RangeOptions{Limit: opts.Limit, Mode: fdb.StreamingModeIterator, Reverse: opts.Reverse}
+	return Iterator{rt.GetRange(r, options).Iterator()}
+}
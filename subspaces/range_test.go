@@ -0,0 +1,68 @@
+package subspaces
+
+import (
+	"fmt"
+	"github.com/FoundationDB/fdb-go/fdb"
+	"github.com/FoundationDB/fdb-go/fdb/tuple"
+	"github.com/abdullin/go-layers/internal/fdbtest"
+	"testing"
+)
+
+func TestReadRange(t *testing.T) {
+	db, root := fdbtest.Open(t)
+	before, sub, after := root.Sub("a"), root.Sub("b"), root.Sub("c")
+
+	_, err := db.Transact(func(tr fdb.Transaction) (interface{}, error) {
+		tr.Set(before.Pack(tuple.Tuple{int64(9)}), nil)
+		tr.Set(after.Pack(tuple.Tuple{int64(0)}), nil)
+		tr.Set(NotifyKey(sub), nil)
+		for _, k := range []tuple.Tuple{{int64(1)}, {int64(2), "a"}, {int64(2), "b"}, {int64(3)}, {int64(5)}} {
+			tr.Set(sub.Pack(k), nil)
+		}
+		return nil, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		name string
+		opts ReadOptions
+		want string
+	}{
+		{"all", ReadOptions{}, "[1] [2 a] [2 b] [3] [5]"},
+		{"from a prefix", ReadOptions{From: tuple.Tuple{int64(2)}}, "[2 a] [2 b] [3] [5]"},
+		{"after a prefix", ReadOptions{After: tuple.Tuple{int64(2)}}, "[3] [5]"},
+		{"after over from", ReadOptions{From: tuple.Tuple{int64(1)}, After: tuple.Tuple{int64(2)}}, "[3] [5]"},
+		{"before a prefix", ReadOptions{Before: tuple.Tuple{int64(2)}}, "[1]"},
+		{"between", ReadOptions{From: tuple.Tuple{int64(2), "b"}, Before: tuple.Tuple{int64(5)}}, "[2 b] [3]"},
+		{"crossed", ReadOptions{After: tuple.Tuple{int64(3)}, Before: tuple.Tuple{int64(2)}}, ""},
+		{"limit", ReadOptions{Limit: 2}, "[1] [2 a]"},
+		{"reverse", ReadOptions{Reverse: true, Limit: 3}, "[5] [3] [2 b]"},
+		{"reverse after", ReadOptions{After: tuple.Tuple{int64(1)}, Before: tuple.Tuple{int64(5)}, Reverse: true}, "[3] [2 b] [2 a]"},
+		{"snapshot", ReadOptions{Snapshot: true, From: tuple.Tuple{int64(5)}}, "[5]"},
+	}
+
+	_, err = db.Transact(func(tr fdb.Transaction) (interface{}, error) {
+		for _, c := range cases {
+			got := ""
+			for ri := ReadRange(tr, sub, c.opts); ri.Advance(); {
+				key, err := sub.Unpack(ri.GetNextOrPanic().Key)
+				if err != nil {
+					return nil, err
+				}
+				if got != "" {
+					got += " "
+				}
+				got += fmt.Sprint([]tuple.TupleElement(key))
+			}
+			if got != c.want {
+				t.Errorf("%s: read %q, want %q", c.name, got, c.want)
+			}
+		}
+		return nil, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,70 @@
+package subspaces
+
+import (
+	"bytes"
+	"github.com/FoundationDB/fdb-go/fdb"
+	"github.com/FoundationDB/fdb-go/fdb/subspace"
+	"github.com/FoundationDB/fdb-go/fdb/tuple"
+)
+
+// KeySample is a key picked by Sample
+type KeySample struct {
+	Key       fdb.Key
+	Tuple     tuple.Tuple // nil for keys that are not tuples
+	ValueSize int
+	Fraction  float64 // how far into the subspace the key is, from 0 to 1
+}
+
+// Sample picks about n keys spread evenly across the subspace, in key
+// order. Keys are found with key selectors at evenly spaced offsets from
+// the start of the subspace, so no other key is read; the spacing comes
+// from EstimateCount, and so do the fractions. Reads are at snapshot
+// isolation.
+func Sample(tr fdb.ReadTransaction, sub subspace.Subspace, n int) ([]KeySample, error) {
+	total, err := EstimateCount(tr, sub)
+	if err != nil || total == 0 || n <= 0 {
+		return nil, err
+	}
+	if int64(n) > total {
+		n = int(total)
+	}
+
+	all := prefixRange(sub)
+	rt := tr.Snapshot()
+	offsets := make([]int64, n)
+	keys := make([]fdb.FutureKey, n)
+	for i := range keys {
+		offsets[i] = int64(i) * total / int64(n)
+		keys[i] = rt.GetKey(fdb.KeySelector{Key: all.Begin, OrEqual: false, Offset: int(offsets[i]) + 1})
+	}
+
+	var samples []KeySample
+	var values []fdb.FutureByteSlice
+	for i, f := range keys {
+		key, err := f.GetWithError()
+		if err != nil {
+			return nil, err
+		}
+		// the estimate may run past the end, or count keys twice
+		if bytes.Compare(key, all.End.FDBKey()) >= 0 {
+			break
+		}
+		if len(samples) > 0 && bytes.Equal(samples[len(samples)-1].Key, key) {
+			continue
+		}
+		s := KeySample{Key: key, Fraction: float64(offsets[i]) / float64(total)}
+		if t, err := sub.Unpack(key); err == nil {
+			s.Tuple = t
+		}
+		samples = append(samples, s)
+		values = append(values, rt.Get(key))
+	}
+	for i, f := range values {
+		value, err := f.GetWithError()
+		if err != nil {
+			return nil, err
+		}
+		samples[i].ValueSize = len(value)
+	}
+	return samples, nil
+}
@@ -0,0 +1,34 @@
+package subspaces
+
+import (
+	"github.com/FoundationDB/fdb-go/fdb"
+	"github.com/FoundationDB/fdb-go/fdb/tuple"
+	"github.com/abdullin/go-layers/internal/fdbtest"
+	"testing"
+)
+
+func TestSample(t *testing.T) {
+	db, sub := fdbtest.Open(t)
+
+	v, err := db.Transact(func(tr fdb.Transaction) (interface{}, error) {
+		// few enough keys to be counted exactly
+		for i := 0; i < 12; i++ {
+			tr.Set(sub.Pack(tuple.Tuple{"k", int64(i)}), make([]byte, i))
+		}
+		return Sample(tr, sub, 4)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	samples := v.([]KeySample)
+	if len(samples) != 4 {
+		t.Fatalf("sampled %+v", samples)
+	}
+	for i, s := range samples {
+		index := int64(i * 3)
+		if len(s.Tuple) != 2 || s.Tuple[1] != index || s.ValueSize != int(index) || s.Fraction != float64(i)/4 {
+			t.Fatalf("sample %d is %+v", i, s)
+		}
+	}
+}
@@ -0,0 +1,34 @@
+package subspaces
+
+import (
+	"github.com/FoundationDB/fdb-go/fdb"
+	"github.com/FoundationDB/fdb-go/fdb/subspace"
+	"github.com/FoundationDB/fdb-go/fdb/tuple"
+)
+
+// The selectors below pack their tuple within the subspace and pick the
+// boundary for the keys that start with it, so (5) covers (5, "a") as
+// well. A selector is resolved over the whole database: when the subspace
+// has no such key it resolves to a key outside of it, which callers tell
+// with Contains.
+
+// SelectorFrom selects the first key of the tuple or after it
+func SelectorFrom(sub subspace.Subspace, t tuple.Tuple) fdb.KeySelector {
+	return fdb.FirstGreaterOrEqual(sub.Pack(t))
+}
+
+// SelectorAfter selects the first key after all the keys starting with
+// the tuple, past the subspace for an empty one
+func SelectorAfter(sub subspace.Subspace, t tuple.Tuple) fdb.KeySelector {
+	return fdb.FirstGreaterOrEqual(prefixRange(sub.Sub(t...)).End)
+}
+
+// LastBefore selects the last key before the keys starting with the
+// tuple. An empty tuple stands for the end of the subspace, selecting its
+// last key.
+func LastBefore(sub subspace.Subspace, t tuple.Tuple) fdb.KeySelector {
+	if len(t) == 0 {
+		return fdb.LastLessThan(prefixRange(sub).End)
+	}
+	return fdb.LastLessThan(sub.Pack(t))
+}
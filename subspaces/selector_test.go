@@ -0,0 +1,64 @@
+package subspaces
+
+import (
+	"github.com/FoundationDB/fdb-go/fdb"
+	"github.com/FoundationDB/fdb-go/fdb/tuple"
+	"github.com/abdullin/go-layers/internal/fdbtest"
+	"testing"
+)
+
+func TestSelectors(t *testing.T) {
+	db, root := fdbtest.Open(t)
+	// keys of the neighbours sort right before and after the subspace
+	before, sub, after := root.Sub("a"), root.Sub("b"), root.Sub("c")
+
+	_, err := db.Transact(func(tr fdb.Transaction) (interface{}, error) {
+		tr.Set(before.Pack(tuple.Tuple{int64(9)}), nil)
+		tr.Set(after.Pack(tuple.Tuple{int64(0)}), nil)
+		for _, k := range []tuple.Tuple{{int64(1)}, {int64(2), "a"}, {int64(2), "b"}, {int64(3)}, {int64(5)}} {
+			tr.Set(sub.Pack(k), nil)
+		}
+		return nil, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		name string
+		sel  fdb.KeySelector
+		want tuple.Tuple // nil for a key outside of the subspace
+	}{
+		{"from a prefix", SelectorFrom(sub, tuple.Tuple{int64(2)}), tuple.Tuple{int64(2), "a"}},
+		{"from a gap", SelectorFrom(sub, tuple.Tuple{int64(4)}), tuple.Tuple{int64(5)}},
+		{"from the start", SelectorFrom(sub, nil), tuple.Tuple{int64(1)}},
+		{"from past the end", SelectorFrom(sub, tuple.Tuple{int64(6)}), nil},
+		{"after a prefix", SelectorAfter(sub, tuple.Tuple{int64(2)}), tuple.Tuple{int64(3)}},
+		{"after a key", SelectorAfter(sub, tuple.Tuple{int64(2), "a"}), tuple.Tuple{int64(2), "b"}},
+		{"after the last", SelectorAfter(sub, tuple.Tuple{int64(5)}), nil},
+		{"after everything", SelectorAfter(sub, nil), nil},
+		{"before a prefix", LastBefore(sub, tuple.Tuple{int64(3)}), tuple.Tuple{int64(2), "b"}},
+		{"before a gap", LastBefore(sub, tuple.Tuple{int64(4)}), tuple.Tuple{int64(3)}},
+		{"before the end", LastBefore(sub, nil), tuple.Tuple{int64(5)}},
+		{"before the first", LastBefore(sub, tuple.Tuple{int64(1)}), nil},
+	}
+
+	_, err = db.Transact(func(tr fdb.Transaction) (interface{}, error) {
+		for _, c := range cases {
+			key := tr.GetKey(c.sel).GetOrPanic()
+			if !sub.Contains(key) {
+				if c.want != nil {
+					t.Errorf("%s: resolved to %s outside of the subspace, want %v", c.name, key, c.want)
+				}
+				continue
+			}
+			if got, err := sub.Unpack(key); err != nil || c.want == nil || string(got.Pack()) != string(c.want.Pack()) {
+				t.Errorf("%s: resolved to %v, want %v", c.name, got, c.want)
+			}
+		}
+		return nil, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,137 @@
+/*
+Package subspaces provides helpers over the subspaces of the bindings. It
+is a part of FoundationDb layer.
+
+Tx binds a transaction to a subspace, so code given one can't read or
+write outside of it. Dump shows the raw contents of a subspace and
+Children lists the first elements of its tuples without reading all of
+them. EstimateSize and EstimateCount extrapolate the size of a subspace
+from a sample of its keys. CopyTo and MoveTo rewrite the keys of one
+subspace under another, a batch per transaction. Sample picks keys spread
+across a subspace, for a look at what fills it. Equal, Compare and
+IsPrefixOf give subspaces value semantics by their prefixes, and
+SelectorFrom, SelectorAfter and LastBefore build key selectors for the
+tuples of a subspace. NotifyKey, Bump and Watch let writers to a
+subspace wake up its watchers. ReadRange walks the tuples of a subspace
+within bounds without buffering them.
+*/
+
+package subspaces
+
+import (
+	"bytes"
+	"errors"
+	"github.com/FoundationDB/fdb-go/fdb"
+	"github.com/FoundationDB/fdb-go/fdb/subspace"
+	"github.com/FoundationDB/fdb-go/fdb/tuple"
+)
+
+// ErrOutside is returned by raw key operations of a Tx on keys outside
+// its subspace
+var ErrOutside = errors.New("key outside of the subspace")
+
+// Tx is a transaction bound to a subspace. Keys are tuples packed within
+// the subspace; raw keys are checked to be in it. Layers can take a Tx in
+// place of a transaction to promise callers they stay in the subspace.
+type Tx struct {
+	Subspace subspace.Subspace
+	tr       fdb.Transaction
+}
+
+// NewTx binds the transaction to the subspace
+func NewTx(tr fdb.Transaction, sub subspace.Subspace) Tx {
+	return Tx{sub, tr}
+}
+
+// Sub returns the transaction bound to a subspace nested in this one
+func (tx Tx) Sub(el ...tuple.TupleElement) Tx {
+	return Tx{tx.Subspace.Sub(el...), tx.tr}
+}
+
+// Get reads the key of the tuple
+func (tx Tx) Get(t tuple.Tuple) fdb.FutureByteSlice {
+	return tx.tr.Get(tx.Subspace.Pack(t))
+}
+
+// Set writes the key of the tuple
+func (tx Tx) Set(t tuple.Tuple, value []byte) {
+	tx.tr.Set(tx.Subspace.Pack(t), value)
+}
+
+// Clear clears the key of the tuple
+func (tx Tx) Clear(t tuple.Tuple) {
+	tx.tr.Clear(tx.Subspace.Pack(t))
+}
+
+// GetRange reads the keys that start with the tuple, all of the subspace
+// for an empty one
+func (tx Tx) GetRange(prefix tuple.Tuple, options fdb.RangeOptions) fdb.RangeResult {
+	return tx.tr.GetRange(tx.Subspace.Sub(prefix...), options)
+}
+
+// ClearRange clears the keys that start with the tuple, all of the
+// subspace for an empty one
+func (tx Tx) ClearRange(prefix tuple.Tuple) {
+	tx.tr.ClearRange(tx.Subspace.Sub(prefix...))
+}
+
+// Unpack returns the tuple of a key of the subspace
+func (tx Tx) Unpack(key fdb.KeyConvertible) (tuple.Tuple, error) {
+	if !tx.Subspace.Contains(key) {
+		return nil, ErrOutside
+	}
+	return tx.Subspace.Unpack(key)
+}
+
+// GetRaw reads a raw key of the subspace
+func (tx Tx) GetRaw(key fdb.KeyConvertible) (fdb.FutureByteSlice, error) {
+	if !tx.Subspace.Contains(key) {
+		return fdb.FutureByteSlice{}, ErrOutside
+	}
+	return tx.tr.Get(key), nil
+}
+
+// SetRaw writes a raw key of the subspace
+func (tx Tx) SetRaw(key fdb.KeyConvertible, value []byte) error {
+	if !tx.Subspace.Contains(key) {
+		return ErrOutside
+	}
+	tx.tr.Set(key, value)
+	return nil
+}
+
+// ClearRaw clears a raw key of the subspace
+func (tx Tx) ClearRaw(key fdb.KeyConvertible) error {
+	if !tx.Subspace.Contains(key) {
+		return ErrOutside
+	}
+	tx.tr.Clear(key)
+	return nil
+}
+
+// GetRangeRaw reads a range of raw keys, which has to lie within the
+// subspace
+func (tx Tx) GetRangeRaw(r fdb.KeyRange, options fdb.RangeOptions) (fdb.RangeResult, error) {
+	if !tx.within(r) {
+		return fdb.RangeResult{}, ErrOutside
+	}
+	return tx.tr.GetRange(r, options), nil
+}
+
+// ClearRangeRaw clears a range of raw keys, which has to lie within the
+// subspace
+func (tx Tx) ClearRangeRaw(r fdb.KeyRange) error {
+	if !tx.within(r) {
+		return ErrOutside
+	}
+	tx.tr.ClearRange(r)
+	return nil
+}
+
+// within tells whether the range lies within the subspace. Its end may be
+// the end of the subspace range, which the subspace doesn't contain.
+func (tx Tx) within(r fdb.KeyRange) bool {
+	_, end := tx.Subspace.FDBRangeKeys()
+	b, e := r.Begin.FDBKey(), r.End.FDBKey()
+	return tx.Subspace.Contains(b) && bytes.Compare(e, end.FDBKey()) <= 0 && bytes.Compare(b, e) <= 0
+}
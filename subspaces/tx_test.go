@@ -0,0 +1,64 @@
+package subspaces
+
+import (
+	"github.com/FoundationDB/fdb-go/fdb"
+	"github.com/FoundationDB/fdb-go/fdb/tuple"
+	"github.com/abdullin/go-layers/internal/fdbtest"
+	"testing"
+)
+
+func TestTx(t *testing.T) {
+	db, sub := fdbtest.Open(t)
+	inner, outer := sub.Sub("inner"), sub.Sub("outer")
+
+	_, err := db.Transact(func(tr fdb.Transaction) (interface{}, error) {
+		tx := NewTx(tr, inner)
+		tx.Set(tuple.Tuple{"a"}, []byte("1"))
+		tx.Sub("b").Set(tuple.Tuple{"c"}, []byte("2"))
+
+		if err := tx.SetRaw(inner.Pack(tuple.Tuple{"d"}), []byte("3")); err != nil {
+			t.Errorf("raw write inside: %v", err)
+		}
+		if err := tx.SetRaw(outer.Pack(tuple.Tuple{"d"}), []byte("3")); err != ErrOutside {
+			t.Errorf("raw write outside: %v", err)
+		}
+		if err := tx.ClearRaw(outer.Pack(tuple.Tuple{"d"})); err != ErrOutside {
+			t.Errorf("raw clear outside: %v", err)
+		}
+		if _, err := tx.GetRaw(outer.Pack(tuple.Tuple{"d"})); err != ErrOutside {
+			t.Errorf("raw read outside: %v", err)
+		}
+
+		begin, end := inner.FDBRangeKeys()
+		if _, err := tx.GetRangeRaw(fdb.KeyRange{Begin: begin, End: end}, fdb.RangeOptions{}); err != nil {
+			t.Errorf("read of the whole subspace: %v", err)
+		}
+		if err := tx.ClearRangeRaw(fdb.KeyRange{Begin: begin, End: outer.Pack(tuple.Tuple{"z"})}); err != ErrOutside {
+			t.Errorf("clear past the subspace: %v", err)
+		}
+		return nil, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	v, err := db.Transact(func(tr fdb.Transaction) (interface{}, error) {
+		return NewTx(tr, inner).GetRange(nil, fdb.RangeOptions{}).GetSliceOrPanic(), nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if kvs := v.([]fdb.KeyValue); len(kvs) != 3 {
+		t.Fatalf("read %d keys, want 3", len(kvs))
+	}
+
+	v, err = db.Transact(func(tr fdb.Transaction) (interface{}, error) {
+		return tr.GetRange(outer, fdb.RangeOptions{}).GetSliceOrPanic(), nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if kvs := v.([]fdb.KeyValue); len(kvs) != 0 {
+		t.Fatalf("%d keys written outside", len(kvs))
+	}
+}
@@ -0,0 +1,126 @@
+/*
+Package table provides a table class. It is a part of FoundationDb layer.
+
+A table stores cells addressed by row and column. Every cell is written
+twice, in row-major and in column-major order, so both a row and a column
+are read with a single range read:
+
+	("row", row, column) -> value
+	("col", column, row) -> value
+
+Both copies are written and cleared in the same transaction, so they never
+disagree.
+
+This code is a port from official python layer
+*/
+
+package table
+
+import (
+	"github.com/FoundationDB/fdb-go/fdb"
+	"github.com/FoundationDB/fdb-go/fdb/subspace"
+	"github.com/FoundationDB/fdb-go/fdb/tuple"
+)
+
+type Table struct {
+	Subspace subspace.Subspace
+	rows     subspace.Subspace
+	cols     subspace.Subspace
+}
+
+// New table is created within a given subspace
+func New(sub subspace.Subspace) Table {
+	return Table{sub, sub.Sub("row"), sub.Sub("col")}
+}
+
+// SetCell sets the value of a cell
+func (t *Table) SetCell(tr fdb.Transaction, row, col string, value []byte) {
+	tr.Set(t.rows.Pack(tuple.Tuple{row, col}), value)
+	tr.Set(t.cols.Pack(tuple.Tuple{col, row}), value)
+}
+
+// GetCell returns the value of a cell, and false if it is not set
+func (t *Table) GetCell(tr fdb.Transaction, row, col string) ([]byte, bool) {
+	val := tr.Get(t.rows.Pack(tuple.Tuple{row, col})).GetOrPanic()
+	return val, val != nil
+}
+
+// ClearCell clears a cell
+func (t *Table) ClearCell(tr fdb.Transaction, row, col string) {
+	tr.Clear(t.rows.Pack(tuple.Tuple{row, col}))
+	tr.Clear(t.cols.Pack(tuple.Tuple{col, row}))
+}
+
+// GetRow returns the cells of a row by column
+func (t *Table) GetRow(tr fdb.Transaction, row string) map[string][]byte {
+	return readCells(tr, t.rows.Sub(row))
+}
+
+// GetCol returns the cells of a column by row
+func (t *Table) GetCol(tr fdb.Transaction, col string) map[string][]byte {
+	return readCells(tr, t.cols.Sub(col))
+}
+
+func readCells(tr fdb.Transaction, sub subspace.Subspace) map[string][]byte {
+	cells := make(map[string][]byte)
+	for _, kv := range tr.GetRange(sub, fdb.RangeOptions{}).GetSliceOrPanic() {
+		if t, err := sub.Unpack(kv.Key); err != nil {
+			panic(err)
+		} else {
+			cells[t[0].(string)] = kv.Value
+		}
+	}
+	return cells
+}
+
+// ClearRow clears all cells of a row
+func (t *Table) ClearRow(tr fdb.Transaction, row string) {
+	for col := range t.GetRow(tr, row) {
+		tr.Clear(t.cols.Pack(tuple.Tuple{col, row}))
+	}
+	tr.ClearRange(t.rows.Sub(row))
+}
+
+// ClearCol clears all cells of a column
+func (t *Table) ClearCol(tr fdb.Transaction, col string) {
+	for row := range t.GetCol(tr, col) {
+		tr.Clear(t.rows.Pack(tuple.Tuple{row, col}))
+	}
+	tr.ClearRange(t.cols.Sub(col))
+}
+
+// Rows returns the rows with at least one cell, in order
+func (t *Table) Rows(tr fdb.Transaction) []string {
+	return readNames(tr, t.rows)
+}
+
+// Cols returns the columns with at least one cell, in order
+func (t *Table) Cols(tr fdb.Transaction) []string {
+	return readNames(tr, t.cols)
+}
+
+// readNames returns the distinct first elements of the keys in the
+// subspace, reading one key per name instead of every cell
+func readNames(tr fdb.Transaction, sub subspace.Subspace) []string {
+	var names []string
+	begin, _ := sub.FDBRangeKeys()
+	for {
+		key := tr.GetKey(fdb.FirstGreaterOrEqual(begin)).GetOrPanic()
+		if !sub.Contains(key) {
+			return names
+		}
+		t, err := sub.Unpack(key)
+		if err != nil {
+			panic(err)
+		}
+		name := t[0].(string)
+		names = append(names, name)
+
+		_, begin = sub.Sub(name).FDBRangeKeys()
+	}
+}
+
+// Clear removes all cells of the table
+func (t *Table) Clear(tr fdb.Transaction) {
+	tr.ClearRange(t.Subspace)
+}
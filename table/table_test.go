@@ -0,0 +1,167 @@
+package table
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/FoundationDB/fdb-go/fdb"
+	"github.com/abdullin/go-layers/internal/fdbtest"
+	"reflect"
+	"sync"
+	"testing"
+)
+
+func transact(t *testing.T, db fdb.Database, fn func(tr fdb.Transaction)) {
+	t.Helper()
+	_, err := db.Transact(func(tr fdb.Transaction) (interface{}, error) {
+		fn(tr)
+		return nil, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// checkCopies fails unless the row-major and column-major copies hold the
+// same cells
+func checkCopies(t *testing.T, db fdb.Database, table Table) {
+	t.Helper()
+	v, err := db.Transact(func(tr fdb.Transaction) (interface{}, error) {
+		byRow := map[[2]string][]byte{}
+		for _, row := range table.Rows(tr) {
+			for col, val := range table.GetRow(tr, row) {
+				byRow[[2]string{row, col}] = val
+			}
+		}
+		byCol := map[[2]string][]byte{}
+		for _, col := range table.Cols(tr) {
+			for row, val := range table.GetCol(tr, col) {
+				byCol[[2]string{row, col}] = val
+			}
+		}
+		return [2]map[[2]string][]byte{byRow, byCol}, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	copies := v.([2]map[[2]string][]byte)
+	if !reflect.DeepEqual(copies[0], copies[1]) {
+		t.Fatalf("cells by row %v, by column %v", copies[0], copies[1])
+	}
+}
+
+func TestCells(t *testing.T) {
+	db, sub := fdbtest.Open(t)
+	table := New(sub)
+
+	transact(t, db, func(tr fdb.Transaction) {
+		table.SetCell(tr, "r1", "c1", []byte("a"))
+		table.SetCell(tr, "r1", "c2", []byte("b"))
+		table.SetCell(tr, "r2", "c1", []byte("c"))
+		table.SetCell(tr, "r3", "c3", []byte("d"))
+	})
+	transact(t, db, func(tr fdb.Transaction) {
+		if val, ok := table.GetCell(tr, "r1", "c2"); !ok || !bytes.Equal(val, []byte("b")) {
+			t.Errorf("cell r1/c2 is %q, %v", val, ok)
+		}
+		if _, ok := table.GetCell(tr, "r2", "c2"); ok {
+			t.Error("unset cell r2/c2 found")
+		}
+		if rows := table.Rows(tr); !reflect.DeepEqual(rows, []string{"r1", "r2", "r3"}) {
+			t.Errorf("rows %v", rows)
+		}
+		if cols := table.Cols(tr); !reflect.DeepEqual(cols, []string{"c1", "c2", "c3"}) {
+			t.Errorf("columns %v", cols)
+		}
+		if col := table.GetCol(tr, "c1"); len(col) != 2 || string(col["r1"]) != "a" || string(col["r2"]) != "c" {
+			t.Errorf("column c1 %q", col)
+		}
+	})
+
+	transact(t, db, func(tr fdb.Transaction) {
+		table.ClearCell(tr, "r3", "c3")
+		table.ClearRow(tr, "r1")
+	})
+	transact(t, db, func(tr fdb.Transaction) {
+		if rows := table.Rows(tr); !reflect.DeepEqual(rows, []string{"r2"}) {
+			t.Errorf("rows after clearing %v", rows)
+		}
+		if cols := table.Cols(tr); !reflect.DeepEqual(cols, []string{"c1"}) {
+			t.Errorf("columns after clearing %v", cols)
+		}
+	})
+	checkCopies(t, db, table)
+
+	transact(t, db, func(tr fdb.Transaction) {
+		table.ClearCol(tr, "c1")
+	})
+	transact(t, db, func(tr fdb.Transaction) {
+		if rows := table.Rows(tr); len(rows) != 0 {
+			t.Errorf("rows after clearing the last column %v", rows)
+		}
+	})
+}
+
+func TestReadNames(t *testing.T) {
+	db, sub := fdbtest.Open(t)
+	table := New(sub)
+
+	// names that are prefixes of each other, or need escaping, are still
+	// read once each
+	names := []string{"", "a", "a\x00", "a\x00b", "ab", "b"}
+	transact(t, db, func(tr fdb.Transaction) {
+		for _, row := range names {
+			for i := 0; i < 3; i++ {
+				table.SetCell(tr, row, fmt.Sprintf("col-%d", i), []byte("v"))
+			}
+		}
+	})
+	transact(t, db, func(tr fdb.Transaction) {
+		if rows := table.Rows(tr); !reflect.DeepEqual(rows, names) {
+			t.Errorf("rows %q, want %q", rows, names)
+		}
+		if cols := table.Cols(tr); !reflect.DeepEqual(cols, []string{"col-0", "col-1", "col-2"}) {
+			t.Errorf("columns %q", cols)
+		}
+	})
+}
+
+func TestClearConcurrent(t *testing.T) {
+	db, sub := fdbtest.Open(t)
+	table := New(sub)
+
+	const n = 10
+	transact(t, db, func(tr fdb.Transaction) {
+		for i := 0; i < n; i++ {
+			table.SetCell(tr, fmt.Sprintf("r%d", i), fmt.Sprintf("c%d", i), []byte("v"))
+		}
+	})
+
+	// writers fill rows and columns while others clear them; whichever
+	// order the transactions commit in, the two copies must agree
+	var wg sync.WaitGroup
+	errs := make(chan error, 4*n)
+	run := func(fn func(tr fdb.Transaction)) {
+		defer wg.Done()
+		_, err := db.Transact(func(tr fdb.Transaction) (interface{}, error) {
+			fn(tr)
+			return nil, nil
+		})
+		if err != nil {
+			errs <- err
+		}
+	}
+	for i := 0; i < n; i++ {
+		row, col := fmt.Sprintf("r%d", i), fmt.Sprintf("c%d", i)
+		wg.Add(4)
+		go run(func(tr fdb.Transaction) { table.SetCell(tr, row, col, []byte("new")) })
+		go run(func(tr fdb.Transaction) { table.SetCell(tr, row, "c0", []byte("new")) })
+		go run(func(tr fdb.Transaction) { table.ClearRow(tr, row) })
+		go run(func(tr fdb.Transaction) { table.ClearCol(tr, col) })
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Fatal(err)
+	}
+	checkCopies(t, db, table)
+}
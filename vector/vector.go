@@ -0,0 +1,139 @@
+/*
+Package vector provides a sparse growable array class. It is a part of
+FoundationDb layer.
+
+Every set slot is stored under its index. Slots that were never set
+occupy no key and read as the default value.
+The last slot always has a key, possibly holding the default, so the
+size of the vector is a single key read.
+
+This code is a port from official python layer
+*/
+
+package vector
+
+import (
+	"errors"
+	"github.com/FoundationDB/fdb-go/fdb"
+	"github.com/FoundationDB/fdb-go/fdb/subspace"
+	"github.com/FoundationDB/fdb-go/fdb/tuple"
+)
+
+var (
+	ErrNegativeIndex = errors.New("vector index is negative")
+	ErrEmpty         = errors.New("vector is empty")
+)
+
+type Vector struct {
+	Subspace     subspace.Subspace
+	DefaultValue []byte
+}
+
+// New vector is created within a given subspace. Unset slots read as
+// defaultValue.
+func New(sub subspace.Subspace, defaultValue []byte) Vector {
+	return Vector{sub, defaultValue}
+}
+
+func (vector *Vector) key(index int64) fdb.Key {
+	return vector.Subspace.Pack(tuple.Tuple{index})
+}
+
+func encodeValue(value []byte) []byte {
+	return tuple.Tuple{value}.Pack()
+}
+
+func decodeValue(val []byte) []byte {
+	if t, err := tuple.Unpack(val); err != nil {
+		panic(err)
+	} else {
+		return t[0].([]byte)
+	}
+}
+
+// Size returns the number of slots
+func (vector *Vector) Size(tr fdb.Transaction) int64 {
+	kvs := tr.GetRange(vector.Subspace, fdb.RangeOptions{Limit: 1, Reverse: true}).GetSliceOrPanic()
+	if len(kvs) == 0 {
+		return 0
+	}
+	return vector.index(kvs[0].Key) + 1
+}
+
+func (vector *Vector) index(key fdb.Key) int64 {
+	t, err := vector.Subspace.Unpack(key)
+	if err != nil {
+		panic(err)
+	}
+	return t[0].(int64)
+}
+
+// Get returns the value of a slot, the default for unset slots and for
+// indexes past the end
+func (vector *Vector) Get(tr fdb.Transaction, index int64) ([]byte, error) {
+	if index < 0 {
+		return nil, ErrNegativeIndex
+	}
+	if val := tr.Get(vector.key(index)).GetOrPanic(); val != nil {
+		return decodeValue(val), nil
+	}
+	return vector.DefaultValue, nil
+}
+
+// Set stores a value in a slot, growing the vector if the index is past
+// its end
+func (vector *Vector) Set(tr fdb.Transaction, index int64, value []byte) error {
+	if index < 0 {
+		return ErrNegativeIndex
+	}
+	tr.Set(vector.key(index), encodeValue(value))
+	return nil
+}
+
+// Push appends a value after the last slot
+func (vector *Vector) Push(tr fdb.Transaction, value []byte) {
+	tr.Set(vector.key(vector.Size(tr)), encodeValue(value))
+}
+
+// PopBack removes the last slot and returns its value, failing with
+// ErrEmpty on an empty vector
+func (vector *Vector) PopBack(tr fdb.Transaction) ([]byte, error) {
+	// the last two keys: the last slot and the one the end moves to
+	kvs := tr.GetRange(vector.Subspace, fdb.RangeOptions{Limit: 2, Reverse: true}).GetSliceOrPanic()
+	if len(kvs) == 0 {
+		return nil, ErrEmpty
+	}
+
+	last := vector.index(kvs[0].Key)
+	tr.Clear(kvs[0].Key)
+	if last > 0 && (len(kvs) < 2 || vector.index(kvs[1].Key) < last-1) {
+		// keep a key at the new last slot, so the size stays known
+		tr.Set(vector.key(last-1), encodeValue(vector.DefaultValue))
+	}
+	return decodeValue(kvs[0].Value), nil
+}
+
+// Resize grows the vector with default slots or truncates it to the
+// length
+func (vector *Vector) Resize(tr fdb.Transaction, length int64) error {
+	if length < 0 {
+		return ErrNegativeIndex
+	}
+	size := vector.Size(tr)
+	switch {
+	case length > size:
+		tr.Set(vector.key(length-1), encodeValue(vector.DefaultValue))
+	case length < size:
+		_, end := vector.Subspace.FDBRangeKeys()
+		tr.ClearRange(fdb.KeyRange{Begin: vector.key(length), End: end})
+		if length > 0 && tr.Get(vector.key(length-1)).GetOrPanic() == nil {
+			tr.Set(vector.key(length-1), encodeValue(vector.DefaultValue))
+		}
+	}
+	return nil
+}
+
+// Clear removes all slots
+func (vector *Vector) Clear(tr fdb.Transaction) {
+	tr.ClearRange(vector.Subspace)
+}
@@ -0,0 +1,173 @@
+package vector
+
+import (
+	"github.com/FoundationDB/fdb-go/fdb"
+	"github.com/abdullin/go-layers/internal/fdbtest"
+	"testing"
+)
+
+func transact(t *testing.T, db fdb.Database, fn func(tr fdb.Transaction)) {
+	t.Helper()
+	_, err := db.Transact(func(tr fdb.Transaction) (interface{}, error) {
+		fn(tr)
+		return nil, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestNegativeIndex(t *testing.T) {
+	db, sub := fdbtest.Open(t)
+	v := New(sub, nil)
+
+	transact(t, db, func(tr fdb.Transaction) {
+		if _, err := v.Get(tr, -1); err != ErrNegativeIndex {
+			t.Errorf("get at -1: %v", err)
+		}
+		if err := v.Set(tr, -1, []byte("x")); err != ErrNegativeIndex {
+			t.Errorf("set at -1: %v", err)
+		}
+		if err := v.Resize(tr, -1); err != ErrNegativeIndex {
+			t.Errorf("resize to -1: %v", err)
+		}
+		if size := v.Size(tr); size != 0 {
+			t.Errorf("size %d after failed writes", size)
+		}
+	})
+}
+
+func TestSparse(t *testing.T) {
+	db, sub := fdbtest.Open(t)
+	v := New(sub, []byte("default"))
+
+	const far = 1000000
+	transact(t, db, func(tr fdb.Transaction) {
+		v.Push(tr, []byte("first"))
+		if err := v.Set(tr, far, []byte("far")); err != nil {
+			t.Error(err)
+		}
+	})
+	transact(t, db, func(tr fdb.Transaction) {
+		if size := v.Size(tr); size != far+1 {
+			t.Errorf("size %d after setting %d", size, far)
+		}
+		for index, want := range map[int64]string{0: "first", 1: "default", far - 1: "default", far: "far", far + 1: "default"} {
+			if val, err := v.Get(tr, index); err != nil || string(val) != want {
+				t.Errorf("slot %d is %q, %v, want %q", index, val, err, want)
+			}
+		}
+	})
+	v2, err := db.Transact(func(tr fdb.Transaction) (interface{}, error) {
+		return tr.GetRange(sub, fdb.RangeOptions{}).GetSliceWithError()
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := len(v2.([]fdb.KeyValue)); n != 2 {
+		t.Fatalf("%d keys for 2 set slots", n)
+	}
+}
+
+func TestPopBack(t *testing.T) {
+	db, sub := fdbtest.Open(t)
+	v := New(sub, []byte("default"))
+
+	transact(t, db, func(tr fdb.Transaction) {
+		if _, err := v.PopBack(tr); err != ErrEmpty {
+			t.Errorf("pop of an empty vector: %v", err)
+		}
+		v.Set(tr, 0, []byte("a"))
+		v.Set(tr, 5, []byte("b"))
+	})
+
+	// popping a slot after a gap keeps a key at the new last slot
+	transact(t, db, func(tr fdb.Transaction) {
+		if val, err := v.PopBack(tr); err != nil || string(val) != "b" {
+			t.Errorf("popped %q, %v", val, err)
+		}
+	})
+	transact(t, db, func(tr fdb.Transaction) {
+		if size := v.Size(tr); size != 5 {
+			t.Errorf("size %d after popping slot 5", size)
+		}
+		if val, err := v.PopBack(tr); err != nil || string(val) != "default" {
+			t.Errorf("popped %q, %v from an unset slot", val, err)
+		}
+	})
+	transact(t, db, func(tr fdb.Transaction) {
+		if size := v.Size(tr); size != 4 {
+			t.Errorf("size %d after popping slot 4", size)
+		}
+		for i := 0; i < 3; i++ {
+			v.PopBack(tr)
+		}
+		if val, err := v.PopBack(tr); err != nil || string(val) != "a" {
+			t.Errorf("popped %q, %v as the first slot", val, err)
+		}
+		if size := v.Size(tr); size != 0 {
+			t.Errorf("size %d after popping everything", size)
+		}
+		if _, err := v.PopBack(tr); err != ErrEmpty {
+			t.Errorf("pop of an emptied vector: %v", err)
+		}
+	})
+}
+
+func TestResize(t *testing.T) {
+	db, sub := fdbtest.Open(t)
+	v := New(sub, []byte("default"))
+
+	transact(t, db, func(tr fdb.Transaction) {
+		for _, s := range []string{"0", "1", "2", "3", "4"} {
+			v.Push(tr, []byte(s))
+		}
+		v.Set(tr, 9, []byte("9"))
+	})
+
+	transact(t, db, func(tr fdb.Transaction) {
+		if err := v.Resize(tr, 3); err != nil {
+			t.Error(err)
+		}
+	})
+	transact(t, db, func(tr fdb.Transaction) {
+		if size := v.Size(tr); size != 3 {
+			t.Errorf("size %d after shrinking to 3", size)
+		}
+		if val, _ := v.Get(tr, 2); string(val) != "2" {
+			t.Errorf("kept slot 2 is %q", val)
+		}
+		// cut slots read as the default when the vector grows again
+		if err := v.Resize(tr, 10); err != nil {
+			t.Error(err)
+		}
+	})
+	transact(t, db, func(tr fdb.Transaction) {
+		if size := v.Size(tr); size != 10 {
+			t.Errorf("size %d after growing to 10", size)
+		}
+		for _, index := range []int64{3, 4, 9} {
+			if val, _ := v.Get(tr, index); string(val) != "default" {
+				t.Errorf("slot %d is %q after shrinking and growing", index, val)
+			}
+		}
+	})
+
+	// shrinking into a gap keeps a key at the new last slot
+	transact(t, db, func(tr fdb.Transaction) {
+		if err := v.Resize(tr, 6); err != nil {
+			t.Error(err)
+		}
+	})
+	transact(t, db, func(tr fdb.Transaction) {
+		if size := v.Size(tr); size != 6 {
+			t.Errorf("size %d after shrinking into a gap", size)
+		}
+		if err := v.Resize(tr, 0); err != nil {
+			t.Error(err)
+		}
+		if size := v.Size(tr); size != 0 {
+			t.Errorf("size %d after shrinking to 0", size)
+		}
+	})
+}
@@ -0,0 +1,61 @@
+/*
+Package versionstamp builds the operands of versionstamped operations for
+the API version the client selected. It is a part of FoundationDb layer.
+
+Versionstamped keys end in the offset of the placeholder: 2 bytes before
+API version 520, 4 bytes since. Versionstamped values before 520 take no
+offset and always get the versionstamp at their start.
+*/
+
+package versionstamp
+
+import (
+	"errors"
+	"github.com/FoundationDB/fdb-go/fdb"
+)
+
+// DefaultAPIVersion is assumed until Select is called
+const DefaultAPIVersion = 510
+
+// offsetAPIVersion is the first API version with 4 byte offsets and
+// versionstamps anywhere in values
+const offsetAPIVersion = 520
+
+// ErrValueOffset is returned for values with the versionstamp past their
+// start before API version 520
+var ErrValueOffset = errors.New("versionstamp only at the start of values before API version 520")
+
+var apiVersion = DefaultAPIVersion
+
+// Select selects the API version of the client, like fdb.APIVersion, and
+// the layout of versionstamped operations with it. Call it at start up
+// instead of fdb.APIVersion.
+func Select(version int) error {
+	if err := fdb.APIVersion(version); err != nil {
+		return err
+	}
+	apiVersion = version
+	return nil
+}
+
+// Key appends the offset of the placeholder to a key for
+// SetVersionstampedKey. It may write into spare capacity of key.
+func Key(key []byte, offset int) []byte {
+	if apiVersion < offsetAPIVersion {
+		return append(key, byte(offset), byte(offset>>8))
+	}
+	return append(key, byte(offset), byte(offset>>8), byte(offset>>16), byte(offset>>24))
+}
+
+// Value appends the offset of the placeholder to a value for
+// SetVersionstampedValue, if the API version takes one. It may write into
+// spare capacity of val.
+func Value(val []byte, offset int) ([]byte, error) {
+	if apiVersion < offsetAPIVersion {
+		if offset != 0 {
+			return nil, ErrValueOffset
+		}
+		return val, nil
+	}
+	return append(val, byte(offset), byte(offset>>8), byte(offset>>16), byte(offset>>24)), nil
+}